@@ -12,6 +12,8 @@ import (
 	"strings"
 
 	"github.com/FactomProject/btcutil/base58"
+	"github.com/FactomProject/enterprise-wallet/fct"
+	"github.com/FactomProject/enterprise-wallet/marshal"
 	"github.com/FactomProject/factom"
 )
 
@@ -20,13 +22,21 @@ var _ = fmt.Sprintf("")
 // MaxNameLength is the longest a name is allowed to be.
 const MaxNameLength int = 20
 
+// MaxReservedLength is the longest the purpose of a reserved address is allowed to be.
+const MaxReservedLength int = 60
+
 // AddressNamePair represents a public address to a user readable name. Also contains
-// whether is was generated by the seed.
+// whether is was generated by the seed, and the spending policy of the address.
 type AddressNamePair struct {
 	Name    string // Length maxNameLength Characters
 	Address string
 	Seeded  bool // Derived from seeed
 
+	// Spending policy, only used for factoid addresses
+	Frozen     bool   // Never used as an input
+	Reserved   string // What the address is reserved for. Only used when chosen as an input
+	MinBalance uint64 // Factoshis that must be left in the address
+
 	// Not Marshaled
 	Balance int64 // Unused except for JSON return
 }
@@ -105,6 +115,48 @@ func (anp *AddressNamePair) ChangeName(name string) error {
 	return nil
 }
 
+// SetReserved reserves the address for a purpose, or releases it if the purpose is empty
+func (anp *AddressNamePair) SetReserved(purpose string) error {
+	if len(purpose) > MaxReservedLength {
+		return fmt.Errorf("Purpose too long, must be less than %d characters", MaxReservedLength)
+	}
+
+	anp.Reserved = purpose
+	return nil
+}
+
+// HasPolicy is true if the address is frozen, reserved or has a minimum balance
+func (anp *AddressNamePair) HasPolicy() bool {
+	return anp.Frozen || anp.Reserved != "" || anp.MinBalance > 0
+}
+
+// Spendable returns how much of the balance automatic coin selection may use. Frozen and
+// reserved addresses are never chosen, and the minimum balance is left alone.
+func (anp *AddressNamePair) Spendable(balance uint64) uint64 {
+	if anp.Frozen || anp.Reserved != "" || balance <= anp.MinBalance {
+		return 0
+	}
+	return balance - anp.MinBalance
+}
+
+// CheckSpend returns an error if taking amount from the address breaks its policy. A reserved
+// address can be spent from, when it is chosen on purpose.
+func (anp *AddressNamePair) CheckSpend(balance uint64, amount uint64) error {
+	if anp.Frozen {
+		return fmt.Errorf("%s (%s) is frozen, and cannot be used as an input. Unfreeze it first.", anp.Name, anp.Address)
+	}
+	if amount > balance || balance-amount < anp.MinBalance {
+		var most uint64
+		if balance > anp.MinBalance {
+			most = balance - anp.MinBalance
+		}
+		return fmt.Errorf("Spending %s FCT from %s (%s) would leave less than its minimum balance of %s FCT. "+
+			"At most %s FCT can be spent from it.",
+			fct.Amount(amount), anp.Name, anp.Address, fct.Amount(anp.MinBalance), fct.Amount(most))
+	}
+	return nil
+}
+
 // IsSimilarTo will ONLY compare addresses, not names or seeded.
 func (anp *AddressNamePair) IsSimilarTo(b *AddressNamePair) bool {
 	if strings.Compare(anp.Address, b.Address) != 0 {
@@ -114,7 +166,7 @@ func (anp *AddressNamePair) IsSimilarTo(b *AddressNamePair) bool {
 	return true
 }
 
-// IsSameAs will compare addresses and names
+// IsSameAs will compare addresses, names and spending policies
 func (anp *AddressNamePair) IsSameAs(b *AddressNamePair) bool {
 	if !anp.IsSimilarTo(b) {
 		return false
@@ -124,33 +176,93 @@ func (anp *AddressNamePair) IsSameAs(b *AddressNamePair) bool {
 		return false
 	}
 
+	if anp.Frozen != b.Frozen || anp.Reserved != b.Reserved || anp.MinBalance != b.MinBalance {
+		return false
+	}
+
 	return true
 }
 
+// Version of the AddressNamePair binary format, and its field tags
+const (
+	anpVersion byte = 1
+
+	anpTagName    uint64 = 1
+	anpTagAddress uint64 = 2
+	anpTagSeeded  uint64 = 3
+
+	anpTagFrozen     uint64 = 4
+	anpTagReserved   uint64 = 5
+	anpTagMinBalance uint64 = 6
+)
+
 // MarshalBinary will convert an AddressNamePair to a []byte, which can be unmarshaled
 func (anp *AddressNamePair) MarshalBinary() (data []byte, err error) {
-	buf := new(bytes.Buffer)
+	w := marshal.NewWriter()
+	w.String(anpTagName, anp.Name)
+	w.String(anpTagAddress, anp.Address)
+	w.Bool(anpTagSeeded, anp.Seeded)
+
+	// Most addresses have no policy, they are left out to keep the list small
+	if anp.Frozen {
+		w.Bool(anpTagFrozen, anp.Frozen)
+	}
+	if anp.Reserved != "" {
+		w.String(anpTagReserved, anp.Reserved)
+	}
+	if anp.MinBalance > 0 {
+		w.Uint64(anpTagMinBalance, anp.MinBalance)
+	}
 
-	var n [MaxNameLength]byte
-	copy(n[:MaxNameLength], anp.Name)
-	buf.Write(n[:MaxNameLength]) // 0:20
+	return w.Marshal(anpVersion), nil
+}
 
-	add := base58.Decode(anp.Address)
-	var a [38]byte
-	copy(a[:38], add[:])
-	buf.Write(a[:38]) // 20:58
+func (anp *AddressNamePair) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	if !marshal.IsVersioned(data) {
+		return anp.unmarshalLegacy(data)
+	}
 
-	var b []byte
-	b = strconv.AppendBool(b, anp.Seeded)
-	if anp.Seeded {
-		b = append(b, 0x00)
+	_, fields, newData, err := marshal.Unmarshal(data)
+	if err != nil {
+		return data, err
 	}
-	buf.Write(b) // 58:63
 
-	return buf.Next(buf.Len()), nil
+	for _, f := range fields {
+		switch f.Tag {
+		case anpTagName:
+			anp.Name = f.String()
+		case anpTagAddress:
+			anp.Address = f.String()
+		case anpTagSeeded:
+			anp.Seeded, err = f.Bool()
+		case anpTagFrozen:
+			anp.Frozen, err = f.Bool()
+		case anpTagReserved:
+			anp.Reserved = f.String()
+		case anpTagMinBalance:
+			anp.MinBalance, err = f.Uint64()
+		}
+		if err != nil {
+			return data, err
+		}
+	}
+
+	// Correct any bad names
+	_, anp.Name = sanitize(anp.Name)
+
+	return newData, nil
 }
 
-func (anp *AddressNamePair) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+// legacyANPLength is the size of the fixed layout used before the versioned format
+//
+//	Name (20) | Address (38) | "true\x00" or "false" (5)
+const legacyANPLength int = MaxNameLength + 38 + 5
+
+// unmarshalLegacy reads the fixed layout used before the versioned format
+func (anp *AddressNamePair) unmarshalLegacy(data []byte) (newData []byte, err error) {
+	if len(data) < legacyANPLength {
+		return data, fmt.Errorf("Not enough data for an address, found %d bytes", len(data))
+	}
 	newData = data
 
 	nameData := bytes.Trim(newData[:MaxNameLength], "\x00")
@@ -286,33 +398,73 @@ func (addList *AddressList) ResetSeeded() {
 	}
 }
 
-func (addList *AddressList) MarshalBinary() (data []byte, err error) {
-	buf := new(bytes.Buffer)
-	var number [8]byte
-	binary.BigEndian.PutUint64(number[:], addList.Length)
-	buf.Write(number[:])
+// Version of the AddressList binary format, and its field tags
+const (
+	addressListVersion byte = 1
+
+	addressListTagAddress uint64 = 1 // Repeated for every address, in order
+)
 
+func (addList *AddressList) MarshalBinary() (data []byte, err error) {
+	w := marshal.NewWriter()
 	for _, anp := range addList.List {
 		anpData, err := anp.MarshalBinary()
 		if err != nil {
 			return nil, err
 		}
-		buf.Write(anpData)
+		w.Bytes(addressListTagAddress, anpData)
 	}
 
-	return buf.Next(buf.Len()), err
+	return w.Marshal(addressListVersion), nil
 }
 
 func (addList *AddressList) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	if !marshal.IsVersioned(data) {
+		return addList.unmarshalLegacy(data)
+	}
+
+	_, fields, newData, err := marshal.Unmarshal(data)
+	if err != nil {
+		return data, err
+	}
+
+	addList.List = nil
+	for _, f := range fields {
+		switch f.Tag {
+		case addressListTagAddress:
+			anp := new(AddressNamePair)
+			_, err = anp.UnmarshalBinaryData(f.Data)
+			if err != nil {
+				return data, err
+			}
+			addList.List = append(addList.List, *anp)
+		}
+	}
+	addList.Length = uint64(len(addList.List))
+
+	return newData, nil
+}
+
+// unmarshalLegacy reads the layout used before the versioned format
+//
+//	Length (8) | AddressNamePair (63) * Length
+func (addList *AddressList) unmarshalLegacy(data []byte) (newData []byte, err error) {
+	if len(data) < 8 {
+		return data, fmt.Errorf("Not enough data for an address list")
+	}
 	newData = data
 
 	addList.Length = binary.BigEndian.Uint64(data[:8])
 	newData = newData[8:]
 
+	addList.List = nil
 	var i uint64 = 0
 	for i < addList.Length {
 		anp := new(AddressNamePair)
-		newData, err = anp.UnmarshalBinaryData(newData)
+		newData, err = anp.unmarshalLegacy(newData)
+		if err != nil {
+			return data, err
+		}
 		addList.List = append(addList.List, *anp)
 		i++
 	}
@@ -325,6 +477,38 @@ func (addList *AddressList) UnmarshalBinary(data []byte) (err error) {
 	return
 }
 
+// UnmarshalBinaryChecked is UnmarshalBinary, but an address that cannot be decoded is
+// left out of the list and returned in problems, instead of failing the whole list.
+// A list in the legacy layout cannot be read past a bad address, so it still fails.
+func (addList *AddressList) UnmarshalBinaryChecked(data []byte) (problems []error, err error) {
+	if !marshal.IsVersioned(data) {
+		_, err = addList.unmarshalLegacy(data)
+		return nil, err
+	}
+
+	_, fields, _, err := marshal.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	addList.List = nil
+	for i, f := range fields {
+		if f.Tag != addressListTagAddress {
+			continue
+		}
+		anp := new(AddressNamePair)
+		_, err = anp.UnmarshalBinaryData(f.Data)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("Address %d could not be decoded: %s", i, err.Error()))
+			continue
+		}
+		addList.List = append(addList.List, *anp)
+	}
+	addList.Length = uint64(len(addList.List))
+
+	return problems, nil
+}
+
 // IsSameAs will call the IsSameAs for individual elemtents, meaning it will compare
 // length, addresses, names, AND order
 func (addList *AddressList) IsSameAs(b *AddressList) bool {
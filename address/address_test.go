@@ -2,6 +2,7 @@ package address_test
 
 import (
 	crand "crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"math/rand"
 	"strings"
@@ -9,6 +10,7 @@ import (
 
 	ed "github.com/FactomProject/ed25519"
 	. "github.com/FactomProject/enterprise-wallet/address"
+	"github.com/FactomProject/enterprise-wallet/marshal"
 	"github.com/FactomProject/factom"
 )
 
@@ -54,6 +56,41 @@ func TestAddressNamePairMarshal(t *testing.T) {
 	}
 }
 
+func TestAddressNamePairLegacyUnmarshal(t *testing.T) {
+	// Fixed 63 byte layout used before the versioned format
+	data, err := hex.DecodeString("466163746f6964317373000000000000000000005fb113b14e2fef4069770a6416dee1ff395eb8cea2c07cfaacce5c042b6f84c8c7d91c356e257472756500")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := new(AddressNamePair)
+	rest, err := a.UnmarshalBinaryData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("Should be length 0, found %d", len(rest))
+	}
+
+	if a.Name != "Factoid1ss" || a.Address != "FA27kaVcH76hDsLmZuSq2yad6zrmUDUm6KCHq6nibEZiKbBSLQ8C" || !a.Seeded {
+		t.Fatal("Legacy address not read correctly")
+	}
+
+	// Saving again uses the current format
+	data, err = a.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(AddressNamePair)
+	err = b.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.IsSameAs(a) || !b.Seeded {
+		t.Fatal("Failed: Not same")
+	}
+}
+
 func TestNewAddressFails(t *testing.T) {
 	add, err := RandomAddress()
 	if err != nil {
@@ -353,3 +390,91 @@ func RandStringBytes(n int) string {
 	}
 	return string(b)
 }
+
+func TestAddressListUnmarshalChecked(t *testing.T) {
+	a, err := NewAddress("Good", "FA27kaVcH76hDsLmZuSq2yad6zrmUDUm6KCHq6nibEZiKbBSLQ8C")
+	if err != nil {
+		t.Fatal(err)
+	}
+	good, err := a.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A list with one good address, and one that cannot be decoded
+	w := marshal.NewWriter()
+	w.Bytes(1, good)
+	w.Bytes(1, []byte{0x01, 0x02})
+	data := w.Marshal(1)
+
+	l := NewAddressList()
+	if err = l.UnmarshalBinary(data); err == nil {
+		t.Fatal("Should fail with a bad address")
+	}
+
+	l = NewAddressList()
+	problems, err := l.UnmarshalBinaryChecked(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 {
+		t.Fatalf("Expected 1 problem, found %d", len(problems))
+	}
+	if l.Length != 1 || l.List[0].Name != "Good" {
+		t.Fatal("The good address was not kept")
+	}
+}
+
+func TestAddressNamePairPolicy(t *testing.T) {
+	a, err := NewAddress("Policy", "FA27kaVcH76hDsLmZuSq2yad6zrmUDUm6KCHq6nibEZiKbBSLQ8C")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.HasPolicy() || a.Spendable(10e8) != 10e8 {
+		t.Fatal("A new address should have no policy")
+	}
+
+	a.MinBalance = 4e8
+	if a.Spendable(10e8) != 6e8 || a.Spendable(3e8) != 0 {
+		t.Fatal("The minimum balance was not left alone")
+	}
+	if a.CheckSpend(10e8, 6e8) != nil {
+		t.Fatal("Could not spend down to the minimum balance")
+	}
+	if a.CheckSpend(10e8, 7e8) == nil {
+		t.Fatal("Spent below the minimum balance")
+	}
+	a.MinBalance = 29000001
+	err = a.CheckSpend(1e8, 1e8)
+	if err == nil || !strings.Contains(err.Error(), "0.29000001 FCT") || !strings.Contains(err.Error(), "At most 0.70999999 FCT") {
+		t.Fatalf("The amounts in the error are not exact: %v", err)
+	}
+	a.MinBalance = 4e8
+
+	if err = a.SetReserved("Payroll"); err != nil {
+		t.Fatal(err)
+	}
+	if a.Spendable(10e8) != 0 {
+		t.Fatal("Automatic coin selection may spend a reserved address")
+	}
+	if a.CheckSpend(10e8, 1e8) != nil {
+		t.Fatal("A reserved address chosen as an input could not be spent")
+	}
+
+	a.Frozen = true
+	if a.CheckSpend(10e8, 1e8) == nil {
+		t.Fatal("Spent from a frozen address")
+	}
+
+	data, err := a.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(AddressNamePair)
+	if err = b.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !b.IsSameAs(a) {
+		t.Fatal("The spending policy was lost")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+// BackupWallet returns an encrypted archive of a wallet and the MasterSettings
+func BackupWallet(wal *wallet.WalletDB, passphrase string) ([]byte, error) {
+	settings, err := MasterSettings.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return wal.ExportBackup(passphrase, settings)
+}
+
+// RestoreWallet restores an archive made by BackupWallet. The settings are only
+// restored when replacing the wallet.
+func RestoreWallet(wal *wallet.WalletDB, data []byte, passphrase string, replace bool) (*wallet.RestoreReport, error) {
+	report, err := wal.ImportBackup(data, passphrase, replace)
+	if err != nil {
+		return nil, err
+	}
+
+	if report.Settings != nil {
+		s := new(SettingsStruct)
+		err = s.UnmarshalBinary(report.Settings)
+		if err != nil {
+			report.Conflicts = append(report.Conflicts, wallet.RestoreConflict{
+				Backup:     "Settings",
+				Resolution: "Kept the current settings, the backup settings could not be read: " + err.Error(),
+			})
+		} else {
+			applySettings(s)
+
+			err = SaveSettings(wal)
+			if err != nil {
+				return nil, err
+			}
+		}
+		report.Settings = nil
+	}
+
+	return report, nil
+}
+
+// applySettings copies the saved settings into MasterSettings. Settings that come from
+// the running instance, not the user, are left alone.
+func applySettings(s *SettingsStruct) {
+	MasterSettings.DarkTheme = s.DarkTheme
+	MasterSettings.Theme = s.Theme
+	MasterSettings.KeyExport = s.KeyExport
+	MasterSettings.CoinControl = s.CoinControl
+	MasterSettings.ImportExport = s.ImportExport
+	MasterSettings.FactomdLocation = s.FactomdLocation
+	MasterSettings.CoinSelection = s.CoinSelection
+	MasterSettings.SetFactomdLocation(MasterSettings.FactomdLocation)
+}
+
+// readLine prompts for a line on stdin, such as a passphrase
+func readLine(reader *bufio.Reader, prompt string) (string, error) {
+	fmt.Print(prompt)
+	line, err := reader.ReadString('\n')
+	if err != nil && len(line) == 0 {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// runBackupCommand handles the -backup and -restore flags. The wallet must already be
+// initiated. Passphrases are read from stdin.
+func runBackupCommand(backupPath string, restorePath string, restoreMode string) error {
+	reader := bufio.NewReader(os.Stdin)
+
+	wal, release := Wallets.Acquire()
+	defer release()
+
+	if wal.IsLocked() {
+		pass, err := readLine(reader, "Wallet passphrase: ")
+		if err != nil {
+			return err
+		}
+		err = wal.Unlock(pass)
+		if err != nil {
+			return err
+		}
+	}
+
+	if backupPath != "" {
+		pass, err := readLine(reader, "Backup passphrase: ")
+		if err != nil {
+			return err
+		}
+
+		data, err := BackupWallet(wal, pass)
+		if err != nil {
+			return err
+		}
+
+		err = ioutil.WriteFile(backupPath, data, 0600)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Wallet backed up to %s\n", backupPath)
+	}
+
+	if restorePath != "" {
+		var replace bool
+		switch restoreMode {
+		case "merge":
+			replace = false
+		case "replace":
+			replace = true
+		default:
+			return fmt.Errorf("Restore mode must be 'merge' or 'replace', found '%s'", restoreMode)
+		}
+
+		data, err := ioutil.ReadFile(restorePath)
+		if err != nil {
+			return err
+		}
+
+		pass, err := readLine(reader, "Backup passphrase: ")
+		if err != nil {
+			return err
+		}
+
+		report, err := RestoreWallet(wal, data, pass, replace)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Wallet restored from %s: %d keys and %d addresses added\n", restorePath, report.KeysAdded, report.AddressesAdded)
+		for _, c := range report.Conflicts {
+			fmt.Printf("  Conflict %s: current '%s', backup '%s'. %s\n", c.Address, c.Current, c.Backup, c.Resolution)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/FactomProject/enterprise-wallet/fct"
+	"github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+// runBatchCommand handles the -batch flag. It constructs the payouts in a CSV, prints them,
+// and sends them all once confirmed on stdin. The wallet must already be initiated.
+func runBatchCommand(csvPath string, coinSelection string) error {
+	reader := bufio.NewReader(os.Stdin)
+
+	wal, release := Wallets.Acquire()
+	defer release()
+	if wal == nil {
+		return ErrNoWallet
+	}
+
+	f, err := os.Open(csvPath)
+	if err != nil {
+		return err
+	}
+	payouts, err := wallet.ParsePayoutCSV(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	if wal.IsLocked() {
+		pass, err := readLine(reader, "Wallet passphrase: ")
+		if err != nil {
+			return err
+		}
+		err = wal.Unlock(pass)
+		if err != nil {
+			return err
+		}
+	}
+
+	if coinSelection == "" {
+		coinSelection = MasterSettings.CoinSelection
+	}
+	b, err := wal.ConstructBatch(payouts, coinSelection)
+	if err != nil {
+		return err
+	}
+
+	printBatch(b)
+	answer, err := readLine(reader, fmt.Sprintf("Send %d transactions? (yes/no): ", len(b.Transactions)))
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(strings.TrimSpace(answer), "yes") {
+		wal.DeleteBatch(b.ID)
+		fmt.Println("Nothing sent")
+		return nil
+	}
+
+	b, err = wal.SendBatch(b.ID)
+	if b == nil {
+		return err
+	}
+	for i, t := range b.Transactions {
+		switch {
+		case t.TxID != "":
+			fmt.Printf("Transaction %d sent: %s\n", i+1, t.TxID)
+		case t.Error != "":
+			fmt.Printf("Transaction %d failed: %s\n", i+1, t.Error)
+		default:
+			fmt.Printf("Transaction %d not sent, it is kept as draft %s\n", i+1, t.DraftID)
+		}
+	}
+	return err
+}
+
+func printBatch(b *wallet.Batch) {
+	for i, t := range b.Transactions {
+		fmt.Printf("Transaction %d: %d payouts, %s FCT, fee %s FCT\n", i+1, len(t.Payouts), fct.Amount(t.Total), fct.Amount(t.Fee))
+		for _, p := range t.Payouts {
+			amount := fct.Amount(p.Amount).String() + " FCT"
+			if p.Address[:2] == "EC" {
+				amount = strconv.FormatUint(p.Amount, 10) + " EC"
+			}
+			fmt.Printf("  %s %s %s\n", p.Address, amount, p.Memo)
+		}
+	}
+	fmt.Printf("Total %s FCT, fees %s FCT\n", fct.Amount(b.Total), fct.Amount(b.Fee))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+// runCheckCommand handles the -check flag. The wallet must not be running, the
+// databases are opened directly. If no profile is given, the active one is checked.
+func runCheckCommand(guiDBStr string, walDBStr string, txDBStr string, profile string, repair bool) error {
+	wallet.GUI_DB = guiDBStr
+	wallet.WALLET_DB = walDBStr
+	wallet.TX_DB = txDBStr
+
+	var p *wallet.Profile
+	var err error
+	if profile == "" {
+		p, err = wallet.ActiveProfile()
+	} else {
+		p, err = wallet.GetProfile(profile)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Checking the databases of the wallet '%s' in %s\n", p.Name, p.Dir())
+
+	reader := bufio.NewReader(os.Stdin)
+	report, err := wallet.CheckDatabases(p, repair, func() (string, error) {
+		return readLine(reader, "Wallet passphrase: ")
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, n := range report.Notes {
+		fmt.Println(n)
+	}
+
+	if len(report.Problems) == 0 {
+		fmt.Println("No problems found")
+		return nil
+	}
+
+	fmt.Printf("%d problems found:\n", len(report.Problems))
+	repairable := 0
+	for _, p := range report.Problems {
+		if p.Address != "" {
+			fmt.Printf("  [%s] %s: %s\n", p.Database, p.Address, p.Problem)
+		} else {
+			fmt.Printf("  [%s] %s\n", p.Database, p.Problem)
+		}
+
+		switch {
+		case p.Repaired:
+			fmt.Printf("      Repaired: %s\n", p.Repair)
+		case p.Repair != "" && !repair:
+			fmt.Printf("      Repair would: %s\n", p.Repair)
+			repairable++
+		}
+	}
+
+	if repairable > 0 {
+		fmt.Printf("%d of them can be repaired by running again with -repair\n", repairable)
+	}
+	if left := report.Unrepaired(); left > 0 {
+		return fmt.Errorf("%d problems left", left)
+	}
+	return nil
+}
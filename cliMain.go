@@ -8,10 +8,15 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
+
+	"github.com/FactomProject/enterprise-wallet/wallet"
+	"github.com/FactomProject/enterprise-wallet/wallet/database"
 )
 
 var (
@@ -21,18 +26,32 @@ var (
 func main() {
 	// configure the server
 	var (
-		guiDB           = flag.String("guiDB", "Bolt", "GUI Database: Bolt, LDB, or Map")
-		walDB           = flag.String("walDB", "Bolt", "Wallet Database: Bolt, LDB, or Map")
-		txDB            = flag.String("txDB", "Bolt", "Transaction Database: Bolt, LDB, or Map")
+		guiDB           = flag.String("guiDB", "Bolt", "GUI Database: "+strings.Join(database.BackendNames(), ", "))
+		walDB           = flag.String("walDB", "Bolt", "Wallet Database: "+strings.Join(database.BackendNames(), ", "))
+		txDB            = flag.String("txDB", "Bolt", "Transaction Database: "+strings.Join(database.BackendNames(), ", "))
+		dataDir         = flag.String("datadir", wallet.DATA_DIR, "Directory the databases are kept in")
+		walletName      = flag.String("wallet", "", "Name of the wallet to open. Default is the wallet last switched to")
 		port            = flag.Int("port", 8091, "The port for the GUIWallet")
 		compiled        = flag.Bool("compiled", true, "Decides wheter to use the compiled statics or not. Useful for modifying")
 		randomAdds      = flag.Bool("randadd", true, "Overrides ADD_RANDOM_ADDRESSES if false and does not add random addresses")
 		v1Import        = flag.Bool("i", true, "Search for M1 wallet, if there is no M2 wallet file")
 		v1Path          = flag.String("v1path", "/.factom/factoid_wallet_bolt.db", "Change the path for V1 import")
 		factomdLocation = flag.String("factomdlocation", "", "Change the location of factomd. Default comes from the config file")
+		backupPath      = flag.String("backup", "", "Write an encrypted backup of the wallet to this file and exit. The passphrase is read from stdin")
+		restorePath     = flag.String("restore", "", "Restore an encrypted backup from this file and exit. The passphrase is read from stdin")
+		restoreMode     = flag.String("restoremode", "merge", "How to restore a backup: merge into the current wallet, or replace it")
+		snapshots       = flag.Int("snapshots", 24, "How many snapshots of the databases to keep. 0 disables automatic snapshots")
+		snapInterval    = flag.Int64("snapshotinterval", 60, "Minutes between periodic snapshots. 0 only takes them on launch and before removing data")
+		useSnapshot     = flag.Bool("usesnapshot", false, "If a database fails to open, recover it from the newest good snapshot without asking")
+		check           = flag.Bool("check", false, "Check the databases for problems, print a report and exit. The wallet must not be running")
+		repair          = flag.Bool("repair", false, "With -check, repair the problems found. A snapshot is taken first")
+		batchPath       = flag.String("batch", "", "Construct the payouts in this CSV, and send them once confirmed on stdin, then exit")
+		batchCoins      = flag.String("batchcoins", "", "Coin selection for -batch: "+strings.Join(wallet.CoinSelectorNames(), ", ")+". Default comes from the settings")
+		offline         = flag.Bool("offline", false, "Never connect to factomd, for a wallet that signs transactions on a machine with no network")
 
-		min   = flag.Bool("min", false, "Temporary flag, for testing")
-		balup = flag.Int64("balup", 10000, "Changes how often the balances of addresses are updated in the cache. Value is in MillSeconds")
+		min         = flag.Bool("min", false, "Temporary flag, for testing")
+		balup       = flag.Int64("balup", 10000, "Changes how often the balances of addresses are updated in the cache. Value is in MillSeconds")
+		lockTimeout = flag.Int64("locktimeout", 10, "Minutes of inactivity before an encrypted wallet locks itself. 0 disables the timeout")
 	)
 	flag.Parse()
 	c := make(chan os.Signal, 2)
@@ -51,7 +70,14 @@ func main() {
 		BALANCE_UPDATE_INTERVAL = time.Duration(*balup) * time.Millisecond
 	}
 
-	if *walDB == "Map" {
+	wallet.DATA_DIR = *dataDir
+	wallet.WALLET_LOCK_TIMEOUT = time.Duration(*lockTimeout) * time.Minute
+	wallet.SNAPSHOT_RETENTION = *snapshots
+	wallet.SNAPSHOT_INTERVAL = time.Duration(*snapInterval) * time.Minute
+	USE_SNAPSHOT = *useSnapshot
+	wallet.OFFLINE = *offline
+
+	if strings.EqualFold(*walDB, wallet.MAP) {
 		if *randomAdds {
 			ADD_RANDOM_ADDRESSES = true
 		} else {
@@ -63,5 +89,36 @@ func main() {
 		FILES_PATH += "min-"
 	}
 
-	InitiateWalletAndWeb(*guiDB, *walDB, *txDB, *port, *v1Import, *v1Path, *factomdLocation)
+	if *check {
+		err := runCheckCommand(*guiDB, *walDB, *txDB, *walletName, *repair)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *backupPath != "" || *restorePath != "" {
+		InitiateWallet(*guiDB, *walDB, *txDB, *walletName, *v1Import, *v1Path, *factomdLocation)
+		err := runBackupCommand(*backupPath, *restorePath, *restoreMode)
+		close()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *batchPath != "" {
+		InitiateWallet(*guiDB, *walDB, *txDB, *walletName, *v1Import, *v1Path, *factomdLocation)
+		err := runBatchCommand(*batchPath, *batchCoins)
+		close()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	InitiateWalletAndWeb(*guiDB, *walDB, *txDB, *walletName, *port, *v1Import, *v1Path, *factomdLocation)
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,6 +11,8 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/FactomProject/enterprise-wallet/fct"
+	"github.com/FactomProject/enterprise-wallet/wallet"
 	"github.com/FactomProject/enterprise-wallet/web/files"
 )
 
@@ -29,8 +32,9 @@ var (
 // option for front end design changes
 var COMPILED_STATICS = true
 
-func SaveSettings() error {
-	err := MasterWallet.GUIlDB.Put([]byte("gui-wallet"), []byte("settings"), MasterSettings)
+// SaveSettings saves the MasterSettings in the GUI database of a wallet
+func SaveSettings(wal *wallet.WalletDB) error {
+	err := wal.GUIlDB.Put([]byte("gui-wallet"), []byte("settings"), MasterSettings)
 	return err
 }
 
@@ -60,7 +64,13 @@ func ServeWallet(port int) {
 	go doEvery(BALANCE_UPDATE_INTERVAL, updateBalances)
 
 	// Load the initial transaction DB. This takes some time, should start before user hits first page
-	go MasterWallet.GetRelatedTransactions()
+	go func() {
+		wal, release := Wallets.Acquire()
+		defer release()
+		if wal != nil {
+			wal.GetRelatedTransactions()
+		}
+	}()
 
 	// Mux for static files
 	mux = http.NewServeMux()
@@ -109,9 +119,18 @@ func static(h http.HandlerFunc) http.HandlerFunc {
 // updateBalances updates various elements. Faster load times for user if these
 // are loaded when they are not asking
 func updateBalances(time.Time) {
-	MasterWallet.AddBalancesToAddresses()
-	MasterWallet.UpdateGUIDB()
-	MasterWallet.GetRelatedTransactions()
+	if wallet.OFFLINE {
+		return
+	}
+	wal, release := Wallets.Acquire()
+	defer release()
+	if wal == nil {
+		return
+	}
+
+	wal.AddBalancesToAddresses()
+	wal.UpdateGUIDB()
+	wal.GetRelatedTransactions()
 }
 
 // doEvery
@@ -207,9 +226,30 @@ func HandleGETRequests(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	req := r.FormValue("request")
+
+	// Does not need a wallet open
+	if req == "list-wallets" {
+		list, err := ListWallets()
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp(list))
+		return
+	}
+
+	wal, release := Wallets.Acquire()
+	defer release()
+	if wal == nil {
+		w.Write(jsonError(ErrNoWallet.Error()))
+		return
+	}
+
 	switch req {
 	case "on":
 		w.Write(jsonResp(true))
+	case "offline":
+		w.Write(jsonResp(wallet.OFFLINE))
 	case "synced":
 		type SyncedStruct struct {
 			Synced       bool
@@ -220,15 +260,15 @@ func HandleGETRequests(w http.ResponseWriter, r *http.Request) {
 		}
 		s := new(SyncedStruct)
 
-		lh, eh, fh := MasterSettings.Refresh()
+		lh, eh, fh := MasterSettings.Refresh(wal)
 		s.Synced = MasterSettings.Synced
 		s.LeaderHeight = lh
 		s.EntryHeight = eh
 		s.FblockHeight = fh
-		s.Stage = MasterWallet.GetStage()
+		s.Stage = wal.GetStage()
 		w.Write(jsonResp(s))
 	case "addresses-no-bal":
-		data, err := MasterWallet.GetGUIWalletJSON(false)
+		data, err := wal.GetGUIWalletJSON(false)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 			return
@@ -236,7 +276,7 @@ func HandleGETRequests(w http.ResponseWriter, r *http.Request) {
 
 		w.Write(data)
 	case "addresses":
-		data, err := MasterWallet.GetGUIWalletJSON(true)
+		data, err := wal.GetGUIWalletJSON(true)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 			return
@@ -247,7 +287,7 @@ func HandleGETRequests(w http.ResponseWriter, r *http.Request) {
 		bals := struct {
 			EC int64
 			FC int64
-		}{MasterWallet.GetECBalance(), MasterWallet.GetFactoidBalance()}
+		}{wal.GetECBalance(), wal.GetFactoidBalance()}
 		data := jsonResp(bals)
 		if data != nil {
 			w.Write(data)
@@ -255,27 +295,77 @@ func HandleGETRequests(w http.ResponseWriter, r *http.Request) {
 		}
 
 		w.Write(jsonError("Error occurred"))
+	case "lock-status":
+		status := struct {
+			Encrypted bool
+			Locked    bool
+			WatchOnly bool
+		}{wal.IsEncrypted(), wal.IsLocked(), wal.IsWatchOnly()}
+		w.Write(jsonResp(status))
+	case "watch-only-export":
+		e, err := wal.GetWatchOnlyExport()
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp(e))
+	case "list-drafts":
+		w.Write(jsonResp(wal.ListDrafts()))
+	case "transaction-status":
+		// One transaction if a txid is given, otherwise all the wallet tracks
+		txid := r.FormValue("txid")
+		if txid == "" {
+			list, err := wal.ListBroadcasts()
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			w.Write(jsonResp(list))
+			return
+		}
+
+		b, err := wal.GetBroadcast(txid)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp(b))
+	case "list-schedules":
+		list, err := wal.ListScheduledPayments()
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp(list))
+	case "list-snapshots":
+		list, err := wal.ListSnapshots()
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp(list))
 	case "related-transactions":
-		if on, server := MasterWallet.FactomdOnline(); !on {
+		if on, server := wal.FactomdOnline(); !on {
 			errorMsg := fmt.Sprintf("Unable to connect to factomd instance. The wallet is at '%s' for it's factomd instance. If this is set locally "+
 				"you must download the latest factomd and run it until it is synced", server)
 			w.Write(jsonError(errorMsg))
 			return
 		}
 
-		trans, err := MasterWallet.GetRelatedTransactions()
+		trans, err := wal.GetRelatedTransactions()
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 			return
 		} else {
-			MasterWallet.ActiveCachedTransactions = trans
+			trans = wal.AddPendingTransactions(trans)
+			wal.ActiveCachedTransactions = trans
 			if len(trans) > 100 {
 				next := trans[:100]
-				next = MasterWallet.ScrubDisplayTransactionsForNameChanges(next)
+				next = wal.ScrubDisplayTransactionsForNameChanges(next)
 				w.Write(jsonResp(next))
 			} else {
 				next := trans
-				next = MasterWallet.ScrubDisplayTransactionsForNameChanges(next)
+				next = wal.ScrubDisplayTransactionsForNameChanges(next)
 				w.Write(jsonResp(next))
 			}
 		}
@@ -294,7 +384,63 @@ type SendTransStruct struct {
 	FromAmounts   []string `json:"InputAmounts"`
 	FeeAddress    string   `json:"FeeAddress"`
 
+	// CoinSelection chooses the inputs of factoid and ec transactions. The settings
+	// decide if it is empty.
+	CoinSelection string `json:"CoinSelection"`
+
+	// The draft the transaction is in. Empty makes a new draft.
+	DraftID string `json:"DraftID"`
+	Label   string `json:"Label"`
+
+	// Secret is the private key to sweep, for addresses not in the wallet
+	Secret string `json:"Secret"`
+
 	Signature bool `json:"Signature, omitempty"`
+
+	// Inputs of an imported transaction, and which are signed
+	Inputs []wallet.InputSignature `json:"Inputs,omitempty"`
+}
+
+// PassphraseStruct is used to unlock or encrypt the wallet
+type PassphraseStruct struct {
+	Passphrase string `json:"Passphrase"`
+}
+
+// DraftStruct names a draft in the draft requests
+type DraftStruct struct {
+	ID    string `json:"ID"`
+	Label string `json:"Label"`
+}
+
+// BatchStruct is a batch of payouts. CSV is only read by make-batch, the other batch
+// requests name the batch by ID.
+type BatchStruct struct {
+	ID            string `json:"ID"`
+	CSV           string `json:"CSV"`
+	CoinSelection string `json:"CoinSelection"`
+}
+
+// ScheduleStruct is a scheduled payment in the schedule requests. Interval is a duration
+// such as "24h", used when there is no cron expression. Start and End are Unix times.
+type ScheduleStruct struct {
+	ID            string   `json:"ID"`
+	Label         string   `json:"Label"`
+	ToAddresses   []string `json:"OutputAddresses"`
+	ToAmounts     []string `json:"OutputAmounts"`
+	FromAddresses []string `json:"InputAddresses"`
+	CoinSelection string   `json:"CoinSelection"`
+	Interval      string   `json:"Interval"`
+	Cron          string   `json:"Cron"`
+	Start         int64    `json:"Start"`
+	End           int64    `json:"End"`
+	Paused        bool     `json:"Paused"`
+}
+
+// BroadcastStruct names a sent transaction in the rebroadcast and cancel requests.
+// Address is where a cancel sends the inputs.
+type BroadcastStruct struct {
+	TxID    string `json:"TxID"`
+	Address string `json:"Address"`
 }
 
 type ReturnTransStruct struct {
@@ -315,6 +461,71 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 	//	json	-- json object
 
 	req := r.FormValue("request")
+
+	// Switching waits for the requests using the active wallet to finish, and fails if
+	// they take too long, so these are handled before the wallet is acquired
+	switch req {
+	case "switch-wallet":
+		type SwitchStruct struct {
+			Name string `json:"Name"`
+		}
+
+		ss := new(SwitchStruct)
+
+		jsonElement := r.FormValue("json")
+		err := json.Unmarshal([]byte(jsonElement), ss)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
+		err = Wallets.Switch(ss.Name)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp(ss.Name))
+		return
+	case "create-wallet":
+		type CreateStruct struct {
+			Name      string `json:"Name"`
+			SharedTX  bool   `json:"SharedTX"`  // Share the transaction database of the default wallet
+			WatchOnly bool   `json:"WatchOnly"` // Holds public keys only
+		}
+
+		cs := new(CreateStruct)
+
+		jsonElement := r.FormValue("json")
+		err := json.Unmarshal([]byte(jsonElement), cs)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
+		var p *wallet.Profile
+		if cs.WatchOnly {
+			p, err = wallet.CreateWatchOnlyProfile(cs.Name, cs.SharedTX)
+		} else {
+			p, err = wallet.CreateProfile(cs.Name, cs.SharedTX)
+		}
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp(p))
+		return
+	}
+
+	wal, release := Wallets.Acquire()
+	defer release()
+	if wal == nil {
+		w.Write(jsonError(ErrNoWallet.Error()))
+		return
+	}
+
+	// Any activity keeps an unlocked wallet from locking itself
+	wal.ResetLockTimer()
+
 	switch req {
 	case "address-name-change":
 		type ANC struct {
@@ -328,13 +539,73 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 			w.Write(jsonError(err.Error()))
 			return
 		}
-		err = MasterWallet.ChangeAddressName(anc.Address, anc.ToName)
+		err = wal.ChangeAddressName(anc.Address, anc.ToName)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 			return
 		} else {
 			w.Write(jsonResp("Success"))
 		}
+	case "freeze-address":
+		type Freeze struct {
+			Address string `json:"Address"`
+			Frozen  bool   `json:"Frozen"`
+		}
+		f := new(Freeze)
+		err := json.Unmarshal([]byte(r.FormValue("json")), f)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		err = wal.FreezeAddress(f.Address, f.Frozen)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp("Success"))
+	case "reserve-address":
+		type Reserve struct {
+			Address string `json:"Address"`
+			Purpose string `json:"Purpose"` // Empty releases the address
+		}
+		res := new(Reserve)
+		err := json.Unmarshal([]byte(r.FormValue("json")), res)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		err = wal.ReserveAddress(res.Address, res.Purpose)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp("Success"))
+	case "set-minimum-balance":
+		type MinBalance struct {
+			Address    string `json:"Address"`
+			MinBalance string `json:"MinBalance"` // In factoids, empty or 0 removes it
+		}
+		mb := new(MinBalance)
+		err := json.Unmarshal([]byte(r.FormValue("json")), mb)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		var min uint64
+		if mb.MinBalance != "" {
+			amts, err := wallet.StringAmountsToUin64Amounts([]string{mb.Address}, []string{mb.MinBalance})
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			min = amts[0]
+		}
+		err = wal.SetAddressMinBalance(mb.Address, min)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp("Success"))
 	case "delete-address":
 		type ANC struct {
 			Address string `json:"Address"`
@@ -348,13 +619,13 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		_, list := MasterWallet.GetGUIAddress(anc.Address)
+		_, list := wal.GetGUIAddress(anc.Address)
 		if list != 3 {
 			w.Write(jsonError("You can only delete External Addresses."))
 			return
 		}
 
-		_, err = MasterWallet.RemoveAddress(anc.Address, list)
+		_, err = wal.RemoveAddress(anc.Address, list)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 			return
@@ -379,13 +650,13 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		_, list := MasterWallet.GetGUIAddress(a.Address)
+		_, list := wal.GetGUIAddress(a.Address)
 		if list == -1 {
 			w.Write(jsonError("Not found"))
 			return
 		}
 
-		secret, err := MasterWallet.GetPrivateKey(a.Address)
+		secret, err := wal.GetPrivateKey(a.Address)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 			return
@@ -405,7 +676,7 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		anp, list := MasterWallet.GetGUIAddress(a.Address)
+		anp, list := wal.GetGUIAddress(a.Address)
 		if list == -1 {
 			w.Write(jsonError("Not found"))
 			return
@@ -414,7 +685,7 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 		w.Write(jsonResp(anp))
 	case "is-valid-address":
 		add := r.FormValue("json")
-		v := MasterWallet.IsValidAddress(add)
+		v := wal.IsValidAddress(add)
 		if v {
 			w.Write(jsonResp("true"))
 		} else {
@@ -422,7 +693,7 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 		}
 	case "generate-new-address-factoid":
 		name := r.FormValue("json")
-		anp, err := MasterWallet.GenerateFactoidAddress(name)
+		anp, err := wal.GenerateFactoidAddress(name)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 		} else {
@@ -430,7 +701,7 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 		}
 	case "generate-new-address-ec":
 		name := r.FormValue("json")
-		anp, err := MasterWallet.GenerateEntryCreditAddress(name)
+		anp, err := wal.GenerateEntryCreditAddress(name)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 		} else {
@@ -451,7 +722,7 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		anp, err := MasterWallet.AddAddress(nas.Name, nas.Secret)
+		anp, err := wal.AddAddress(nas.Name, nas.Secret)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 		} else {
@@ -472,7 +743,7 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		anp, err := MasterWallet.ImportKoinify(nas.Name, nas.Koinify)
+		anp, err := wal.ImportKoinify(nas.Name, nas.Koinify)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 		} else {
@@ -493,12 +764,61 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		anp, err := MasterWallet.AddExternalAddress(nas.Name, nas.Public)
+		anp, err := wal.AddExternalAddress(nas.Name, nas.Public)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 		} else {
 			w.Write(jsonResp(anp))
 		}
+	case "import-public-key":
+		type PublicKeyStruct struct {
+			Name      string `json:"Name"`
+			PublicKey string `json:"PublicKey"`
+			List      int    `json:"List"`
+		}
+
+		pks := new(PublicKeyStruct)
+
+		jsonElement := r.FormValue("json")
+		err := json.Unmarshal([]byte(jsonElement), pks)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
+		anp, err := wal.ImportPublicKey(pks.Name, pks.PublicKey, pks.List)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+		} else {
+			w.Write(jsonResp(anp))
+		}
+	case "import-public-keys":
+		type PublicKeysStruct struct {
+			Keys []wallet.PublicKey `json:"Keys"`
+		}
+
+		pks := new(PublicKeysStruct)
+
+		jsonElement := r.FormValue("json")
+		err := json.Unmarshal([]byte(jsonElement), pks)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
+		added, err := wal.ImportPublicKeys(pks.Keys)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+		} else {
+			w.Write(jsonResp(added))
+		}
+	case "export-public-keys":
+		keys, err := wal.ExportPublicKeys()
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+		} else {
+			w.Write(jsonResp(keys))
+		}
 	case "get-needed-input":
 		trans := new(SendTransStruct)
 
@@ -509,7 +829,7 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		needed, err := MasterWallet.CalculateNeededInput(trans.ToAddresses, trans.ToAmounts)
+		needed, err := wal.CalculateNeededInput(trans.ToAddresses, trans.ToAmounts)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 			return
@@ -519,62 +839,176 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 	case "import-transaction":
 		// new(SendTransStruct)
 		transHex := r.FormValue("json")
-		MasterWallet.Wallet.DeleteTransaction("importedTX")
-		err := MasterWallet.ImportTransaction("importedTX", transHex)
+		d, err := wal.ImportDraft("Imported", transHex)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 			return
 		}
 
-		trans := MasterWallet.Wallet.GetTransactions()["importedTX"]
+		trans := wal.Wallet.GetTransactions()[d.ID]
 		if trans == nil {
 			w.Write(jsonError("Transaction had an error importing."))
 			return
 		}
 
 		transRet := new(SendTransStruct)
+		transRet.DraftID = d.ID
+		transRet.Label = d.Label
 		inputs := trans.GetInputs()
 		for _, in := range inputs {
-			transRet.FromAddresses = append(transRet.FromAddresses, MasterWallet.FactoidAddressToHumanReadable(in.GetAddress()))
-			transRet.FromAmounts = append(transRet.FromAmounts, fmt.Sprintf("%f", float64(in.GetAmount())/1e8))
+			transRet.FromAddresses = append(transRet.FromAddresses, wal.FactoidAddressToHumanReadable(in.GetAddress()))
+			transRet.FromAmounts = append(transRet.FromAmounts, fct.Amount(in.GetAmount()).String())
 		}
 
 		outputs := trans.GetOutputs()
 		for _, out := range outputs {
-			transRet.ToAddresses = append(transRet.ToAddresses, MasterWallet.FactoidAddressToHumanReadable(out.GetAddress()))
-			transRet.ToAmounts = append(transRet.ToAmounts, fmt.Sprintf("%f", float64(out.GetAmount())/1e8))
+			transRet.ToAddresses = append(transRet.ToAddresses, wal.FactoidAddressToHumanReadable(out.GetAddress()))
+			transRet.ToAmounts = append(transRet.ToAmounts, fct.Amount(out.GetAmount()).String())
 		}
 
 		ecouts := trans.GetECOutputs()
 		for _, out := range ecouts {
-			transRet.ToAddresses = append(transRet.ToAddresses, MasterWallet.ECAddressToHumanReadable(out.GetAddress()))
+			transRet.ToAddresses = append(transRet.ToAddresses, wal.ECAddressToHumanReadable(out.GetAddress()))
 			transRet.ToAmounts = append(transRet.ToAmounts, fmt.Sprintf("%d", out.GetAmount()))
 		}
 
-		err = trans.ValidateSignatures()
+		err = wal.ValidateSignatures(d.ID)
 		if err == nil {
 			transRet.Signature = true
 		} else {
 			transRet.Signature = false
 		}
 
+		transRet.Inputs, err = wal.GetInputSignatures(d.ID)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
 		w.Write(jsonResp(transRet))
 	case "broadcast-transaction":
-		err := MasterWallet.Wallet.SignTransaction("importedTX", true)
+		d := new(DraftStruct)
+		err := json.Unmarshal([]byte(r.FormValue("json")), d)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 			return
 		}
+		if !wal.IsDraft(d.ID) {
+			w.Write(jsonError(wallet.ErrDraftNotFound.Error()))
+			return
+		}
+
+		// Other wallets may have signed some of the inputs
+		if wal.ValidateSignatures(d.ID) != nil {
+			_, err = wal.SignInputs(d.ID)
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			err = wal.ValidateSignatures(d.ID)
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+		}
 
-		txid, err := MasterWallet.SendTransaction("importedTX")
+		txid, err := wal.SendTransaction(d.ID)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 			return
 		}
 
 		w.Write(jsonResp(txid))
+	case "export-offline-transaction":
+		d := new(DraftStruct)
+		err := json.Unmarshal([]byte(r.FormValue("json")), d)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
+		o, err := wal.ExportOfflineTransaction(d.ID)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		data, err := wallet.EncodeOfflineTransaction(o)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
+		type OfflineStruct struct {
+			Json   string
+			Chunks []string
+		}
+		w.Write(jsonResp(OfflineStruct{data, wallet.SplitOfflineChunks(data)}))
+	case "import-offline-transaction":
+		// Either the exported text, or its chunks
+		type OfflineStruct struct {
+			Data   string   `json:"Data"`
+			Chunks []string `json:"Chunks"`
+		}
+		in := new(OfflineStruct)
+		err := json.Unmarshal([]byte(r.FormValue("json")), in)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
+		o, err := wallet.DecodeOfflineTransaction(in.Data, in.Chunks)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		review, err := wal.ImportOfflineTransaction(o)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp(review))
+	case "sign-inputs", "input-signatures":
+		d := new(DraftStruct)
+		err := json.Unmarshal([]byte(r.FormValue("json")), d)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
+		type SignaturesStruct struct {
+			Signed   int
+			Inputs   []wallet.InputSignature
+			Complete bool
+			Json     string
+		}
+		s := new(SignaturesStruct)
+		if req == "sign-inputs" {
+			s.Signed, err = wal.SignInputs(d.ID)
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+		}
+
+		s.Inputs, err = wal.GetInputSignatures(d.ID)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		s.Complete = wal.ValidateSignatures(d.ID) == nil
+		s.Json, err = wal.ExportTransaction(d.ID)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp(s))
 
 	case "make-transaction":
+		if wal.IsLocked() {
+			w.Write(jsonError(wallet.ErrWalletLocked.Error()))
+			return
+		}
+
 		trans := new(SendTransStruct)
 
 		jsonElement := r.FormValue("json")
@@ -586,67 +1020,287 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 
 		var r ReturnTransStruct
 
-		name := ""
-		if trans.TransType == "factoid" {
-			newName, rt, err := MasterWallet.ConstructSendFactoidsStrings(trans.ToAddresses, trans.ToAmounts)
+		if trans.CoinSelection == "" {
+			trans.CoinSelection = MasterSettings.CoinSelection
+		}
+
+		var name string
+		var rt *wallet.ReturnTransStruct
+		switch trans.TransType {
+		case "factoid":
+			name, rt, err = wal.ConstructSendFactoidsStrings(trans.DraftID, trans.ToAddresses, trans.ToAmounts, trans.CoinSelection)
+		case "ec":
+			name, rt, err = wal.ConstructConvertEntryCreditsStrings(trans.DraftID, trans.ToAddresses, trans.ToAmounts, trans.CoinSelection)
+		case "custom":
+			name, rt, err = wal.ConstructTransactionFromValuesStrings(trans.DraftID,
+				trans.ToAddresses, trans.ToAmounts, trans.FromAddresses, trans.FromAmounts, trans.FeeAddress, true)
+		case "nosig":
+			name, rt, err = wal.ConstructTransactionFromValuesStrings(trans.DraftID,
+				trans.ToAddresses, trans.ToAmounts, trans.FromAddresses, trans.FromAmounts, trans.FeeAddress, false)
+		case "sweep":
+			if len(trans.ToAddresses) != 1 {
+				w.Write(jsonError("A sweep needs one output address"))
+				return
+			}
+			if trans.Secret != "" {
+				name, rt, err = wal.ConstructSweepFromKey(trans.DraftID, trans.Secret, trans.ToAddresses[0])
+			} else {
+				name, rt, err = wal.ConstructSweepTransaction(trans.DraftID, trans.FromAddresses, trans.ToAddresses[0])
+			}
+		default:
+			w.Write(jsonError("Not a valid type"))
+			return
+		}
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		r.Total = rt.Total
+		r.Fee = rt.Fee
+
+		if trans.Label != "" {
+			err = wal.UpdateDraft(name, trans.Label)
 			if err != nil {
-				MasterWallet.DeleteTransaction(name)
 				w.Write(jsonError(err.Error()))
 				return
 			}
+		}
+
+		j, err := wal.ExportTransaction(name)
+		if err != nil {
+			r.Json = "Error exporting transaction."
+		} else {
+			r.Json = j
+		}
+
+		r.Name = name
+		w.Write(jsonResp(r))
+	case "estimate-transaction":
+		trans := new(SendTransStruct)
+		err := json.Unmarshal([]byte(r.FormValue("json")), trans)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		if trans.Secret != "" {
+			w.Write(jsonError("Sweeps from a private key cannot be estimated"))
+			return
+		}
 
-			name = newName
-			r.Total = rt.Total
-			r.Fee = rt.Fee
-		} else if trans.TransType == "ec" {
-			newName, rt, err := MasterWallet.ConstructConvertEntryCreditsStrings(trans.ToAddresses, trans.ToAmounts)
+		e := wallet.EstimateRequest{
+			TransType:     trans.TransType,
+			ToAddresses:   trans.ToAddresses,
+			FromAddresses: trans.FromAddresses,
+			FeeAddress:    trans.FeeAddress,
+			CoinSelection: trans.CoinSelection,
+		}
+		if e.CoinSelection == "" {
+			e.CoinSelection = MasterSettings.CoinSelection
+		}
+		if trans.TransType != "sweep" {
+			e.ToAmounts, err = wallet.StringAmountsToUin64Amounts(trans.ToAddresses, trans.ToAmounts)
 			if err != nil {
-				MasterWallet.DeleteTransaction(name)
 				w.Write(jsonError(err.Error()))
 				return
 			}
-
-			name = newName
-			r.Total = rt.Total
-			r.Fee = rt.Fee
-		} else if trans.TransType == "custom" {
-			newName, rt, err := MasterWallet.ConstructTransactionFromValuesStrings(
-				trans.ToAddresses, trans.ToAmounts, trans.FromAddresses, trans.FromAmounts, trans.FeeAddress, true)
+			e.FromAmounts, err = wallet.StringAmountsToUin64Amounts(trans.FromAddresses, trans.FromAmounts)
 			if err != nil {
-				MasterWallet.DeleteTransaction(name)
 				w.Write(jsonError(err.Error()))
 				return
 			}
+		} else {
+			e.ToAmounts = make([]uint64, len(trans.ToAddresses))
+		}
 
-			name = newName
-			r.Total = rt.Total
-			r.Fee = rt.Fee
-		} else if trans.TransType == "nosig" {
-			newName, rt, err := MasterWallet.ConstructTransactionFromValuesStrings(
-				trans.ToAddresses, trans.ToAmounts, trans.FromAddresses, trans.FromAmounts, trans.FeeAddress, false)
+		estimate, err := wal.EstimateTransaction(e)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp(estimate))
+	case "get-draft", "delete-draft", "update-draft", "duplicate-draft":
+		d := new(DraftStruct)
+		err := json.Unmarshal([]byte(r.FormValue("json")), d)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
+		switch req {
+		case "get-draft":
+			info, err := wal.GetDraft(d.ID)
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			w.Write(jsonResp(info))
+		case "delete-draft":
+			err = wal.DeleteDraft(d.ID)
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			w.Write(jsonResp("Draft deleted"))
+		case "update-draft":
+			err = wal.UpdateDraft(d.ID, d.Label)
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			w.Write(jsonResp("Draft updated"))
+		case "duplicate-draft":
+			c, err := wal.DuplicateDraft(d.ID, d.Label)
 			if err != nil {
-				MasterWallet.DeleteTransaction(name)
 				w.Write(jsonError(err.Error()))
 				return
 			}
+			w.Write(jsonResp(c))
+		}
+	case "make-batch", "get-batch", "send-batch", "delete-batch":
+		b := new(BatchStruct)
+		err := json.Unmarshal([]byte(r.FormValue("json")), b)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
 
-			name = newName
-			r.Total = rt.Total
-			r.Fee = rt.Fee
-		} else {
-			w.Write(jsonError("Not a valid type"))
+		switch req {
+		case "make-batch":
+			payouts, err := wallet.ParsePayoutCSV(strings.NewReader(b.CSV))
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			if b.CoinSelection == "" {
+				b.CoinSelection = MasterSettings.CoinSelection
+			}
+			batch, err := wal.ConstructBatch(payouts, b.CoinSelection)
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			w.Write(jsonResp(batch))
+		case "get-batch":
+			batch, err := wal.GetBatch(b.ID)
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			w.Write(jsonResp(batch))
+		case "send-batch":
+			// A batch partly sent is returned, each transaction says if it was sent
+			batch, err := wal.SendBatch(b.ID)
+			if batch == nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			w.Write(jsonResp(batch))
+		case "delete-batch":
+			err = wal.DeleteBatch(b.ID)
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			w.Write(jsonResp("Batch deleted"))
+		}
+	case "create-schedule", "get-schedule", "pause-schedule", "cancel-schedule":
+		sch := new(ScheduleStruct)
+		err := json.Unmarshal([]byte(r.FormValue("json")), sch)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
 			return
 		}
 
-		j, err := MasterWallet.ExportTransaction(name)
+		switch req {
+		case "create-schedule":
+			p := wallet.ScheduledPayment{
+				Label:         sch.Label,
+				ToAddresses:   sch.ToAddresses,
+				FromAddresses: sch.FromAddresses,
+				CoinSelection: sch.CoinSelection,
+				Cron:          sch.Cron,
+				Start:         sch.Start,
+				End:           sch.End,
+			}
+			p.ToAmounts, err = wallet.StringAmountsToUin64Amounts(sch.ToAddresses, sch.ToAmounts)
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			if sch.Interval != "" {
+				d, err := time.ParseDuration(sch.Interval)
+				if err != nil {
+					w.Write(jsonError("Not a valid interval: " + err.Error()))
+					return
+				}
+				p.Interval = int64(d / time.Second)
+			}
+			if p.CoinSelection == "" {
+				p.CoinSelection = MasterSettings.CoinSelection
+			}
+
+			created, err := wal.CreateScheduledPayment(p)
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			w.Write(jsonResp(created))
+		case "get-schedule":
+			p, err := wal.GetScheduledPayment(sch.ID)
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			w.Write(jsonResp(p))
+		case "pause-schedule":
+			err = wal.PauseScheduledPayment(sch.ID, sch.Paused)
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			if sch.Paused {
+				w.Write(jsonResp("Scheduled payment paused"))
+			} else {
+				w.Write(jsonResp("Scheduled payment resumed"))
+			}
+		case "cancel-schedule":
+			err = wal.CancelScheduledPayment(sch.ID)
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			w.Write(jsonResp("Scheduled payment cancelled"))
+		}
+	case "rebroadcast-transaction", "cancel-transaction":
+		bs := new(BroadcastStruct)
+		err := json.Unmarshal([]byte(r.FormValue("json")), bs)
 		if err != nil {
-			r.Json = "Error exporting transaction."
-		} else {
-			r.Json = j
+			w.Write(jsonError(err.Error()))
+			return
 		}
 
-		r.Name = name
-		w.Write(jsonResp(r))
+		switch req {
+		case "rebroadcast-transaction":
+			b, err := wal.RebroadcastTransaction(bs.TxID)
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			w.Write(jsonResp(b))
+		case "cancel-transaction":
+			txid, rt, err := wal.CancelTransaction(bs.TxID, bs.Address)
+			if err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+			resp := struct {
+				TxID    string
+				Total   uint64
+				Fee     uint64
+				Warning string
+			}{txid, rt.Total, rt.Fee, "The cancelled transaction can still get into a block if its inputs hold enough to pay for it as well"}
+			w.Write(jsonResp(resp))
+		}
 	case "send-transaction":
 		trans := new(SendTransStruct)
 
@@ -657,13 +1311,18 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		name, err := MasterWallet.CheckTransactionAndGetName(trans.ToAddresses, trans.ToAmounts, trans.FeeAddress)
+		if trans.DraftID == "" {
+			w.Write(jsonError("No draft given. Make the transaction first."))
+			return
+		}
+
+		err = wal.CheckTransaction(trans.DraftID, trans.ToAddresses, trans.ToAmounts, trans.FeeAddress)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 			return
 		}
 
-		tHash, err := MasterWallet.SendTransaction(name)
+		tHash, err := wal.SendTransaction(trans.DraftID)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 			return
@@ -674,6 +1333,7 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 		type SettingsToggle struct {
 			Bools           []bool `json:"Values"` // A list of the boolean settings
 			FactomdLocation string `json:"FactomdLocation"`
+			CoinSelection   string `json:"CoinSelection"`
 		}
 
 		st := new(SettingsToggle)
@@ -685,6 +1345,15 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if st.CoinSelection != "" {
+			if _, err := wallet.GetCoinSelector(st.CoinSelection); err != nil {
+				w.Write(jsonError(err.Error()))
+				return
+			}
+		}
+
+		wal.SnapshotBefore("settings")
+
 		MasterSettings.DarkTheme = st.Bools[0]
 		if st.Bools[0] {
 			MasterSettings.Theme = "darkTheme"
@@ -694,6 +1363,9 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 		MasterSettings.KeyExport = st.Bools[1]
 		MasterSettings.CoinControl = st.Bools[2]
 		MasterSettings.ImportExport = st.Bools[3]
+		if st.CoinSelection != "" {
+			MasterSettings.CoinSelection = strings.ToLower(st.CoinSelection)
+		}
 
 		fdChange := false
 		if len(st.FactomdLocation) > 0 && st.FactomdLocation != MasterSettings.FactomdLocation {
@@ -702,7 +1374,7 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 			fdChange = true
 		}
 
-		err = SaveSettings()
+		err = SaveSettings(wal)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 			return
@@ -712,8 +1384,112 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 		} else {
 			w.Write(jsonResp("Settings updated"))
 		}
+	case "unlock-wallet":
+		ps := new(PassphraseStruct)
+
+		jsonElement := r.FormValue("json")
+		err := json.Unmarshal([]byte(jsonElement), ps)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
+		err = wal.Unlock(ps.Passphrase)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp("Wallet unlocked"))
+	case "lock-wallet":
+		err := wal.Lock()
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp("Wallet locked"))
+	case "encrypt-wallet":
+		ps := new(PassphraseStruct)
+
+		jsonElement := r.FormValue("json")
+		err := json.Unmarshal([]byte(jsonElement), ps)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
+		err = wal.EncryptWallet(ps.Passphrase)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp("Wallet encrypted"))
+	case "backup-wallet":
+		ps := new(PassphraseStruct)
+
+		jsonElement := r.FormValue("json")
+		err := json.Unmarshal([]byte(jsonElement), ps)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
+		data, err := BackupWallet(wal, ps.Passphrase)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp(base64.StdEncoding.EncodeToString(data)))
+	case "restore-wallet":
+		type RestoreStruct struct {
+			Passphrase string `json:"Passphrase"`
+			Backup     string `json:"Backup"` // Base64 of the backup file
+			Replace    bool   `json:"Replace"`
+		}
+
+		rs := new(RestoreStruct)
+
+		jsonElement := r.FormValue("json")
+		err := json.Unmarshal([]byte(jsonElement), rs)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
+		data, err := base64.StdEncoding.DecodeString(rs.Backup)
+		if err != nil {
+			w.Write(jsonError("Not a valid backup file"))
+			return
+		}
+
+		report, err := RestoreWallet(wal, data, rs.Passphrase, rs.Replace)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp(report))
+	case "restore-snapshot":
+		type SnapshotStruct struct {
+			Name       string `json:"Name"`
+			Passphrase string `json:"Passphrase"` // Of the snapshot if it is encrypted, otherwise of the wallet if it is
+		}
+
+		ss := new(SnapshotStruct)
+
+		jsonElement := r.FormValue("json")
+		err := json.Unmarshal([]byte(jsonElement), ss)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
+		err = RestoreSnapshot(wal, ss.Name, ss.Passphrase)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp("Snapshot restored"))
 	case "get-seed":
-		seed, err := MasterWallet.ExportSeed()
+		seed, err := wal.ExportSeed()
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 			return
@@ -733,7 +1509,7 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		err = MasterWallet.ImportSeed(ss.Seed)
+		err = wal.ImportSeed(ss.Seed)
 		if err != nil {
 			w.Write(jsonError(err.Error()))
 			return
@@ -754,21 +1530,53 @@ func HandlePOSTRequests(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		total := len(MasterWallet.ActiveCachedTransactions)
+		total := len(wal.ActiveCachedTransactions)
 		max := rt.Current + rt.More
 		if max > total {
 			if rt.Current >= total {
 				w.Write(jsonResp(nil))
 				return
 			}
-			next := MasterWallet.ActiveCachedTransactions[rt.Current:]
-			next = MasterWallet.ScrubDisplayTransactionsForNameChanges(next)
+			next := wal.ActiveCachedTransactions[rt.Current:]
+			next = wal.ScrubDisplayTransactionsForNameChanges(next)
 			w.Write(jsonResp(next))
 		} else {
-			next := MasterWallet.ActiveCachedTransactions[rt.Current:max]
-			next = MasterWallet.ScrubDisplayTransactionsForNameChanges(next)
+			next := wal.ActiveCachedTransactions[rt.Current:max]
+			next = wal.ScrubDisplayTransactionsForNameChanges(next)
 			w.Write(jsonResp(next))
 		}
+	case "address-history":
+		q := new(wallet.AddressHistoryQuery)
+
+		jsonElement := r.FormValue("json")
+		err := json.Unmarshal([]byte(jsonElement), q)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
+		h, err := wal.GetAddressHistory(q)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp(h))
+	case "query-transactions":
+		q := new(wallet.TransactionQuery)
+
+		jsonElement := r.FormValue("json")
+		err := json.Unmarshal([]byte(jsonElement), q)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+
+		result, err := wal.QueryTransactions(q)
+		if err != nil {
+			w.Write(jsonError(err.Error()))
+			return
+		}
+		w.Write(jsonResp(result))
 
 	default:
 		w.Write(jsonError("Not a post valid request"))
@@ -76,7 +76,7 @@ func TestDisplayGETandPOST(t *testing.T) {
 	var err error
 	LoadTestWallet(7089)
 
-	MasterWallet = TestWallet
+	Wallets.Set(TestWallet)
 	MasterSettings = new(SettingsStruct)
 	InitTemplate()
 
@@ -379,7 +379,9 @@ func TestSendEntryCreditsTransaction(t *testing.T) {
 				t.Errorf("Error occured making transaction, %s", respR)
 			} else {
 				// lets send it
-				data, _ = handlePostRequestHelper("send-transaction", jsonToSend)
+				sts.DraftID = respR.Content.Name
+				data, _ = json.Marshal(sts)
+				data, _ = handlePostRequestHelper("send-transaction", string(data))
 				err = json.Unmarshal(data, respG)
 				if err != nil || respG.Error != "none" {
 					t.Error("Error occured sending transaction")
@@ -494,7 +496,9 @@ func TestConstructTransaction(t *testing.T) {
 				}
 				totalSent += amt
 				// lets send it
-				data, _ = handlePostRequestHelper("send-transaction", jsonToSend)
+				sts.DraftID = respR.Content.Name
+				data, _ = json.Marshal(sts)
+				data, _ = handlePostRequestHelper("send-transaction", string(data))
 				err = json.Unmarshal(data, respG)
 				if err != nil || respG.Error != "none" {
 					t.Errorf("Error occured sending transaction, %s", respG)
@@ -596,7 +600,9 @@ func TestSendFactoidsTransaction(t *testing.T) {
 				t.Error("Error occured making transaction")
 			} else {
 				// lets send it
-				data, _ = handlePostRequestHelper("send-transaction", jsonToSend)
+				sts.DraftID = respR.Content.Name
+				data, _ = json.Marshal(sts)
+				data, _ = handlePostRequestHelper("send-transaction", string(data))
 				err = json.Unmarshal(data, respG)
 				if err != nil || respG.Error != "none" {
 					t.Error("Error occured sending transaction")
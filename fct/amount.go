@@ -0,0 +1,91 @@
+// Package fct holds amounts of factoids, kept in factoshis
+package fct
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FactoshisPerFactoid is the number of factoshis in a factoid
+const FactoshisPerFactoid = 100000000
+
+// Amount is an amount of factoshis. It is parsed from and formatted to factoids as a decimal
+// with 8 places, never through a float, so "0.29" is exactly 29000000 factoshis.
+type Amount uint64
+
+// ParseAmount parses an amount of factoids, such as "12.5". An amount ending in "factoshis"
+// is in factoshis instead, such as "1250000000 factoshis". An amount may also end in "FCT".
+// Negative amounts, more than 8 decimal places and amounts that do not fit are errors.
+func ParseAmount(s string) (Amount, error) {
+	a := strings.TrimSpace(s)
+	lower := strings.ToLower(a)
+	for _, unit := range []string{"factoshis", "factoshi"} {
+		if strings.HasSuffix(lower, unit) {
+			return parseFactoshis(s, strings.TrimSpace(a[:len(a)-len(unit)]))
+		}
+	}
+	if strings.HasSuffix(lower, "fct") {
+		a = strings.TrimSpace(a[:len(a)-len("fct")])
+	}
+
+	if strings.HasPrefix(a, "-") {
+		return 0, fmt.Errorf("%s is negative", s)
+	}
+	whole, frac := a, ""
+	if i := strings.IndexByte(a, '.'); i >= 0 {
+		whole, frac = a[:i], a[i+1:]
+	}
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("%s is not a valid amount", s)
+	}
+
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > 8 {
+		return 0, fmt.Errorf("%s has more than 8 decimal places", s)
+	}
+	frac += strings.Repeat("0", 8-len(frac))
+
+	var w uint64
+	if whole != "" {
+		var err error
+		w, err = strconv.ParseUint(whole, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s is too large", s)
+		}
+	}
+	f, _ := strconv.ParseUint(frac, 10, 64)
+	if w > (math.MaxUint64-f)/FactoshisPerFactoid {
+		return 0, fmt.Errorf("%s is too large", s)
+	}
+	return Amount(w*FactoshisPerFactoid + f), nil
+}
+
+func parseFactoshis(s string, a string) (Amount, error) {
+	if strings.HasPrefix(a, "-") {
+		return 0, fmt.Errorf("%s is negative", s)
+	}
+	if a == "" || !isDigits(a) {
+		return 0, fmt.Errorf("%s is not a whole number of factoshis", s)
+	}
+	f, err := strconv.ParseUint(a, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s is too large", s)
+	}
+	return Amount(f), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the amount in factoids, with 8 decimal places
+func (a Amount) String() string {
+	return fmt.Sprintf("%d.%08d", uint64(a)/FactoshisPerFactoid, uint64(a)%FactoshisPerFactoid)
+}
@@ -0,0 +1,48 @@
+package fct_test
+
+import (
+	"testing"
+
+	. "github.com/FactomProject/enterprise-wallet/fct"
+)
+
+func TestParseAmount(t *testing.T) {
+	good := map[string]uint64{
+		"0.29":                  29000000,
+		"1":                     100000000,
+		"1.":                    100000000,
+		".5":                    50000000,
+		"12.50000000":           1250000000,
+		"0.00000001":            1,
+		"0.100000000":           10000000, // Trailing zeros are not extra places
+		" 3 FCT ":               300000000,
+		"1250000000 factoshis":  1250000000,
+		"1 factoshi":            1,
+		"184467440737.09551615": 18446744073709551615,
+	}
+	for s, want := range good {
+		a, err := ParseAmount(s)
+		if err != nil {
+			t.Errorf("%q: %s", s, err.Error())
+			continue
+		}
+		if uint64(a) != want {
+			t.Errorf("%q parsed to %d, expected %d", s, uint64(a), want)
+		}
+	}
+
+	bad := []string{"", ".", "-1", "-0.5", "1e8", "0.000000001", "1,5", "abc", "+1",
+		"184467440737.09551616", "99999999999999999999", "1.5 factoshis", "-5 factoshis", "factoshis",
+		"18446744073709551616 factoshis"}
+	for _, s := range bad {
+		if a, err := ParseAmount(s); err == nil {
+			t.Errorf("%q was accepted as %d", s, uint64(a))
+		}
+	}
+
+	for a, want := range map[Amount]string{0: "0.00000000", 29000000: "0.29000000", 1250000001: "12.50000001"} {
+		if a.String() != want {
+			t.Errorf("%d formatted as %s, expected %s", uint64(a), a.String(), want)
+		}
+	}
+}
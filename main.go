@@ -20,19 +20,13 @@ import (
 	"fmt"
 
 	"github.com/FactomProject/enterprise-wallet/wallet"
+	"github.com/FactomProject/enterprise-wallet/wallet/database"
 	"github.com/FactomProject/factomd/util"
 )
 
-// MasterWallet contains all addresses and databases related to a single wallet
-var MasterWallet *wallet.WalletDB
-
 func close() {
 	fmt.Println("Shutting down gracefully...")
-	if MasterWallet == nil {
-		return
-	}
-
-	err := MasterWallet.Close()
+	err := Wallets.Close()
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -41,7 +35,22 @@ func close() {
 
 // InitiateWalletAndWeb initiates and serves the guiwallet. If databases are given, they will be attempted to be loaded
 // and will be created if they are not found.
-func InitiateWalletAndWeb(guiDBStr string, walDBStr string, txDBStr string, port int, v1Import bool, v1Path string, factomdLocFlag string) {
+func InitiateWalletAndWeb(guiDBStr string, walDBStr string, txDBStr string, profile string, port int, v1Import bool, v1Path string, factomdLocFlag string) {
+	InitiateWallet(guiDBStr, walDBStr, txDBStr, profile, v1Import, v1Path, factomdLocFlag)
+
+	// For Testing adds random addresses
+	if ADD_RANDOM_ADDRESSES {
+		addRandomAddresses()
+	}
+	//
+
+	Wallets.StartBackground()
+	ServeWallet(port)
+}
+
+// InitiateWallet opens the wallet of a profile and loads its MasterSettings, without
+// serving anything. If no profile is given, the last one switched to is opened.
+func InitiateWallet(guiDBStr string, walDBStr string, txDBStr string, profile string, v1Import bool, v1Path string, factomdLocFlag string) {
 	fmt.Println("--------- Initiating GUIWallet ----------")
 
 	filename := util.ConfigFilename() //file name and path to factomd.conf file
@@ -60,115 +69,118 @@ func InitiateWalletAndWeb(guiDBStr string, walDBStr string, txDBStr string, port
 
 	wallet.WalletBoltV1Path = v1Path
 
-	var (
-		walletDB, guiDB, txDB int
-	)
-
-	// DB Types
-	switch guiDBStr { // Holds names associated with addresses for gui. Also holds settings
-	case "Map":
-		guiDB = wallet.MAP
-	case "Bolt":
-		guiDB = wallet.BOLT
-	case "LDB":
-		guiDB = wallet.LDB
-	}
-	switch walDBStr { // WalletDB is DB used by wallet wsapi
-	case "Map":
-		walletDB = wallet.MAP
-	case "Bolt":
-		walletDB = wallet.BOLT
-	case "LDB":
-		walletDB = wallet.LDB
+	// DB Types, any backend registered in the database package that can hold the database
+	kinds := map[database.DBKind]string{database.GUIDB: guiDBStr, database.WalletDB: walDBStr, database.TXDB: txDBStr}
+	for kind, name := range kinds {
+		b, err := database.GetBackend(name)
+		if err == nil {
+			err = b.CanHold(kind)
+		}
+		if err != nil {
+			panic("Error in starting wallet: " + err.Error())
+		}
 	}
-	switch txDBStr { // Holds transactions cache
-	case "Map":
-		txDB = wallet.MAP
-	case "Bolt":
-		txDB = wallet.BOLT
-	case "LDB":
-		txDB = wallet.LDB
+
+	if profile == "" {
+		p, err := wallet.ActiveProfile()
+		if err != nil {
+			panic("Error in starting wallet: " + err.Error())
+		}
+		profile = p.Name
 	}
 
-	// Start Walletd
-	fmt.Printf("Wallet DB using %s, GUI DB using %s, TX DB using %s\n", intToStringDBType(walletDB), intToStringDBType(guiDB), intToStringDBType(txDB))
+	fmt.Printf("Wallet DB using %s, GUI DB using %s, TX DB using %s\n", walDBStr, guiDBStr, txDBStr)
+	fmt.Printf("Data directory: %s\n", wallet.DATA_DIR)
+	fmt.Printf("Wallet: %s\n", profile)
 
 	// Can adjust starting variables
 	// This will also start wallet wsapi
-	wal, err := wallet.StartWallet(factomdLocation, walletDB, guiDB, txDB, v1Import)
+	wal, err := wallet.StartWallet(factomdLocation, walDBStr, guiDBStr, txDBStr, profile, v1Import)
+	// Each of the wallet and GUI databases can be recovered from a snapshot
+	for tries := 0; err != nil && tries < 2; tries++ {
+		oe, ok := err.(*wallet.OpenError)
+		if !ok || !offerSnapshot(oe) {
+			break
+		}
+		wal, err = wallet.StartWallet(factomdLocation, walDBStr, guiDBStr, txDBStr, profile, v1Import)
+	}
 	if err != nil {
 		panic("Error in starting wallet: " + err.Error())
 	}
 
-	MasterWallet = wal
+	Wallets.Lock()
+	Wallets.active = wal
+	Wallets.factomdLocation = factomdLocation
+	Wallets.controlPanelPort = controlPanelPort
+	Wallets.Unlock()
+
+	err = loadSettings(wal, factomdLocation, controlPanelPort)
+	if err != nil {
+		panic("Error in loading settings: " + err.Error())
+	}
+}
 
-	// Start Settings
-	MasterSettings = new(SettingsStruct)
-	data, err := MasterWallet.GUIlDB.Get([]byte("gui-wallet"), []byte("settings"), MasterSettings)
+// loadSettings makes the settings saved in a wallet the MasterSettings. A factomd location
+// other than the default, from the config file or a flag, trumps the saved one.
+func loadSettings(wal *wallet.WalletDB, factomdLocation string, controlPanelPort int) error {
+	settings := new(SettingsStruct)
+	data, err := wal.GUIlDB.Get([]byte("gui-wallet"), []byte("settings"), settings)
 	if err != nil || data == nil {
 		// Settings are not saved, AKA fresh start
 
-		MasterSettings.FactomdLocation = factomdLocation
+		settings.FactomdLocation = factomdLocation
 
 		// Default dark
-		MasterSettings.DarkTheme = true
-		MasterSettings.Theme = "darkTheme"
-		err = MasterWallet.GUIlDB.Put([]byte("gui-wallet"), []byte("settings"), MasterSettings)
+		settings.DarkTheme = true
+		settings.Theme = "darkTheme"
+		err = wal.GUIlDB.Put([]byte("gui-wallet"), []byte("settings"), settings)
 		if err != nil {
-			panic("Error in loading settings: " + err.Error())
+			return err
 		}
 	} else {
-		MasterSettings = data.(*SettingsStruct)
+		settings = data.(*SettingsStruct)
 		// If we have a custom config file, or a custom flag, we will overwrite the settings.
 		// This is so we can still trump the settings in the GUI
 		if factomdLocation != "courtesy-node.factom.com" {
-			MasterSettings.FactomdLocation = factomdLocation
+			settings.FactomdLocation = factomdLocation
 		}
 		// Here is the first override of the factomd location from the GUI settings.
 		// You can see above, this value will be overwritten by any config or flag
-		factomdLocation = MasterSettings.FactomdLocation
+		factomdLocation = settings.FactomdLocation
+
+		// Settings may be in an older format, rewrite them in the current one
+		err = wal.GUIlDB.Put([]byte("gui-wallet"), []byte("settings"), settings)
+		if err != nil {
+			fmt.Println("Error saving settings: " + err.Error())
+		}
 	}
 
 	// If someone is using the old courtesy node, send them to the new
-	if MasterSettings.FactomdLocation == "factomd-live.cloudapp.net:8088" {
-		MasterSettings.FactomdLocation = "courtesy-node.factom.com"
+	if settings.FactomdLocation == "factomd-live.cloudapp.net:8088" {
+		settings.FactomdLocation = "courtesy-node.factom.com"
 	}
 
-	MasterSettings.SetFactomdLocation(factomdLocation)
+	settings.SetFactomdLocation(factomdLocation)
 
-	MasterSettings.ControlPanelPort = controlPanelPort
+	settings.ControlPanelPort = controlPanelPort
 	// We always need to load transactions, even if in database. So let's start as not synced
-	MasterSettings.Synced = false
-
-	// For Testing adds random addresses
-	if ADD_RANDOM_ADDRESSES {
-		addRandomAddresses()
-	}
-	//
+	settings.Synced = false
 
-	ServeWallet(port)
+	MasterSettings = settings
+	return nil
 }
 
 func addRandomAddresses() {
+	wal, release := Wallets.Acquire()
+	defer release()
+
 	for i := 0; i < 5; i++ {
-		MasterWallet.GenerateEntryCreditAddress("AddedForTesting")
+		wal.GenerateEntryCreditAddress("AddedForTesting")
 	}
 
 	for i := 0; i < 5; i++ {
-		MasterWallet.GenerateFactoidAddress("AddedForTesting")
+		wal.GenerateFactoidAddress("AddedForTesting")
 	}
 
-	MasterWallet.AddAddress("Sand", "Fs3E9gV6DXsYzf7Fqx1fVBQPQXV695eP3k5XbmHEZVRLkMdD9qCK")
-}
-
-func intToStringDBType(t int) string {
-	switch t {
-	case wallet.MAP:
-		return "Map"
-	case wallet.LDB:
-		return "LDB"
-	case wallet.BOLT:
-		return "Bolt"
-	}
-	return "[No DB Type Found]"
+	wal.AddAddress("Sand", "Fs3E9gV6DXsYzf7Fqx1fVBQPQXV695eP3k5XbmHEZVRLkMdD9qCK")
 }
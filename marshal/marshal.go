@@ -0,0 +1,160 @@
+// Marshal is the binary format used to save structures in the GUI database.
+//
+// Every structure starts with a header, followed by a list of fields:
+//
+//	Header : Magic (1 byte) | Version (1 byte) | Body Length (uvarint)
+//	Field  : Tag (uvarint) | Length (uvarint) | Data
+//
+// Fields are identified by their tag, so new fields can be added without breaking
+// older readers, which skip any tag they do not know. Tag 0 is never valid.
+//
+// The magic byte is never the first byte of the layouts used before this format,
+// so a reader can tell which layout it was given and fall back to the old decoder.
+package marshal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Magic is the first byte of any structure in this format
+const Magic byte = 0xFE
+
+// IsVersioned returns true if the data is in this format, and not a legacy layout
+func IsVersioned(data []byte) bool {
+	return len(data) > 0 && data[0] == Magic
+}
+
+// Field is a single tagged value
+type Field struct {
+	Tag  uint64
+	Data []byte
+}
+
+// Bool decodes a field written by Writer.Bool
+func (f Field) Bool() (bool, error) {
+	if len(f.Data) != 1 || f.Data[0] > 1 {
+		return false, fmt.Errorf("Field %d is not a boolean", f.Tag)
+	}
+	return f.Data[0] == 1, nil
+}
+
+// String decodes a field written by Writer.String
+func (f Field) String() string {
+	return string(f.Data)
+}
+
+// Uint64 decodes a field written by Writer.Uint64
+func (f Field) Uint64() (uint64, error) {
+	v, n := binary.Uvarint(f.Data)
+	if n <= 0 || n != len(f.Data) {
+		return 0, fmt.Errorf("Field %d is not a number", f.Tag)
+	}
+	return v, nil
+}
+
+// Writer builds the body of a structure field by field
+type Writer struct {
+	body bytes.Buffer
+}
+
+func NewWriter() *Writer {
+	return new(Writer)
+}
+
+func (w *Writer) putUvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	w.body.Write(b[:n])
+}
+
+// Bytes adds a field holding raw bytes
+func (w *Writer) Bytes(tag uint64, data []byte) {
+	if tag == 0 {
+		panic("marshal: tag 0 is reserved")
+	}
+	w.putUvarint(tag)
+	w.putUvarint(uint64(len(data)))
+	w.body.Write(data)
+}
+
+func (w *Writer) String(tag uint64, s string) {
+	w.Bytes(tag, []byte(s))
+}
+
+func (w *Writer) Bool(tag uint64, b bool) {
+	if b {
+		w.Bytes(tag, []byte{1})
+	} else {
+		w.Bytes(tag, []byte{0})
+	}
+}
+
+func (w *Writer) Uint64(tag uint64, v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	w.Bytes(tag, b[:n])
+}
+
+// Marshal returns the header and body
+func (w *Writer) Marshal(version byte) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(Magic)
+	buf.WriteByte(version)
+
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], uint64(w.body.Len()))
+	buf.Write(b[:n])
+	buf.Write(w.body.Bytes())
+
+	return buf.Next(buf.Len())
+}
+
+// Unmarshal reads a structure written by Writer.Marshal. Any data after the
+// structure is returned in newData.
+func Unmarshal(data []byte) (version byte, fields []Field, newData []byte, err error) {
+	if !IsVersioned(data) {
+		return 0, nil, data, fmt.Errorf("Data is not in a versioned format")
+	}
+	if len(data) < 3 {
+		return 0, nil, data, fmt.Errorf("Data is too short to have a header")
+	}
+	version = data[1]
+
+	length, n := binary.Uvarint(data[2:])
+	if n <= 0 {
+		return 0, nil, data, fmt.Errorf("Invalid length in header")
+	}
+	body := data[2+n:]
+	if uint64(len(body)) < length {
+		return 0, nil, data, fmt.Errorf("Data is shorter than its length, expected %d found %d", length, len(body))
+	}
+	newData = body[length:]
+	body = body[:length]
+
+	for len(body) > 0 {
+		tag, n := binary.Uvarint(body)
+		if n <= 0 {
+			return 0, nil, data, fmt.Errorf("Invalid field tag")
+		}
+		if tag == 0 {
+			return 0, nil, data, fmt.Errorf("Field tag 0 is not valid")
+		}
+		body = body[n:]
+
+		l, n := binary.Uvarint(body)
+		if n <= 0 {
+			return 0, nil, data, fmt.Errorf("Invalid length for field %d", tag)
+		}
+		body = body[n:]
+		if uint64(len(body)) < l {
+			return 0, nil, data, fmt.Errorf("Field %d is longer than the data", tag)
+		}
+
+		fields = append(fields, Field{Tag: tag, Data: body[:l]})
+		body = body[l:]
+	}
+
+	return version, fields, newData, nil
+}
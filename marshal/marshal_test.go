@@ -0,0 +1,72 @@
+package marshal_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/FactomProject/enterprise-wallet/marshal"
+)
+
+func TestMarshalUnmarshal(t *testing.T) {
+	w := NewWriter()
+	w.Bool(1, true)
+	w.String(2, "Hello")
+	w.Uint64(3, 1<<40)
+	w.Bytes(4, []byte{0x00, 0x01})
+
+	data := w.Marshal(7)
+	if !IsVersioned(data) {
+		t.Fatal("Should be versioned")
+	}
+
+	// Trailing data is returned
+	data = append(data, 0xAA)
+
+	version, fields, newData, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 7 {
+		t.Errorf("Version should be 7, found %d", version)
+	}
+	if !bytes.Equal(newData, []byte{0xAA}) {
+		t.Errorf("Trailing data not returned")
+	}
+	if len(fields) != 4 {
+		t.Fatalf("Expected 4 fields, found %d", len(fields))
+	}
+
+	if b, err := fields[0].Bool(); err != nil || !b {
+		t.Error("Bool field wrong")
+	}
+	if fields[1].String() != "Hello" {
+		t.Error("String field wrong")
+	}
+	if v, err := fields[2].Uint64(); err != nil || v != 1<<40 {
+		t.Error("Uint64 field wrong")
+	}
+	if !bytes.Equal(fields[3].Data, []byte{0x00, 0x01}) {
+		t.Error("Bytes field wrong")
+	}
+}
+
+func TestUnmarshalFails(t *testing.T) {
+	w := NewWriter()
+	w.String(1, "Hello")
+	data := w.Marshal(1)
+
+	if _, _, _, err := Unmarshal(data[1:]); err == nil {
+		t.Error("Should fail without the magic byte")
+	}
+	if _, _, _, err := Unmarshal(data[:len(data)-1]); err == nil {
+		t.Error("Should fail when shorter than the length")
+	}
+
+	// Tag 0 is not valid
+	bad := make([]byte, len(data))
+	copy(bad, data)
+	bad[3] = 0x00
+	if _, _, _, err := Unmarshal(bad); err == nil {
+		t.Error("Should fail with a tag of 0")
+	}
+}
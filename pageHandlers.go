@@ -13,6 +13,8 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/FactomProject/enterprise-wallet/marshal"
+	"github.com/FactomProject/enterprise-wallet/wallet"
 	"github.com/FactomProject/factom"
 )
 
@@ -40,6 +42,7 @@ type SettingsStruct struct {
 	CoinControl     bool
 	ImportExport    bool //Transaction import/export
 	FactomdLocation string
+	CoinSelection   string // Name of the coin selector, empty is the default
 
 	// Not marshaled
 	Theme            string // darkTheme or ""
@@ -49,12 +52,17 @@ type SettingsStruct struct {
 
 // Refresh refreshes the "synced" flag, and anything else that needs to be done
 // before a page loads
-func (s *SettingsStruct) Refresh() (leaderHeight int64, entryHeight int64, fblockHeight uint32) {
+func (s *SettingsStruct) Refresh(wal *wallet.WalletDB) (leaderHeight int64, entryHeight int64, fblockHeight uint32) {
 	var err error
 	leaderHeight = 0
 	entryHeight = 0
 	fblockHeight = 0
 
+	if wallet.OFFLINE {
+		s.Synced = false
+		return
+	}
+
 	h, err := factom.GetHeights()
 	if err != nil || h == nil {
 		s.Synced = false
@@ -64,7 +72,7 @@ func (s *SettingsStruct) Refresh() (leaderHeight int64, entryHeight int64, fbloc
 	leaderHeight = h.LeaderHeight
 	entryHeight = h.EntryHeight
 
-	fblockHeight, err = MasterWallet.Wallet.TXDB().FetchNextFBlockHeight()
+	fblockHeight, err = wal.Wallet.TXDB().FetchNextFBlockHeight()
 	if err != nil {
 		s.Synced = false
 		return
@@ -103,6 +111,10 @@ func (a *SettingsStruct) IsSameAs(b *SettingsStruct) bool {
 		return false
 	}
 
+	if a.CoinSelection != b.CoinSelection {
+		return false
+	}
+
 	return true
 }
 
@@ -110,37 +122,33 @@ func (s *SettingsStruct) SetFactomdLocation(factomdLocation string) {
 	factom.SetFactomdServer(factomdLocation)
 }
 
-func (s *SettingsStruct) MarshalBinary() ([]byte, error) {
-	buf := new(bytes.Buffer)
+// Version of the SettingsStruct binary format, and its field tags
+const (
+	settingsVersion byte = 1
 
-	var b []byte
+	settingsTagDarkTheme       uint64 = 1
+	settingsTagKeyExport       uint64 = 2
+	settingsTagCoinControl     uint64 = 3
+	settingsTagImportExport    uint64 = 4
+	settingsTagFactomdLocation uint64 = 5
+	settingsTagCoinSelection   uint64 = 6
+)
 
-	b = strconv.AppendBool(b, s.DarkTheme)
-	if s.DarkTheme {
-		b = append(b, 0x00)
-	}
-	b = strconv.AppendBool(b, s.KeyExport)
-	if s.KeyExport {
-		b = append(b, 0x00)
-	}
-	b = strconv.AppendBool(b, s.CoinControl)
-	if s.CoinControl {
-		b = append(b, 0x00)
-	}
-	b = strconv.AppendBool(b, s.ImportExport)
-	if s.ImportExport {
-		b = append(b, 0x00)
+func (s *SettingsStruct) MarshalBinary() ([]byte, error) {
+	if len(s.FactomdLocation) > MAX_FACTOMDLOCATION_SIZE {
+		return nil, fmt.Errorf("Length of string is too long, found length is %d, max length is %d",
+			len(s.FactomdLocation), MAX_FACTOMDLOCATION_SIZE)
 	}
 
-	buf.Write(b)
-
-	data, err := MarshalStringToBytes(s.FactomdLocation, MAX_FACTOMDLOCATION_SIZE)
-	if err != nil {
-		return nil, err
-	}
-	buf.Write(data)
+	w := marshal.NewWriter()
+	w.Bool(settingsTagDarkTheme, s.DarkTheme)
+	w.Bool(settingsTagKeyExport, s.KeyExport)
+	w.Bool(settingsTagCoinControl, s.CoinControl)
+	w.Bool(settingsTagImportExport, s.ImportExport)
+	w.String(settingsTagFactomdLocation, s.FactomdLocation)
+	w.String(settingsTagCoinSelection, s.CoinSelection)
 
-	return buf.Next(buf.Len()), nil
+	return w.Marshal(settingsVersion), nil
 }
 
 func (s *SettingsStruct) UnmarshalBinary(data []byte) error {
@@ -161,6 +169,51 @@ func unmarshalBool(booldata []byte) (bool, error) {
 }
 
 func (s *SettingsStruct) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	if !marshal.IsVersioned(data) {
+		return s.unmarshalLegacy(data)
+	}
+
+	_, fields, newData, err := marshal.Unmarshal(data)
+	if err != nil {
+		return data, err
+	}
+
+	s.FactomdLocation = "localhost:8088" // Will be overwritten if changed anyhow
+	for _, f := range fields {
+		switch f.Tag {
+		case settingsTagDarkTheme:
+			s.DarkTheme, err = f.Bool()
+		case settingsTagKeyExport:
+			s.KeyExport, err = f.Bool()
+		case settingsTagCoinControl:
+			s.CoinControl, err = f.Bool()
+		case settingsTagImportExport:
+			s.ImportExport, err = f.Bool()
+		case settingsTagFactomdLocation:
+			s.FactomdLocation = f.String()
+		case settingsTagCoinSelection:
+			s.CoinSelection = f.String()
+		}
+		if err != nil {
+			return data, err
+		}
+	}
+
+	if s.DarkTheme {
+		s.Theme = "darkTheme"
+	} else {
+		s.Theme = ""
+	}
+
+	return newData, nil
+}
+
+// unmarshalLegacy reads the layouts used before the versioned format. Booleans are
+// saved as "true\x00" or "false", followed by the factomd location in one of 3 versions.
+func (s *SettingsStruct) unmarshalLegacy(data []byte) (newData []byte, err error) {
+	if len(data) < 20 {
+		return data, fmt.Errorf("Not enough data for settings, found %d bytes", len(data))
+	}
 	newData = data
 
 	s.DarkTheme, err = unmarshalBool(newData[:5])
@@ -244,6 +297,9 @@ func HandleAddressBook(w http.ResponseWriter, r *http.Request) error {
 type HandleSettingsStruct struct {
 	Settings *SettingsStruct
 
+	CoinSelectors []string
+	CoinSelection string // The one in use, the default if none was chosen
+
 	Success bool
 }
 
@@ -255,6 +311,11 @@ func HandleSettings(w http.ResponseWriter, r *http.Request) error {
 
 	st := new(HandleSettingsStruct)
 	st.Settings = MasterSettings
+	st.CoinSelectors = wallet.CoinSelectorNames()
+	st.CoinSelection = MasterSettings.CoinSelection
+	if st.CoinSelection == "" {
+		st.CoinSelection = wallet.DefaultCoinSelector
+	}
 
 	st.Success = false
 	if suc == "true" {
@@ -413,7 +474,10 @@ func HandleReceiveFactoids(w http.ResponseWriter, r *http.Request) error {
 
 	st.Address = address
 	st.Name = name
-	if MasterWallet.IsValidAddress(address) {
+	wal, release := Wallets.Acquire()
+	valid := wal != nil && wal.IsValidAddress(address)
+	release()
+	if valid {
 		templates.ExecuteTemplate(w, "receive-factoids", st)
 	} else {
 		templates.ExecuteTemplate(w, "receive-factoids", st)
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+// USE_SNAPSHOT restores a database that fails to open from the newest good snapshot,
+// without asking first
+var USE_SNAPSHOT = false
+
+// RestoreSnapshot restores a wallet from a snapshot, along with the settings saved in it
+func RestoreSnapshot(wal *wallet.WalletDB, name string, passphrase string) error {
+	err := wal.RestoreSnapshot(name, passphrase)
+	if err != nil {
+		return err
+	}
+
+	data, err := wal.GUIlDB.Get([]byte("gui-wallet"), []byte("settings"), new(SettingsStruct))
+	if err != nil || data == nil {
+		// No settings in the snapshot, keep the current ones
+		return SaveSettings(wal)
+	}
+	applySettings(data.(*SettingsStruct))
+	return nil
+}
+
+// offerSnapshot is called when a database fails to open. If there is a snapshot to
+// recover it from, the user is asked if it should be used. Returns true if the database
+// was recovered, and opening it can be tried again.
+func offerSnapshot(oe *wallet.OpenError) bool {
+	fmt.Println(oe.Error())
+	if oe.Snapshot == nil {
+		return false
+	}
+	fmt.Printf("The newest good snapshot is %s, taken %s\n", oe.Snapshot.Name, time.Unix(oe.Snapshot.Created, 0).Format(time.RFC1123))
+
+	if !USE_SNAPSHOT {
+		// Only ask if someone is there to answer
+		if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			fmt.Println("Launch with -usesnapshot to recover the database from it")
+			return false
+		}
+		answer, err := readLine(bufio.NewReader(os.Stdin), "Recover the database from it? [y/N]: ")
+		if err != nil || !strings.EqualFold(strings.TrimSpace(answer), "y") {
+			return false
+		}
+	}
+
+	err := wallet.RecoverFromSnapshot(oe.Dir, oe.Kind, oe.Snapshot.Name)
+	if err != nil {
+		fmt.Println("Could not recover from the snapshot: " + err.Error())
+		return false
+	}
+	fmt.Printf("The %s database was recovered, the old one is kept with '.corrupt' added to its name\n", oe.Kind)
+	return true
+}
@@ -0,0 +1,180 @@
+package wallet
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The history of one address is every transaction in the transaction database touching it,
+// with how much it changed the balance of the address and the balance after it. Balances
+// start at 0 at the first transaction, so the last is the balance now. An entry credit
+// address only gets factoids converted to it, what it spends on entries is not a factoid
+// transaction, so its balance is the factoshis converted to it.
+
+// AddressHistoryQuery picks the part of the history of an address to return. The filters
+// left at 0 are not used.
+type AddressHistoryQuery struct {
+	Address string
+
+	FromHeight uint32 // Lowest block height
+	ToHeight   uint32 // Highest block height
+	FromTime   int64  // Unix time of the earliest transaction
+	ToTime     int64  // Unix time of the latest transaction
+
+	Current int // Index of the first entry to return, newest first
+	More    int // How many entries to return, all of them if 0
+}
+
+// AddressLedgerEntry is a transaction in the history of an address
+type AddressLedgerEntry struct {
+	TxID      string
+	Height    uint32
+	Date      string
+	Time      string
+	ExactTime time.Time
+
+	Delta   int64 // Factoshis the balance of the address changed by
+	Balance int64 // Factoshis in the address after the transaction
+
+	Transaction DisplayTransaction
+}
+
+// AddressHistory is the history of an address, newest first
+type AddressHistory struct {
+	Address string
+	Name    string
+	List    int    // 1 for factoid, 2 for entry credit, 3 for the address book
+	Type    string // FCT or EC
+	Balance int64  // After the last transaction
+	Total   int    // Entries matching the filters, before paging
+	Entries []AddressLedgerEntry
+}
+
+// GetAddressHistory returns the history of an address in the wallet or the address book
+func (w *WalletDB) GetAddressHistory(q *AddressHistoryQuery) (*AddressHistory, error) {
+	if OFFLINE { // The transactions come from factomd
+		return nil, ErrOffline
+	}
+	anp, list := w.GetGUIAddress(q.Address)
+	if list == -1 || anp == nil {
+		return nil, fmt.Errorf("Address not found")
+	}
+	if w.TransactionDB == nil {
+		return nil, fmt.Errorf("The transaction database is not loaded yet")
+	}
+
+	transactions, err := w.TransactionDB.GetTXAddress(q.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the transactions already cached for the related transactions if they are there
+	w.relatedTransactionLock.Lock()
+	var dts []DisplayTransaction
+	for _, t := range transactions {
+		if dt, ok := w.transMap[t.GetSigHash().String()]; ok {
+			dts = append(dts, dt)
+			continue
+		}
+		dt, err := w.NewDisplayTransaction(t)
+		if err != nil {
+			w.relatedTransactionLock.Unlock()
+			return nil, err
+		}
+		dts = append(dts, *dt)
+	}
+	w.relatedTransactionLock.Unlock()
+
+	h := &AddressHistory{Address: anp.Address, Name: anp.Name, List: list, Type: "FCT"}
+	if anp.Address[:2] == "EC" {
+		h.Type = "EC"
+	}
+	ledger := AddressLedger(anp.Address, w.ScrubDisplayTransactionsForNameChanges(dts))
+	if len(ledger) > 0 {
+		h.Balance = ledger[0].Balance
+	}
+	h.Entries, h.Total = q.Apply(ledger)
+	return h, nil
+}
+
+// AddressLedger returns the transactions touching an address, newest first, with the
+// change to its balance and its balance after each. The transactions can be in any order.
+func AddressLedger(addr string, trans []DisplayTransaction) []AddressLedgerEntry {
+	sorted := make([]DisplayTransaction, 0, len(trans))
+	seen := make(map[string]bool)
+	for _, t := range trans {
+		if seen[t.TxID] {
+			continue
+		}
+		seen[t.TxID] = true
+		sorted = append(sorted, t)
+	}
+	sort.Stable(DisplayTransactions(sorted)) // Newest first, like the related transactions
+
+	ledger := make([]AddressLedgerEntry, len(sorted))
+	var balance int64
+	for i := len(sorted) - 1; i >= 0; i-- {
+		t := sorted[i]
+		delta := addressDelta(addr, t)
+		balance += delta
+		ledger[i] = AddressLedgerEntry{
+			TxID:        t.TxID,
+			Height:      t.Height,
+			Date:        t.Date,
+			Time:        t.Time,
+			ExactTime:   t.ExactTime,
+			Delta:       delta,
+			Balance:     balance,
+			Transaction: t,
+		}
+	}
+	return ledger
+}
+
+// addressDelta is what a transaction pays to an address less what it takes from it
+func addressDelta(addr string, t DisplayTransaction) int64 {
+	var delta int64
+	for _, in := range t.Inputs {
+		if in.Address == addr {
+			delta -= int64(in.Amount)
+		}
+	}
+	for _, out := range t.Outputs {
+		if out.Address == addr {
+			delta += int64(out.Amount)
+		}
+	}
+	return delta
+}
+
+// Apply returns the page of the entries of a ledger that match the filters, and how many
+// match in all
+func (q *AddressHistoryQuery) Apply(ledger []AddressLedgerEntry) ([]AddressLedgerEntry, int) {
+	var matched []AddressLedgerEntry
+	for _, e := range ledger {
+		if q.FromHeight != 0 && e.Height < q.FromHeight {
+			continue
+		}
+		if q.ToHeight != 0 && e.Height > q.ToHeight {
+			continue
+		}
+		if q.FromTime != 0 && e.ExactTime.Unix() < q.FromTime {
+			continue
+		}
+		if q.ToTime != 0 && e.ExactTime.Unix() > q.ToTime {
+			continue
+		}
+		matched = append(matched, e)
+	}
+
+	total := len(matched)
+	if q.Current < 0 || q.Current >= total {
+		return []AddressLedgerEntry{}, total
+	}
+	end := total
+	if q.More > 0 && q.Current+q.More < total {
+		end = q.Current + q.More
+	}
+	return matched[q.Current:end], total
+}
@@ -0,0 +1,65 @@
+package wallet_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+func TestAddressLedger(t *testing.T) {
+	addr := "FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1Q"
+	other := "FA3EPZYqodgyEGXNMbiZKE5TS2x2J9wF8J9MvPZb52iGR78xMgCb"
+	start := time.Unix(1500000000, 0)
+
+	tx := func(id string, height uint32, ins, outs []TransactionAddressInfo) DisplayTransaction {
+		return DisplayTransaction{TxID: id, Height: height, ExactTime: start.Add(time.Duration(height) * time.Minute), Inputs: ins, Outputs: outs}
+	}
+	info := func(a string, amount uint64) TransactionAddressInfo {
+		return TransactionAddressInfo{Address: a, Amount: amount, Type: "FCT"}
+	}
+
+	// Out of order, with a duplicate
+	trans := []DisplayTransaction{
+		tx("spend", 20, []TransactionAddressInfo{info(addr, 3e8)}, []TransactionAddressInfo{info(other, 2e8), info(addr, 5e7)}),
+		tx("receive", 10, []TransactionAddressInfo{info(other, 5e8)}, []TransactionAddressInfo{info(addr, 5e8)}),
+		tx("receive", 10, []TransactionAddressInfo{info(other, 5e8)}, []TransactionAddressInfo{info(addr, 5e8)}),
+		tx("again", 30, []TransactionAddressInfo{info(other, 1e8)}, []TransactionAddressInfo{info(addr, 1e8)}),
+	}
+
+	ledger := AddressLedger(addr, trans)
+	expected := []struct {
+		id      string
+		delta   int64
+		balance int64
+	}{
+		{"again", 1e8, 3.5e8},
+		{"spend", -2.5e8, 2.5e8},
+		{"receive", 5e8, 5e8},
+	}
+	if len(ledger) != len(expected) {
+		t.Fatalf("Expected %d entries, found %d", len(expected), len(ledger))
+	}
+	for i, e := range expected {
+		if ledger[i].TxID != e.id || ledger[i].Delta != e.delta || ledger[i].Balance != e.balance {
+			t.Errorf("Entry %d: expected %s %d %d, found %s %d %d", i, e.id, e.delta, e.balance, ledger[i].TxID, ledger[i].Delta, ledger[i].Balance)
+		}
+	}
+
+	q := &AddressHistoryQuery{FromHeight: 15}
+	page, total := q.Apply(ledger)
+	if total != 2 || len(page) != 2 || page[1].TxID != "spend" {
+		t.Errorf("Height filter gave %d of %d", len(page), total)
+	}
+
+	q = &AddressHistoryQuery{ToTime: start.Add(20 * time.Minute).Unix(), Current: 1, More: 1}
+	page, total = q.Apply(ledger)
+	if total != 2 || len(page) != 1 || page[0].TxID != "receive" {
+		t.Errorf("Time filter and paging gave %d of %d", len(page), total)
+	}
+
+	q = &AddressHistoryQuery{Current: 5}
+	if page, total = q.Apply(ledger); total != 3 || len(page) != 0 {
+		t.Errorf("Paging past the end gave %d of %d", len(page), total)
+	}
+}
@@ -0,0 +1,413 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/FactomProject/enterprise-wallet/address"
+	"github.com/FactomProject/enterprise-wallet/marshal"
+	"github.com/FactomProject/enterprise-wallet/wallet/database"
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factom/wallet"
+)
+
+// A backup is a single archive holding everything the wallet knows: the seed, every
+// private key, the names of all addresses and the GUI settings. The contents are
+// encrypted with a key derived from a passphrase. A watch-only wallet has no seed or
+// private keys, its backup holds its public keys instead, and can only be restored into
+// another watch-only wallet.
+//
+// Archive layout (see the marshal package):
+//	Version 1
+//	Fields: Type, Salt, N, R, P, Encrypted contents, Checksum of encrypted contents
+
+const (
+	backupVersion byte   = 1
+	backupType    string = "enterprise-wallet-backup"
+
+	backupTagType     uint64 = 1
+	backupTagSalt     uint64 = 2
+	backupTagN        uint64 = 3
+	backupTagR        uint64 = 4
+	backupTagP        uint64 = 5
+	backupTagContents uint64 = 6
+	backupTagChecksum uint64 = 7
+)
+
+// backupContents is encrypted inside the archive
+type backupContents struct {
+	Created     int64
+	Seed        wallet.DBSeed
+	FactoidKeys []string // Private keys
+	ECKeys      []string // Private keys
+
+	WatchOnly  bool        `json:",omitempty"`
+	PublicKeys []PublicKey `json:",omitempty"` // Of a watch-only wallet
+
+	FactoidAddresses     []address.AddressNamePair
+	EntryCreditAddresses []address.AddressNamePair
+	ExternalAddresses    []address.AddressNamePair
+
+	Settings []byte // Saved as is, the wallet does not know the settings format
+}
+
+// RestoreConflict is something in the backup that could not be restored as it was
+type RestoreConflict struct {
+	Address    string
+	Current    string // Current value
+	Backup     string // Value in the backup
+	Resolution string
+}
+
+// RestoreReport says what a restore did
+type RestoreReport struct {
+	Replaced       bool
+	KeysAdded      int
+	AddressesAdded int
+	Conflicts      []RestoreConflict
+
+	// Settings found in the backup. Only given on a replace, it is up to the caller to apply them
+	Settings []byte
+}
+
+func (r *RestoreReport) conflict(add string, current string, backup string, resolution string) {
+	r.Conflicts = append(r.Conflicts, RestoreConflict{add, current, backup, resolution})
+}
+
+// ExportBackup returns an archive of the whole wallet encrypted with the passphrase.
+// Settings are added to the archive as given.
+func (w *WalletDB) ExportBackup(passphrase string, settings []byte) ([]byte, error) {
+	if err := w.checkUnlocked(); err != nil {
+		return nil, err
+	}
+
+	c := new(backupContents)
+	c.Created = time.Now().Unix()
+	c.Settings = settings
+
+	if w.IsWatchOnly() {
+		keys, err := w.watchKeys()
+		if err != nil {
+			return nil, err
+		}
+		c.WatchOnly = true
+		for _, k := range keys {
+			c.PublicKeys = append(c.PublicKeys, *k)
+		}
+	} else {
+		seed, err := w.Wallet.GetDBSeed()
+		if err != nil {
+			return nil, err
+		}
+		c.Seed = *seed
+
+		fas, ecs, err := w.Wallet.GetAllAddresses()
+		if err != nil {
+			return nil, err
+		}
+		for _, fa := range fas {
+			c.FactoidKeys = append(c.FactoidKeys, fa.SecString())
+		}
+		for _, ec := range ecs {
+			c.ECKeys = append(c.ECKeys, ec.SecString())
+		}
+	}
+
+	c.FactoidAddresses = w.guiWallet.GetAllAddressesFromList(1)
+	c.EntryCreditAddresses = w.guiWallet.GetAllAddressesFromList(2)
+	c.ExternalAddresses = w.guiWallet.GetAllAddressesFromList(3)
+
+	plain, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	salt, err := database.NewSalt()
+	if err != nil {
+		return nil, err
+	}
+	key, err := database.DeriveKey(passphrase, salt, database.ScryptN, database.ScryptR, database.ScryptP)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := database.Encrypt(key, plain, []byte(backupType))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(sealed)
+
+	m := marshal.NewWriter()
+	m.String(backupTagType, backupType)
+	m.Bytes(backupTagSalt, salt)
+	m.Uint64(backupTagN, uint64(database.ScryptN))
+	m.Uint64(backupTagR, uint64(database.ScryptR))
+	m.Uint64(backupTagP, uint64(database.ScryptP))
+	m.Bytes(backupTagContents, sealed)
+	m.Bytes(backupTagChecksum, sum[:])
+
+	return m.Marshal(backupVersion), nil
+}
+
+// readBackup checks and decrypts an archive made by ExportBackup
+func readBackup(data []byte, passphrase string) (*backupContents, error) {
+	version, fields, _, err := marshal.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("Not a wallet backup: %s", err.Error())
+	}
+	if version > backupVersion {
+		return nil, fmt.Errorf("The backup is version %d, this wallet can only read up to version %d", version, backupVersion)
+	}
+
+	var typ string
+	var salt, sealed, sum []byte
+	var n, r, p uint64
+	for _, f := range fields {
+		switch f.Tag {
+		case backupTagType:
+			typ = f.String()
+		case backupTagSalt:
+			salt = f.Data
+		case backupTagN:
+			n, err = f.Uint64()
+		case backupTagR:
+			r, err = f.Uint64()
+		case backupTagP:
+			p, err = f.Uint64()
+		case backupTagContents:
+			sealed = f.Data
+		case backupTagChecksum:
+			sum = f.Data
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if typ != backupType {
+		return nil, fmt.Errorf("Not a wallet backup")
+	}
+
+	check := sha256.Sum256(sealed)
+	if !bytes.Equal(check[:], sum) {
+		return nil, fmt.Errorf("The backup is corrupted, the checksum does not match")
+	}
+
+	key, err := database.DeriveKey(passphrase, salt, int(n), int(r), int(p))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := database.Decrypt(key, sealed, []byte(backupType))
+	if err != nil {
+		return nil, fmt.Errorf("Incorrect passphrase for the backup")
+	}
+
+	c := new(backupContents)
+	err = json.Unmarshal(plain, c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ImportBackup restores an archive made by ExportBackup.
+// When merging, everything in the backup is added to the current wallet and the current
+// seed, names and settings win any conflict. When replacing, the seed, names and settings
+// of the backup are used instead. Private keys are never removed from the wallet, so keys
+// not in the backup are kept either way. The backup of a watch-only wallet can only be
+// restored into a watch-only wallet, and the backup of any other wallet into any other.
+func (w *WalletDB) ImportBackup(data []byte, passphrase string, replace bool) (*RestoreReport, error) {
+	if err := w.checkUnlocked(); err != nil {
+		return nil, err
+	}
+
+	c, err := readBackup(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if c.WatchOnly && !w.IsWatchOnly() {
+		return nil, fmt.Errorf("The backup is of a watch-only wallet, it can only be restored into a watch-only wallet")
+	}
+	if !c.WatchOnly && w.IsWatchOnly() {
+		return nil, ErrWatchOnly
+	}
+
+	w.SnapshotBefore("restore-backup")
+
+	report := new(RestoreReport)
+	report.Replaced = replace
+
+	var seeded bool
+	if c.WatchOnly {
+		err = w.restorePublicKeys(c.PublicKeys, report)
+	} else {
+		seeded, err = w.restoreKeys(c, replace, report)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Names
+	if replace {
+		w.guiWallet.Reset()
+	}
+	lists := [][]address.AddressNamePair{c.FactoidAddresses, c.EntryCreditAddresses, c.ExternalAddresses}
+	for i, list := range lists {
+		for _, anp := range list {
+			w.restoreName(anp, i+1, seeded, report)
+		}
+	}
+
+	if replace {
+		report.Settings = c.Settings
+	}
+
+	// Keys in the wallet the backup did not name
+	err = w.UpdateGUIDB()
+	if err != nil {
+		return nil, err
+	}
+
+	// The addresses, and maybe the seed, have changed
+	w.InvalidateTransactionCache()
+
+	return report, w.Save()
+}
+
+// restoreKeys restores the seed and private keys of a backup. It returns true if the seeded
+// addresses of the backup are seeded by the seed of the wallet after the restore.
+func (w *WalletDB) restoreKeys(c *backupContents, replace bool, report *RestoreReport) (bool, error) {
+	current, err := w.Wallet.GetDBSeed()
+	if err != nil {
+		return false, err
+	}
+	sameSeed := current.MnemonicSeed == c.Seed.MnemonicSeed
+
+	switch {
+	case sameSeed:
+		// Keep whichever has handed out more addresses
+		if c.Seed.NextFactoidAddressIndex > current.NextFactoidAddressIndex || c.Seed.NextECAddressIndex > current.NextECAddressIndex {
+			seed := *current
+			if c.Seed.NextFactoidAddressIndex > seed.NextFactoidAddressIndex {
+				seed.NextFactoidAddressIndex = c.Seed.NextFactoidAddressIndex
+			}
+			if c.Seed.NextECAddressIndex > seed.NextECAddressIndex {
+				seed.NextECAddressIndex = c.Seed.NextECAddressIndex
+			}
+			if err = w.Wallet.InsertDBSeed(&seed); err != nil {
+				return false, err
+			}
+		}
+	case replace:
+		seed := c.Seed
+		if err = w.Wallet.InsertDBSeed(&seed); err != nil {
+			return false, err
+		}
+	default:
+		report.conflict("", "Current seed", "Backup seed", "Kept the current seed, addresses of the backup seed are imported as keys")
+	}
+
+	// Keys
+	for _, sec := range c.FactoidKeys {
+		add, err := factom.GetFactoidAddress(sec)
+		if err != nil {
+			return false, err
+		}
+		if _, list := w.GetGUIAddress(add.String()); list == 1 {
+			continue
+		}
+		if err = w.Wallet.InsertFCTAddress(add); err != nil {
+			return false, err
+		}
+		report.KeysAdded++
+	}
+	for _, sec := range c.ECKeys {
+		add, err := factom.GetECAddress(sec)
+		if err != nil {
+			return false, err
+		}
+		if _, list := w.GetGUIAddress(add.String()); list == 2 {
+			continue
+		}
+		if err = w.Wallet.InsertECAddress(add); err != nil {
+			return false, err
+		}
+		report.KeysAdded++
+	}
+
+	return sameSeed || replace, nil
+}
+
+// restorePublicKeys adds the public keys of a watch-only backup the wallet does not have
+func (w *WalletDB) restorePublicKeys(keys []PublicKey, report *RestoreReport) error {
+	current, err := w.watchKeys()
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if current[k.Address] != nil {
+			continue
+		}
+		pub, err := hex.DecodeString(k.PublicKey)
+		if err != nil {
+			return fmt.Errorf("The public key of %s is not hex", k.Address)
+		}
+		addr, err := publicKeyAddress(pub, k.List)
+		if err != nil {
+			return err
+		}
+		if addr != k.Address {
+			return fmt.Errorf("The public key of %s is for %s", k.Address, addr)
+		}
+		k := k
+		err = w.GUIlDB.Put(watchKeysBucket, []byte(k.Address), &k)
+		if err != nil {
+			return err
+		}
+		report.KeysAdded++
+	}
+	return nil
+}
+
+// restoreName adds the name of an address from a backup, if it does not conflict
+func (w *WalletDB) restoreName(anp address.AddressNamePair, list int, seeded bool, report *RestoreReport) {
+	existing, existingList, _ := w.guiWallet.GetAddress(anp.Address)
+	if existingList != -1 {
+		if existing.Name != anp.Name {
+			report.conflict(anp.Address, existing.Name, anp.Name, "Kept the current name")
+		} else if existingList != list {
+			report.conflict(anp.Address, listName(existingList), listName(list), "Kept the address where it is")
+		}
+		return
+	}
+
+	var err error
+	if anp.Seeded && seeded {
+		_, err = w.guiWallet.AddSeededAddress(anp.Name, anp.Address, list)
+	} else {
+		_, err = w.guiWallet.AddAddress(anp.Name, anp.Address, list)
+	}
+	if err != nil {
+		report.conflict(anp.Address, "", anp.Name, "Not restored: "+err.Error())
+		return
+	}
+	if list == 1 && anp.HasPolicy() {
+		w.guiWallet.SetAddressPolicy(anp.Address, anp.Frozen, anp.Reserved, anp.MinBalance)
+	}
+	report.AddressesAdded++
+}
+
+func listName(list int) string {
+	switch list {
+	case 1:
+		return "Factoid addresses"
+	case 2:
+		return "Entry Credit addresses"
+	case 3:
+		return "Address book"
+	}
+	return "Not found"
+}
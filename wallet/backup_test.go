@@ -0,0 +1,72 @@
+package wallet_test
+
+import (
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	err := LoadTestWallet(8089)
+	defer StopTestWallet(true)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	anp, err := TestWallet.GenerateFactoidAddress("BackupMe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := TestWallet.ExportBackup("passphrase", []byte("settings"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = TestWallet.ImportBackup(data, "wrong", false)
+	if err == nil {
+		t.Fatal("Restored with the wrong passphrase")
+	}
+
+	// Corrupt the encrypted contents
+	bad := make([]byte, len(data))
+	copy(bad, data)
+	bad[len(bad)/2] ^= 0xFF
+	_, err = TestWallet.ImportBackup(bad, "passphrase", false)
+	if err == nil {
+		t.Fatal("Restored a corrupted backup")
+	}
+
+	// Merging into the same wallet adds nothing
+	report, err := TestWallet.ImportBackup(data, "passphrase", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.AddressesAdded != 0 || len(report.Conflicts) != 0 || report.Settings != nil {
+		t.Fatalf("Merging the same wallet should change nothing, %d added and %d conflicts", report.AddressesAdded, len(report.Conflicts))
+	}
+
+	// A renamed address conflicts when merged
+	err = TestWallet.ChangeAddressName(anp.Address, "Renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = TestWallet.ImportBackup(data, "passphrase", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Conflicts) != 1 || report.Conflicts[0].Address != anp.Address {
+		t.Fatal("Expected a conflict on the renamed address")
+	}
+
+	// Replacing brings back the old name and the settings
+	report, err = TestWallet.ImportBackup(data, "passphrase", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(report.Settings) != "settings" {
+		t.Fatal("Settings not returned on replace")
+	}
+	restored, list := TestWallet.GetGUIAddress(anp.Address)
+	if list != 1 || restored.Name != "BackupMe" {
+		t.Fatal("Name not restored on replace")
+	}
+}
@@ -0,0 +1,366 @@
+package wallet
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/FactomProject/enterprise-wallet/fct"
+	"github.com/FactomProject/factom"
+)
+
+// A batch pays many recipients at once, such as a payroll. The payouts are read from a CSV,
+// and split over as many transactions as needed to keep each one small. Every transaction
+// is a signed draft, so the batch can be looked over before it is sent. Batches are only
+// kept in memory; after a restart, the drafts of a batch that was not sent are still there.
+
+var (
+	// BatchMaxOutputs is the most payouts put in one transaction of a batch
+	BatchMaxOutputs = 100
+	// BatchMaxInputs is the most inputs one transaction of a batch may use
+	BatchMaxInputs = 10
+	// BatchMaxFee is the largest fee, in factoshis, one transaction of a batch may pay
+	BatchMaxFee uint64 = 1e8
+)
+
+// ErrBatchNotFound is returned when no batch has the ID given
+var ErrBatchNotFound = errors.New("No batch found with that ID. It may have been sent or deleted.")
+
+var errBatchTooBig = errors.New("Transaction too big for a batch")
+
+// Payout is one row of a batch
+type Payout struct {
+	Line    int // The line of the CSV it came from
+	Address string
+	Amount  uint64 // Factoshis to a factoid address, entry credits to an entry credit address
+	Memo    string
+}
+
+// BatchTransaction is one transaction of a batch
+type BatchTransaction struct {
+	DraftID string
+	Payouts []Payout
+	Inputs  []AddressBalancePair
+	Total   uint64
+	Fee     uint64
+	TxID    string // Set once it is sent
+	Error   string // Why it could not be sent
+}
+
+// Batch is a set of transactions that are sent together
+type Batch struct {
+	ID           string
+	Created      int64 // Unix time
+	Transactions []*BatchTransaction
+	Total        uint64
+	Fee          uint64
+}
+
+// Sent is true once every transaction of the batch has been sent
+func (b *Batch) Sent() bool {
+	for _, t := range b.Transactions {
+		if t.TxID == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Batch) copy() *Batch {
+	c := *b
+	c.Transactions = make([]*BatchTransaction, len(b.Transactions))
+	for i, t := range b.Transactions {
+		tc := *t
+		c.Transactions[i] = &tc
+	}
+	return &c
+}
+
+// ParsePayoutCSV reads payouts from a CSV with a row for each: address, amount, and an
+// optional memo or name. Factoid amounts are in FCT, entry credit amounts in entry credits.
+// A header row is skipped. Every row is checked, and the error lists each bad row.
+func ParsePayoutCSV(r io.Reader) ([]Payout, error) {
+	var payouts []Payout
+	var problems []string
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		reader := csv.NewReader(strings.NewReader(text))
+		reader.TrimLeadingSpace = true
+		record, err := reader.Read()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Line %d: %s", line, err.Error()))
+			continue
+		}
+
+		if len(payouts) == 0 && len(problems) == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "address") {
+			continue
+		}
+
+		p, err := parsePayout(record)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Line %d: %s", line, err.Error()))
+			continue
+		}
+		p.Line = line
+		payouts = append(payouts, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%d rows are not valid\n%s", len(problems), strings.Join(problems, "\n"))
+	}
+	if len(payouts) == 0 {
+		return nil, fmt.Errorf("No payouts found")
+	}
+	return payouts, nil
+}
+
+func parsePayout(record []string) (Payout, error) {
+	var p Payout
+	if len(record) < 2 || len(record) > 3 {
+		return p, fmt.Errorf("Expected an address, an amount and an optional memo, found %d columns", len(record))
+	}
+
+	p.Address = strings.TrimSpace(record[0])
+	if !factom.IsValidAddress(p.Address) || (p.Address[:2] != "FA" && p.Address[:2] != "EC") {
+		return p, fmt.Errorf("%s is not a valid public address", p.Address)
+	}
+
+	amts, err := StringAmountsToUin64Amounts([]string{p.Address}, []string{strings.TrimSpace(record[1])})
+	if err != nil {
+		return p, err
+	}
+	if amts[0] == 0 {
+		return p, fmt.Errorf("The amount must be more than 0")
+	}
+	p.Amount = amts[0]
+
+	if len(record) == 3 {
+		p.Memo = strings.TrimSpace(record[2])
+	}
+	return p, nil
+}
+
+// ConstructBatch puts the payouts into signed transactions, choosing the inputs with the
+// named coin selector. No name is the DefaultCoinSelector. Nothing is sent until SendBatch.
+func (wal *WalletDB) ConstructBatch(payouts []Payout, coinSelection string) (*Batch, error) {
+	if len(payouts) == 0 {
+		return nil, fmt.Errorf("No payouts given")
+	}
+	if err := wal.checkUnlocked(); err != nil {
+		return nil, err
+	}
+	if err := wal.checkSecrets(); err != nil {
+		return nil, err
+	}
+	selector, err := GetCoinSelector(coinSelection)
+	if err != nil {
+		return nil, err
+	}
+	rate, err := getRate()
+	if err != nil {
+		return nil, err
+	}
+
+	// What is left to spend goes down with each transaction, as none are sent yet
+	remaining, err := wal.spendableBalances(false)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := newDraftID()
+	if err != nil {
+		return nil, err
+	}
+	b := &Batch{ID: id, Created: time.Now().Unix()}
+
+	var queue [][]Payout
+	for i := 0; i < len(payouts); i += BatchMaxOutputs {
+		end := i + BatchMaxOutputs
+		if end > len(payouts) {
+			end = len(payouts)
+		}
+		queue = append(queue, payouts[i:end])
+	}
+
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+
+		t, err := wal.batchTransaction(next, &remaining, selector, rate)
+		if err == errBatchTooBig && len(next) > 1 {
+			half := len(next) / 2
+			queue = append([][]Payout{next[:half], next[half:]}, queue...)
+			continue
+		}
+		if err != nil {
+			for _, t := range b.Transactions {
+				wal.DeleteDraft(t.DraftID)
+			}
+			if err == errBatchTooBig {
+				err = fmt.Errorf("The payout on line %d needs more than %d inputs or a fee of more than %s FCT",
+					next[0].Line, BatchMaxInputs, fct.Amount(BatchMaxFee))
+			}
+			return nil, err
+		}
+		b.Transactions = append(b.Transactions, t)
+		b.Total += t.Total
+		b.Fee += t.Fee
+	}
+
+	for i, t := range b.Transactions {
+		wal.UpdateDraft(t.DraftID, fmt.Sprintf("Batch %s, %d of %d", id[:8], i+1, len(b.Transactions)))
+	}
+
+	wal.batchLock.Lock()
+	if wal.batches == nil {
+		wal.batches = make(map[string]*Batch)
+	}
+	wal.batches[id] = b
+	wal.batchLock.Unlock()
+	return b.copy(), nil
+}
+
+// batchTransaction constructs the transaction for some payouts, and takes what it spends
+// from the remaining balances
+func (wal *WalletDB) batchTransaction(payouts []Payout, remaining *[]AddressBalancePair, selector CoinSelector, rate uint64) (*BatchTransaction, error) {
+	var toAddresses []string
+	var toAmounts []uint64
+	var total uint64
+	for _, p := range payouts {
+		toAddresses = append(toAddresses, p.Address)
+		toAmounts = append(toAmounts, p.Amount)
+		if p.Address[:2] == "EC" {
+			total += p.Amount * rate
+		} else {
+			total += p.Amount
+		}
+	}
+
+	fees := feeFunc(toAddresses, toAmounts, *remaining, rate)
+	inputs, err := selector.Select(*remaining, total, fees)
+	if err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, ErrNotEnoughFactoids
+	}
+	if len(inputs) > BatchMaxInputs {
+		return nil, errBatchTooBig
+	}
+	if fee, err := fees(len(inputs)); err != nil {
+		return nil, err
+	} else if fee > BatchMaxFee {
+		return nil, errBatchTooBig
+	}
+
+	// The last input pays the fee
+	inputs, err = payInputs(inputs, total)
+	if err != nil {
+		return nil, err
+	}
+	var fromAddresses []string
+	var fromAmounts []uint64
+	for _, in := range inputs {
+		fromAddresses = append(fromAddresses, in.Address)
+		fromAmounts = append(fromAmounts, in.Balance)
+	}
+
+	feeAddress := fromAddresses[len(fromAddresses)-1]
+	draft, r, err := wal.ConstructTransactionFromValues("", toAddresses, toAmounts, fromAddresses, fromAmounts, feeAddress, true)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &BatchTransaction{DraftID: draft, Payouts: payouts, Total: r.Total, Fee: r.Fee}
+	spent := make(map[string]uint64)
+	for i, addr := range fromAddresses {
+		spent[addr] += fromAmounts[i]
+		t.Inputs = append(t.Inputs, AddressBalancePair{addr, fromAmounts[i]})
+	}
+	spent[feeAddress] += r.Fee
+	t.Inputs[len(t.Inputs)-1].Balance += r.Fee
+
+	var rest []AddressBalancePair
+	for _, a := range *remaining {
+		if spent[a.Address] < a.Balance {
+			a.Balance -= spent[a.Address]
+			rest = append(rest, a)
+		}
+	}
+	*remaining = rest
+	return t, nil
+}
+
+// GetBatch returns a batch that has not been sent
+func (wal *WalletDB) GetBatch(id string) (*Batch, error) {
+	wal.batchLock.Lock()
+	defer wal.batchLock.Unlock()
+	b, ok := wal.batches[id]
+	if !ok {
+		return nil, ErrBatchNotFound
+	}
+	return b.copy(), nil
+}
+
+// SendBatch sends every transaction of a batch that has not been sent. It stops at the first
+// that fails, so it can be sent again once the problem is fixed. Once every transaction is
+// sent, the batch is forgotten.
+func (wal *WalletDB) SendBatch(id string) (*Batch, error) {
+	wal.batchLock.Lock()
+	defer wal.batchLock.Unlock()
+	b, ok := wal.batches[id]
+	if !ok {
+		return nil, ErrBatchNotFound
+	}
+
+	var err error
+	for _, t := range b.Transactions {
+		if t.TxID != "" {
+			continue
+		}
+		t.TxID, err = wal.SendTransaction(t.DraftID)
+		if err != nil {
+			t.Error = err.Error()
+			break
+		}
+		t.Error = ""
+	}
+
+	if b.Sent() {
+		delete(wal.batches, id)
+	}
+	return b.copy(), err
+}
+
+// DeleteBatch removes a batch, and the drafts of its transactions that were not sent
+func (wal *WalletDB) DeleteBatch(id string) error {
+	wal.batchLock.Lock()
+	defer wal.batchLock.Unlock()
+	b, ok := wal.batches[id]
+	if !ok {
+		return ErrBatchNotFound
+	}
+
+	for _, t := range b.Transactions {
+		if t.TxID == "" && wal.IsDraft(t.DraftID) {
+			wal.DeleteDraft(t.DraftID)
+		}
+	}
+	delete(wal.batches, id)
+	return nil
+}
@@ -0,0 +1,48 @@
+package wallet_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+func TestParsePayoutCSV(t *testing.T) {
+	csv := `address, amount, memo
+# Payroll
+FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1Q,12.5,"Smith, Alice"
+
+EC2SDU3UhBwrBR2q7jbFAbxnqUW6s5Z2cX6cakdQ6U53uSLRoPLR,1000
+`
+	payouts, err := ParsePayoutCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payouts) != 2 {
+		t.Fatalf("Expected 2 payouts, found %d", len(payouts))
+	}
+	if payouts[0].Amount != 1250000000 || payouts[0].Memo != "Smith, Alice" || payouts[0].Line != 3 {
+		t.Errorf("First payout read wrong: %v", payouts[0])
+	}
+	if payouts[1].Amount != 1000 || payouts[1].Line != 5 {
+		t.Errorf("Second payout read wrong: %v", payouts[1])
+	}
+
+	bad := `FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1Q,one
+FAbad,1
+EC2SDU3UhBwrBR2q7jbFAbxnqUW6s5Z2cX6cakdQ6U53uSLRoPLR,0
+FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1Q,1
+`
+	_, err = ParsePayoutCSV(strings.NewReader(bad))
+	if err == nil {
+		t.Fatal("Bad rows were accepted")
+	}
+	for _, line := range []string{"Line 1", "Line 2", "Line 3"} {
+		if !strings.Contains(err.Error(), line) {
+			t.Errorf("%s is not in the error: %s", line, err.Error())
+		}
+	}
+	if strings.Contains(err.Error(), "Line 4") {
+		t.Errorf("A good row is in the error: %s", err.Error())
+	}
+}
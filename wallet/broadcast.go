@@ -0,0 +1,493 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factomd/common/factoid"
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// Every transaction the wallet sends is recorded with its signed bytes, and factomd is asked
+// about it until it is in a directory block. A transaction factomd still does not have in a
+// block after BROADCAST_TIMEOUT has failed. A failed transaction can still get into a block,
+// so factomd is asked about it every BROADCAST_FAILED_POLL_INTERVAL instead. If factomd
+// cannot be reached, nothing changes.
+//	pending:		Sent, factomd has not acknowledged it
+//	acknowledged:	Factomd acknowledged it, it is not in a block yet
+//	confirmed:		In a directory block
+//	failed:			Not in a block in time, until it is
+
+var broadcastsBucket = []byte("broadcasts")
+
+const (
+	BroadcastPending      string = "pending"
+	BroadcastAcknowledged string = "acknowledged"
+	BroadcastConfirmed    string = "confirmed"
+	BroadcastFailed       string = "failed"
+)
+
+var (
+	// BROADCAST_POLL_INTERVAL is how often factomd is asked about transactions not in a block
+	BROADCAST_POLL_INTERVAL time.Duration = 30 * time.Second
+	// BROADCAST_FAILED_POLL_INTERVAL is how often factomd is asked about failed transactions
+	BROADCAST_FAILED_POLL_INTERVAL time.Duration = 10 * time.Minute
+	// BROADCAST_TIMEOUT is how long a transaction has to get into a block before it has failed
+	BROADCAST_TIMEOUT time.Duration = time.Hour
+	// BROADCAST_RETENTION is how long a transaction is kept once it is confirmed or failed
+	BROADCAST_RETENTION time.Duration = 30 * 24 * time.Hour
+)
+
+// ErrBroadcastNotFound is returned when the wallet did not send a transaction with the ID given
+var ErrBroadcastNotFound = errors.New("The wallet has no record of sending a transaction with that ID")
+
+// Broadcast is a transaction the wallet has sent
+type Broadcast struct {
+	TxID      string
+	Raw       string // Hex of the signed transaction
+	Sent      int64  // Unix time
+	Checked   int64  // Unix time factomd was last asked about it
+	Status    string
+	BlockDate int64  // Unix time of the directory block it is in, once confirmed
+	Error     string // Why it failed
+
+	Rebroadcasts int    // Times it was sent again
+	ReplacedBy   string // The transaction sent to cancel it
+}
+
+func (b *Broadcast) MarshalBinary() ([]byte, error) {
+	return json.Marshal(b)
+}
+
+func (b *Broadcast) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	err = json.Unmarshal(data, b)
+	return nil, err
+}
+
+func (b *Broadcast) UnmarshalBinary(data []byte) error {
+	_, err := b.UnmarshalBinaryData(data)
+	return err
+}
+
+func (b *Broadcast) New() interfaces.BinaryMarshallableAndCopyable {
+	return new(Broadcast)
+}
+
+// Final is true once the status will not change. A failed transaction can still be confirmed.
+func (b *Broadcast) Final() bool {
+	return b.Status == BroadcastConfirmed
+}
+
+// due is true if factomd should be asked about the transaction
+func (b *Broadcast) due(now time.Time) bool {
+	if b.Final() {
+		return false
+	}
+	if b.Status == BroadcastFailed {
+		return now.Sub(time.Unix(b.Checked, 0)) >= BROADCAST_FAILED_POLL_INTERVAL
+	}
+	return true
+}
+
+// Transaction returns the transaction that was sent
+func (b *Broadcast) Transaction() (*factoid.Transaction, error) {
+	raw, err := hex.DecodeString(b.Raw)
+	if err != nil {
+		return nil, err
+	}
+	t := new(factoid.Transaction)
+	err = t.UnmarshalBinary(raw)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Broadcasts is used for sorting, newest first
+type Broadcasts []Broadcast
+
+func (slice Broadcasts) Len() int {
+	return len(slice)
+}
+
+func (slice Broadcasts) Less(i, j int) bool {
+	return slice[i].Sent > slice[j].Sent
+}
+
+func (slice Broadcasts) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+type broadcastTracker struct {
+	stop chan struct{}
+	done chan struct{} // Closed once the tracker has stopped
+	sync.Mutex
+}
+
+// recordBroadcast starts tracking a transaction that was just sent
+func (w *WalletDB) recordBroadcast(txid string, t *factoid.Transaction) error {
+	raw, err := t.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return w.recordRawBroadcast(txid, hex.EncodeToString(raw))
+}
+
+// recordRawBroadcast starts tracking a transaction that was just sent, given its signed bytes in hex
+func (w *WalletDB) recordRawBroadcast(txid string, raw string) error {
+	b := &Broadcast{TxID: txid, Raw: raw, Sent: time.Now().Unix(), Status: BroadcastPending}
+	w.broadcastLock.Lock()
+	defer w.broadcastLock.Unlock()
+	return w.GUIlDB.Put(broadcastsBucket, []byte(txid), b)
+}
+
+func (w *WalletDB) getBroadcast(txid string) (*Broadcast, error) {
+	data, err := w.GUIlDB.Get(broadcastsBucket, []byte(txid), new(Broadcast))
+	if err != nil {
+		return nil, err
+	}
+	b, ok := data.(*Broadcast)
+	if !ok || b == nil {
+		return nil, ErrBroadcastNotFound
+	}
+	return b, nil
+}
+
+// GetBroadcast returns a transaction the wallet sent. If it is not confirmed, factomd is
+// asked about it first.
+func (w *WalletDB) GetBroadcast(txid string) (*Broadcast, error) {
+	w.broadcastLock.Lock()
+	defer w.broadcastLock.Unlock()
+
+	b, err := w.getBroadcast(txid)
+	if err != nil {
+		return nil, err
+	}
+	if !b.Final() && w.checkBroadcast(b, time.Now()) {
+		err = w.GUIlDB.Put(broadcastsBucket, []byte(b.TxID), b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// ListBroadcasts returns every transaction the wallet has sent and still tracks, newest first
+func (w *WalletDB) ListBroadcasts() ([]Broadcast, error) {
+	w.broadcastLock.Lock()
+	defer w.broadcastLock.Unlock()
+	return w.listBroadcasts()
+}
+
+func (w *WalletDB) listBroadcasts() ([]Broadcast, error) {
+	all, _, err := w.GUIlDB.GetAll(broadcastsBucket, new(Broadcast))
+	if err != nil {
+		return nil, err
+	}
+
+	list := make(Broadcasts, 0, len(all))
+	for _, data := range all {
+		if b, ok := data.(*Broadcast); ok {
+			list = append(list, *b)
+		}
+	}
+	sort.Sort(list)
+	return list, nil
+}
+
+type factoidAck struct {
+	TxID      string `json:"txid"`
+	BlockDate int64  `json:"blockdate"` // Milliseconds
+	Status    string `json:"status"`
+}
+
+// askFactomd returns what factomd says about a transaction
+func askFactomd(b *Broadcast) (*factoidAck, error) {
+	params := map[string]string{"txid": b.TxID, "fulltransaction": b.Raw}
+	resp, err := sendFactomdRequest(factom.NewJSON2Request("factoid-ack", factom.APICounter(), params))
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	result, err := resp.Result.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	ack := new(factoidAck)
+	err = json.Unmarshal(result, ack)
+	if err != nil {
+		return nil, err
+	}
+	return ack, nil
+}
+
+// checkBroadcast asks factomd about a transaction, and updates its status. Returns true
+// if anything changed.
+func (w *WalletDB) checkBroadcast(b *Broadcast, now time.Time) bool {
+	ack, err := askFactomd(b)
+	if err != nil {
+		// Factomd is down, wait for it
+		return false
+	}
+	b.update(ack, now)
+	return true
+}
+
+// update sets the status from what factomd said about the transaction
+func (b *Broadcast) update(ack *factoidAck, now time.Time) {
+	b.Checked = now.Unix()
+	switch ack.Status {
+	case "DBlockConfirmed":
+		// Even if it failed, it made it
+		b.Status = BroadcastConfirmed
+		b.BlockDate = ack.BlockDate / 1000
+		b.Error = ""
+	case "TransactionACK":
+		b.Status = BroadcastAcknowledged
+	}
+	if !b.Final() && now.Sub(time.Unix(b.Sent, 0)) > BROADCAST_TIMEOUT {
+		b.Status = BroadcastFailed
+		b.Error = fmt.Sprintf("Not in a block after %s. Factomd last said: %s", BROADCAST_TIMEOUT.String(), ack.Status)
+	}
+}
+
+// RebroadcastTransaction sends the signed bytes of a transaction that is not confirmed to
+// factomd again. It is given another BROADCAST_TIMEOUT to get into a block.
+func (w *WalletDB) RebroadcastTransaction(txid string) (*Broadcast, error) {
+	w.broadcastLock.Lock()
+	defer w.broadcastLock.Unlock()
+
+	b, err := w.getBroadcast(txid)
+	if err != nil {
+		return nil, err
+	}
+	if b.Status == BroadcastConfirmed {
+		return nil, fmt.Errorf("The transaction is already in a block")
+	}
+
+	params := map[string]string{"transaction": b.Raw}
+	_, err = submitTransaction(factom.NewJSON2Request("factoid-submit", factom.APICounter(), params))
+	if err != nil {
+		return nil, err
+	}
+
+	b.Status = BroadcastPending
+	b.Error = ""
+	b.Sent = time.Now().Unix()
+	b.Rebroadcasts++
+	err = w.GUIlDB.Put(broadcastsBucket, []byte(b.TxID), b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// CancelTransaction sends the inputs of a transaction that is not confirmed back to an
+// address in the wallet, less the fee. No address sends them to the first input. Factomd
+// is asked about the transaction first, and it is not cancelled if factomd has it, or
+// cannot be asked. Factoid addresses hold balances, not coins, so the transaction cancelled
+// can still get into a block if its inputs can pay for both.
+func (w *WalletDB) CancelTransaction(txid string, toAddress string) (newTxid string, r *ReturnTransStruct, err error) {
+	b, err := w.cancellable(txid)
+	if err != nil {
+		return "", nil, err
+	}
+	t, err := b.Transaction()
+	if err != nil {
+		return "", nil, err
+	}
+
+	var fromAddresses []string
+	var fromAmounts []uint64
+	var total uint64
+	for _, in := range t.GetInputs() {
+		addr := primitives.ConvertFctAddressToUserStr(in.GetAddress())
+		if anp, list := w.GetGUIAddress(addr); list != 1 || anp == nil {
+			return "", nil, fmt.Errorf("The input %s is not one of your factoid addresses", addr)
+		}
+		fromAddresses = append(fromAddresses, addr)
+		fromAmounts = append(fromAmounts, in.GetAmount())
+		total += in.GetAmount()
+	}
+	if len(fromAddresses) == 0 {
+		return "", nil, fmt.Errorf("The transaction has no inputs")
+	}
+
+	if toAddress == "" {
+		toAddress = fromAddresses[0]
+	}
+	if anp, list := w.GetGUIAddress(toAddress); list != 1 || anp == nil {
+		return "", nil, fmt.Errorf("%s is not one of your factoid addresses", toAddress)
+	}
+
+	// The output pays the fee
+	trans, r, err := w.ConstructTransactionFromValues("", []string{toAddress}, []uint64{total}, fromAddresses, fromAmounts, toAddress, true)
+	if err != nil {
+		return "", nil, err
+	}
+	newTxid, err = w.SendTransaction(trans)
+	if err != nil {
+		w.DeleteDraft(trans)
+		return "", nil, err
+	}
+
+	w.broadcastLock.Lock()
+	defer w.broadcastLock.Unlock()
+	if b, err := w.getBroadcast(txid); err == nil {
+		b.ReplacedBy = newTxid
+		w.GUIlDB.Put(broadcastsBucket, []byte(b.TxID), b)
+	}
+	return newTxid, r, nil
+}
+
+// cancellable returns a transaction the wallet sent, if factomd does not have it
+func (w *WalletDB) cancellable(txid string) (*Broadcast, error) {
+	w.broadcastLock.Lock()
+	defer w.broadcastLock.Unlock()
+
+	b, err := w.getBroadcast(txid)
+	if err != nil {
+		return nil, err
+	}
+	if b.Status == BroadcastConfirmed {
+		return nil, fmt.Errorf("The transaction is already in a block")
+	}
+
+	ack, err := askFactomd(b)
+	if err != nil {
+		return nil, fmt.Errorf("Factomd could not be asked if it has the transaction, it was not cancelled: %s", err.Error())
+	}
+	b.update(ack, time.Now())
+	err = w.GUIlDB.Put(broadcastsBucket, []byte(b.TxID), b)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ack.Status {
+	case "DBlockConfirmed":
+		return nil, fmt.Errorf("The transaction is already in a block")
+	case "TransactionACK":
+		return nil, fmt.Errorf("Factomd has acknowledged the transaction, it will get into a block and cannot be cancelled")
+	}
+	return b, nil
+}
+
+// StartBroadcastTracker asks factomd about the transactions not yet in a block every
+// BROADCAST_POLL_INTERVAL, until the wallet is closed
+func (w *WalletDB) StartBroadcastTracker() {
+	w.broadcastTracker.Lock()
+	defer w.broadcastTracker.Unlock()
+	if w.broadcastTracker.stop != nil {
+		return
+	}
+
+	w.broadcastTracker.stop = make(chan struct{})
+	w.broadcastTracker.done = make(chan struct{})
+	go func(stop chan struct{}, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(BROADCAST_POLL_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				w.checkBroadcasts(now)
+			case <-stop:
+				return
+			}
+		}
+	}(w.broadcastTracker.stop, w.broadcastTracker.done)
+}
+
+// stopBroadcastTracker stops the tracker, and waits for a check being made to finish, so
+// the databases are not closed under it
+func (w *WalletDB) stopBroadcastTracker() {
+	w.broadcastTracker.Lock()
+	defer w.broadcastTracker.Unlock()
+	if w.broadcastTracker.stop != nil {
+		close(w.broadcastTracker.stop)
+		<-w.broadcastTracker.done
+		w.broadcastTracker.stop, w.broadcastTracker.done = nil, nil
+	}
+}
+
+// checkBroadcasts updates the transactions not in a block that are due, and forgets the old ones
+func (w *WalletDB) checkBroadcasts(now time.Time) {
+	w.broadcastLock.Lock()
+	defer w.broadcastLock.Unlock()
+
+	list, err := w.listBroadcasts()
+	if err != nil {
+		fmt.Printf("Could not load the sent transactions: %s\n", err.Error())
+		return
+	}
+
+	for i := range list {
+		b := &list[i]
+		if (b.Final() || b.Status == BroadcastFailed) && now.Sub(time.Unix(b.Sent, 0)) > BROADCAST_RETENTION {
+			w.GUIlDB.Delete(broadcastsBucket, []byte(b.TxID))
+			continue
+		}
+		if !b.due(now) {
+			continue
+		}
+		if w.checkBroadcast(b, now) {
+			err = w.GUIlDB.Put(broadcastsBucket, []byte(b.TxID), b)
+			if err != nil {
+				fmt.Printf("Could not save the status of %s: %s\n", b.TxID, err.Error())
+			}
+		}
+	}
+}
+
+// AddPendingTransactions puts the transactions the wallet sent that are not in the list yet,
+// as they are not in a block the transaction database has, at the front of it. Their
+// status says how far they got.
+func (w *WalletDB) AddPendingTransactions(list []DisplayTransaction) []DisplayTransaction {
+	sent, err := w.ListBroadcasts()
+	if err != nil || len(sent) == 0 {
+		return list
+	}
+	if len(list) == 1 && list[0].TxID == "empty" {
+		list = nil
+	}
+
+	inList := make(map[string]bool)
+	for _, dt := range list {
+		inList[dt.TxID] = true
+	}
+
+	w.relatedTransactionLock.Lock() // Display transactions use the address cache
+	defer w.relatedTransactionLock.Unlock()
+
+	var pending []DisplayTransaction
+	for _, b := range sent {
+		if inList[b.TxID] {
+			continue
+		}
+		t, err := b.Transaction()
+		if err != nil {
+			continue
+		}
+		dt, err := w.NewDisplayTransaction(t)
+		if err != nil {
+			continue
+		}
+		dt.TxID = b.TxID
+		dt.Status = b.Status
+		pending = append(pending, *dt)
+	}
+	if len(pending) == 0 && len(list) == 0 {
+		empty := DisplayTransaction{TxID: "empty"}
+		return []DisplayTransaction{empty}
+	}
+	return append(pending, list...)
+}
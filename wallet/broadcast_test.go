@@ -0,0 +1,144 @@
+package wallet_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet"
+	"github.com/FactomProject/factom"
+)
+
+// fakeFactomd answers factoid-ack with the status given, and counts factoid-submit requests
+type fakeFactomd struct {
+	status    string // Of every transaction, "" is unreachable
+	submitted int
+}
+
+func (f *fakeFactomd) request(req *factom.JSON2Request) (*factom.JSON2Response, error) {
+	if f.status == "" {
+		return nil, fmt.Errorf("connection refused")
+	}
+	params, _ := req.Params.(map[string]string)
+	var result string
+	switch req.Method {
+	case "factoid-ack":
+		result = fmt.Sprintf(`{"txid":"%s","blockdate":1500000000000,"status":"%s"}`, params["txid"], f.status)
+	case "factoid-submit":
+		f.submitted++
+		result = `{"message":"Successfully submitted the transaction","txid":"submitted"}`
+	default:
+		return nil, fmt.Errorf("Unexpected request %s", req.Method)
+	}
+	return &factom.JSON2Response{JSONRPC: "2.0", Result: json.RawMessage(result)}, nil
+}
+
+func TestRebroadcastAndCancel(t *testing.T) {
+	defer UseTempDataDir(t)()
+
+	wal, err := NewWalletDB(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+
+	factomd := &fakeFactomd{status: "NotConfirmed"}
+	defer StubFactomd(factomd.request)()
+
+	txid := strings.Repeat("ab", 32)
+	if err = wal.RecordRawBroadcast(txid, "00"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := wal.RebroadcastTransaction(txid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if factomd.submitted != 1 || b.Rebroadcasts != 1 || b.Status != BroadcastPending {
+		t.Errorf("Rebroadcast submitted %d times, %d recorded, status %s", factomd.submitted, b.Rebroadcasts, b.Status)
+	}
+
+	// Not cancelled while factomd cannot say if it has the transaction
+	factomd.status = ""
+	if _, _, err = wal.CancelTransaction(txid, ""); err == nil {
+		t.Error("Cancelled a transaction without asking factomd")
+	}
+
+	factomd.status = "TransactionACK"
+	if _, _, err = wal.CancelTransaction(txid, ""); err == nil {
+		t.Error("Cancelled a transaction factomd acknowledged")
+	}
+	if b, err = wal.GetBroadcast(txid); err != nil || b.Status != BroadcastAcknowledged {
+		t.Errorf("Expected the transaction acknowledged, found %v", b)
+	}
+
+	factomd.status = "DBlockConfirmed"
+	if _, _, err = wal.CancelTransaction(txid, ""); err == nil {
+		t.Error("Cancelled a transaction in a block")
+	}
+	if b, err = wal.GetBroadcast(txid); err != nil || b.Status != BroadcastConfirmed || b.BlockDate != 1500000000 {
+		t.Errorf("Expected the transaction confirmed, found %v", b)
+	}
+	if _, err = wal.RebroadcastTransaction(txid); err == nil {
+		t.Error("Rebroadcast a transaction in a block")
+	}
+	if factomd.submitted != 1 {
+		t.Errorf("Expected 1 transaction submitted, found %d", factomd.submitted)
+	}
+
+	if _, _, err = wal.CancelTransaction(strings.Repeat("cd", 32), ""); err != ErrBroadcastNotFound {
+		t.Error("Cancelled a transaction the wallet did not send")
+	}
+}
+
+func TestBroadcastStatus(t *testing.T) {
+	factomd := &fakeFactomd{status: "NotConfirmed"}
+	defer StubFactomd(factomd.request)()
+
+	start := time.Unix(1500000000, 0)
+	b := &Broadcast{TxID: strings.Repeat("ab", 32), Raw: "00", Sent: start.Unix(), Status: BroadcastPending}
+	check := func(at time.Time, status string) {
+		if !CheckBroadcast(b, at) {
+			t.Fatalf("%s: factomd was not asked", status)
+		}
+		if b.Status != status || b.Checked != at.Unix() {
+			t.Fatalf("Expected %s checked at %d, found %s checked at %d", status, at.Unix(), b.Status, b.Checked)
+		}
+	}
+
+	check(start.Add(time.Minute), BroadcastPending)
+	factomd.status = "TransactionACK"
+	check(start.Add(2*time.Minute), BroadcastAcknowledged)
+
+	failedAt := start.Add(BROADCAST_TIMEOUT + time.Minute)
+	check(failedAt, BroadcastFailed)
+	if b.Error == "" {
+		t.Error("A failed transaction has no error")
+	}
+
+	// Failed transactions are asked about less often
+	if b.Due(failedAt.Add(BROADCAST_POLL_INTERVAL)) {
+		t.Error("A failed transaction was due at the normal interval")
+	}
+	if !b.Due(failedAt.Add(BROADCAST_FAILED_POLL_INTERVAL)) {
+		t.Error("A failed transaction was never due")
+	}
+
+	// Nothing changes while factomd cannot be reached
+	factomd.status = ""
+	if CheckBroadcast(b, failedAt.Add(BROADCAST_FAILED_POLL_INTERVAL)) || b.Status != BroadcastFailed {
+		t.Errorf("Changed to %s without factomd", b.Status)
+	}
+
+	// A failed transaction that gets into a block is confirmed
+	factomd.status = "DBlockConfirmed"
+	check(failedAt.Add(BROADCAST_FAILED_POLL_INTERVAL), BroadcastConfirmed)
+	if b.Error != "" || b.BlockDate != 1500000000 || !b.Final() {
+		t.Errorf("Confirmed transaction has error '%s' and block date %d", b.Error, b.BlockDate)
+	}
+	if b.Due(failedAt.Add(time.Hour)) {
+		t.Error("A confirmed transaction was due")
+	}
+}
@@ -0,0 +1,552 @@
+package wallet
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/FactomProject/enterprise-wallet/address"
+	"github.com/FactomProject/enterprise-wallet/marshal"
+	"github.com/FactomProject/enterprise-wallet/wallet/database"
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factom/wallet"
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+// The check looks for problems in the databases of a wallet that is not running:
+//	- Every address name in the GUI database can be decoded, and is a valid address
+//	- Every named address with a private key has its key in the wallet database, and
+//	  every key in the wallet database has a name
+//	- The addresses flagged as seeded are made by the seed
+//	- The FBlocks in the transaction database form a chain, with nothing missing
+// The databases are opened read only, unless repairing.
+
+// CheckProblem is something wrong found by CheckDatabases
+type CheckProblem struct {
+	Database database.DBKind
+	Address  string // Empty if the problem is not with a single address
+	Problem  string
+	Repair   string // What repairing does, empty if it cannot be repaired
+	Repaired bool
+
+	fix func() error
+}
+
+// CheckReport is the result of CheckDatabases
+type CheckReport struct {
+	Notes    []string // What was checked, and what was not
+	Problems []CheckProblem
+}
+
+func (r *CheckReport) note(format string, a ...interface{}) {
+	r.Notes = append(r.Notes, fmt.Sprintf(format, a...))
+}
+
+func (r *CheckReport) problem(kind database.DBKind, add string, problem string, repair string, fix func() error) {
+	r.Problems = append(r.Problems, CheckProblem{Database: kind, Address: add, Problem: problem, Repair: repair, fix: fix})
+}
+
+// Unrepaired returns how many problems are left
+func (r *CheckReport) Unrepaired() int {
+	n := 0
+	for _, p := range r.Problems {
+		if !p.Repaired {
+			n++
+		}
+	}
+	return n
+}
+
+type checker struct {
+	report  *CheckReport
+	repair  bool
+	profile *Profile
+
+	// nil if not opened
+	guiDB    interfaces.IDatabase
+	walletDB interfaces.IDatabase // Without the encryption layer
+	txDB     interfaces.IDatabase
+
+	wal        *wallet.Wallet // nil if the keys cannot be read
+	gui        *WalletStruct  // nil if the names cannot be read
+	guiChanged bool
+}
+
+// CheckDatabases checks the databases of a profile, of the types in GUI_DB, WALLET_DB and
+// TX_DB. The wallet must not be running. If repair is set, a snapshot is taken and every
+// problem that can be repaired is. The passphrase is only asked for if the wallet is
+// encrypted, without it the private keys and seed cannot be checked.
+func CheckDatabases(p *Profile, repair bool, passphrase func() (string, error)) (*CheckReport, error) {
+	c := new(checker)
+	c.report = new(CheckReport)
+	c.repair = repair
+	c.profile = p
+	defer c.close()
+
+	c.guiDB = c.open(database.GUIDB, GUI_DB)
+	c.walletDB = c.open(database.WalletDB, WALLET_DB)
+	c.txDB = c.open(database.TXDB, TX_DB)
+
+	if c.walletDB != nil {
+		c.openWallet(passphrase)
+	}
+	if c.guiDB != nil {
+		c.checkNames()
+		c.checkJournal()
+	}
+	if c.gui != nil && c.wal != nil {
+		c.checkKeys()
+		c.checkSeeded()
+	}
+	if c.txDB != nil {
+		c.checkTransactions()
+	}
+
+	if repair {
+		err := c.repairAll()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.report, nil
+}
+
+// open opens an existing database, it never makes a new one
+func (c *checker) open(kind database.DBKind, backendName string) interfaces.IDatabase {
+	b, err := database.GetBackend(backendName)
+	if err != nil {
+		c.report.problem(kind, "", err.Error(), "", nil)
+		return nil
+	}
+	if err = b.CanHold(kind); err != nil {
+		c.report.problem(kind, "", err.Error(), "", nil)
+		return nil
+	}
+	if b.InMemory {
+		c.report.note("The %s database is kept in memory, there is nothing to check", kind)
+		return nil
+	}
+
+	dir := c.profile.Dir()
+	if kind == database.TXDB {
+		dir = c.profile.TXDir()
+	}
+	path := b.Path(dir, kind)
+	if _, err := os.Stat(path); err != nil {
+		c.report.note("The %s database was not found at %s", kind, path)
+		return nil
+	}
+
+	db, err := b.Open(path)
+	if err != nil {
+		c.report.problem(kind, "", fmt.Sprintf("Could not be opened: %s. Launch with -usesnapshot to recover it from a snapshot", err.Error()), "", nil)
+		return nil
+	}
+	c.report.note("Checking the %s database at %s", kind, path)
+
+	if !c.repair {
+		return database.NewReadOnlyDB(db)
+	}
+	return db
+}
+
+func (c *checker) close() {
+	for _, db := range []interfaces.IDatabase{c.guiDB, c.walletDB, c.txDB} {
+		if db != nil {
+			db.Close()
+		}
+	}
+}
+
+func (c *checker) openWallet(passphrase func() (string, error)) {
+	wal, err := wallet.NewMapDBWallet()
+	if err != nil {
+		c.report.problem(database.WalletDB, "", err.Error(), "", nil)
+		return
+	}
+	wal.DBO.DB.Close()
+	wal.DBO.DB = c.walletDB
+
+	if database.IsEncrypted(c.walletDB) {
+		enc, err := database.OpenEncryptedDB(c.walletDB)
+		if err != nil {
+			c.report.problem(database.WalletDB, "", "The encryption settings could not be read: "+err.Error(), "", nil)
+			return
+		}
+		pass := ""
+		if passphrase != nil {
+			pass, err = passphrase()
+		}
+		if err == nil {
+			err = enc.Unlock(pass)
+		}
+		if err != nil {
+			c.report.note("The wallet is encrypted and could not be unlocked, the private keys and seed were not checked")
+			return
+		}
+		wal.DBO.DB = enc
+	}
+
+	c.wal = wal
+}
+
+func (c *checker) checkNames() {
+	data, err := c.guiDB.Get([]byte("gui-wallet"), []byte("wallet"), new(database.RawData))
+	if err != nil {
+		c.gui = NewWallet()
+		c.report.problem(database.GUIDB, "", "The address names could not be read: "+err.Error(),
+			"Start over with no names, private keys in the wallet get default names", c.changedGUI)
+		return
+	}
+	if data == nil {
+		c.gui = NewWallet()
+		c.report.note("The GUI database has no address names")
+		return
+	}
+
+	c.gui = NewWallet()
+	problems, err := c.gui.UnmarshalBinaryChecked(data.(*database.RawData).Data)
+	if err != nil {
+		c.gui = NewWallet()
+		c.report.problem(database.GUIDB, "", "The address names could not be decoded: "+err.Error(),
+			"Start over with no names, private keys in the wallet get default names", c.changedGUI)
+		return
+	}
+	for _, p := range problems {
+		// The address is already left out of c.gui
+		c.report.problem(database.GUIDB, "", p.Error(), "Remove it", c.changedGUI)
+	}
+
+	seen := make(map[string]int)
+	for list := 1; list <= 3; list++ {
+		for _, anp := range c.gui.GetAllAddressesFromList(list) {
+			add, name, l := anp.Address, anp.Name, list
+			if err := checkListAddress(add, list); err != nil {
+				c.report.problem(database.GUIDB, add, fmt.Sprintf("'%s' in %s: %s", name, listName(list), err.Error()), "Remove it", func() error {
+					return c.removeLast(add, l)
+				})
+				continue
+			}
+			if first, ok := seen[add]; ok {
+				c.report.problem(database.GUIDB, add, fmt.Sprintf("'%s' is named more than once, in %s and %s", name, listName(first), listName(list)),
+					"Keep the first name", func() error {
+						return c.removeLast(add, l)
+					})
+				continue
+			}
+			seen[add] = list
+		}
+	}
+	c.report.note("%d address names checked", len(c.gui.GetAllAddresses()))
+}
+
+// checkListAddress returns an error if the address cannot be in the list
+func checkListAddress(add string, list int) error {
+	if !factom.IsValidAddress(add) {
+		return fmt.Errorf("Not a valid address")
+	}
+	switch list {
+	case 1:
+		if add[:2] != "FA" {
+			return fmt.Errorf("Not a factoid address")
+		}
+	case 2:
+		if add[:2] != "EC" {
+			return fmt.Errorf("Not an entry credit address")
+		}
+	}
+	return nil
+}
+
+func (c *checker) changedGUI() error {
+	c.guiChanged = true
+	return nil
+}
+
+// removeLast removes the last time the address is in the list. Unlike WalletStruct.RemoveAddress,
+// it also removes invalid addresses.
+func (c *checker) removeLast(add string, list int) error {
+	var l *address.AddressList
+	switch list {
+	case 1:
+		l = c.gui.FactoidAddresses
+	case 2:
+		l = c.gui.EntryCreditAddresses
+	case 3:
+		l = c.gui.ExternalAddresses
+	default:
+		return fmt.Errorf("Invalid list")
+	}
+
+	for i := len(l.List) - 1; i >= 0; i-- {
+		if l.List[i].Address == add {
+			l.List = append(l.List[:i], l.List[i+1:]...)
+			l.Length = uint64(len(l.List))
+			c.guiChanged = true
+			return nil
+		}
+	}
+	return fmt.Errorf("Not found")
+}
+
+func (c *checker) checkJournal() {
+	keys, err := c.guiDB.ListAllKeys(journalBucket)
+	if err == nil && len(keys) > 0 {
+		c.report.note("%d interrupted actions are in the journal, they are finished on the next launch", len(keys))
+	}
+}
+
+// checkKeys compares the names in the GUI database with the keys in the wallet database
+func (c *checker) checkKeys() {
+	fas, ecs, err := c.wal.GetAllAddresses()
+	if err != nil {
+		c.report.problem(database.WalletDB, "", "The private keys could not be read: "+err.Error(), "", nil)
+		return
+	}
+
+	keys := make(map[string]int)
+	for _, fa := range fas {
+		keys[fa.String()] = 1
+	}
+	for _, ec := range ecs {
+		keys[ec.String()] = 2
+	}
+	if c.profile.WatchOnly {
+		watched, err := loadWatchKeys(c.guiDB)
+		if err != nil {
+			c.report.problem(database.GUIDB, "", "The public keys could not be read: "+err.Error(), "", nil)
+			return
+		}
+		for add, k := range watched {
+			keys[add] = k.List
+		}
+	}
+
+	checked := make(map[string]bool)
+	for list := 1; list <= 2; list++ {
+		for _, anp := range c.gui.GetAllAddressesFromList(list) {
+			// Bad and duplicate names were already found by checkNames
+			if keys[anp.Address] == list || checked[anp.Address] || checkListAddress(anp.Address, list) != nil {
+				checked[anp.Address] = true
+				continue
+			}
+			checked[anp.Address] = true
+			add, name, l := anp.Address, anp.Name, list
+			c.report.problem(database.GUIDB, add, fmt.Sprintf("'%s' has no private key in the wallet", name),
+				"Move it to the address book", func() error {
+					if err := c.removeLast(add, l); err != nil {
+						return err
+					}
+					_, err := c.gui.AddAddress(name, add, 3)
+					return err
+				})
+		}
+	}
+
+	adds := make([]string, 0, len(keys))
+	for add := range keys {
+		adds = append(adds, add)
+	}
+	sort.Strings(adds)
+	for _, add := range adds {
+		list := keys[add]
+		anp, guiList, _ := c.gui.GetAddress(add)
+		switch guiList {
+		case list:
+		case 3:
+			add, name := add, anp.Name
+			c.report.problem(database.GUIDB, add, fmt.Sprintf("'%s' has a private key, but is in the address book", name),
+				"Move it to "+listName(list), func() error {
+					if err := c.removeLast(add, 3); err != nil {
+						return err
+					}
+					_, err := c.gui.AddAddress(name, add, list)
+					return err
+				})
+		default:
+			name := "FA-Imported-From-CLI"
+			if list == 2 {
+				name = "EC-Imported-From-CLI"
+			}
+			add := add
+			c.report.problem(database.WalletDB, add, "Private key in the wallet has no name", "Name it "+name, func() error {
+				c.guiChanged = true
+				_, err := c.gui.AddAddress(name, add, list)
+				return err
+			})
+		}
+	}
+	c.report.note("%d private keys checked", len(keys))
+}
+
+// checkSeeded checks the seeded flags against the seed, and that the wallet has the key
+// of every address the seed has made
+func (c *checker) checkSeeded() {
+	if c.profile.WatchOnly { // Has no seed
+		return
+	}
+	seed, err := c.wal.GetDBSeed()
+	if err != nil || seed == nil {
+		c.report.problem(database.WalletDB, "", "The wallet has no seed", "", nil)
+		return
+	}
+
+	made := make(map[string]bool)
+	for i := uint32(0); i < seed.NextFactoidAddressIndex; i++ {
+		fa, err := factom.MakeBIP44FactoidAddress(seed.MnemonicSeed, bip44Account, 0, i)
+		if err != nil {
+			c.report.problem(database.WalletDB, "", "The seed could not make its addresses: "+err.Error(), "", nil)
+			return
+		}
+		made[fa.String()] = true
+		if _, err := c.wal.GetFCTAddress(fa.String()); err != nil {
+			c.report.problem(database.WalletDB, fa.String(), fmt.Sprintf("Factoid address %d of the seed has no private key in the wallet", i),
+				"Add the private key from the seed", func() error {
+					return c.wal.InsertFCTAddress(fa)
+				})
+		}
+	}
+	for i := uint32(0); i < seed.NextECAddressIndex; i++ {
+		ec, err := factom.MakeBIP44ECAddress(seed.MnemonicSeed, bip44Account, 0, i)
+		if err != nil {
+			c.report.problem(database.WalletDB, "", "The seed could not make its addresses: "+err.Error(), "", nil)
+			return
+		}
+		made[ec.String()] = true
+		if _, err := c.wal.GetECAddress(ec.String()); err != nil {
+			c.report.problem(database.WalletDB, ec.String(), fmt.Sprintf("Entry credit address %d of the seed has no private key in the wallet", i),
+				"Add the private key from the seed", func() error {
+					return c.wal.InsertECAddress(ec)
+				})
+		}
+	}
+
+	for _, anp := range c.gui.GetAllMyGUIAddresses() {
+		if !anp.Seeded || made[anp.Address] {
+			continue
+		}
+		add := anp.Address
+		c.report.problem(database.GUIDB, add, fmt.Sprintf("'%s' is flagged as made by the seed, but the seed did not make it", anp.Name),
+			"Clear the flag", func() error {
+				for _, l := range []*address.AddressList{c.gui.FactoidAddresses, c.gui.EntryCreditAddresses} {
+					for i := range l.List {
+						if l.List[i].Address == add {
+							l.List[i].Seeded = false
+						}
+					}
+				}
+				c.guiChanged = true
+				return nil
+			})
+	}
+	c.report.note("%d factoid and %d entry credit addresses of the seed checked", seed.NextFactoidAddressIndex, seed.NextECAddressIndex)
+}
+
+// checkTransactions walks the FBlocks from the newest to the first, checking each links
+// to the one before it
+func (c *checker) checkTransactions() {
+	const repair = "Clear the transaction database, it is downloaded again on the next launch"
+
+	tx := wallet.NewTXOverlay(c.txDB)
+	head, err := tx.DBO.FetchFBlockHead()
+	if err != nil {
+		c.report.problem(database.TXDB, "", "The newest FBlock could not be read: "+err.Error(), repair, c.clearTransactions)
+		return
+	}
+	if head == nil {
+		c.report.note("The transaction database is empty")
+		return
+	}
+
+	top := head.GetDatabaseHeight()
+	prev := head
+	for h := top; h > 0; h-- {
+		if (top-h)%uint32(STEPS_TO_PRINT) == 0 && top-h > 0 {
+			fmt.Printf("Checked %d of %d FBlocks\n", top-h, top+1)
+		}
+
+		block, err := tx.DBO.FetchFBlockByHeight(h - 1)
+		if err != nil || block == nil {
+			c.report.problem(database.TXDB, "", fmt.Sprintf("The FBlock at height %d is missing", h-1), repair, c.clearTransactions)
+			return
+		}
+		if block.GetKeyMR().String() != prev.GetPrevKeyMR().String() {
+			c.report.problem(database.TXDB, "", fmt.Sprintf("The FBlock at height %d is not the one before height %d", h-1, h), repair, c.clearTransactions)
+			return
+		}
+		prev = block
+	}
+	c.report.note("%d FBlocks checked", top+1)
+}
+
+func (c *checker) clearTransactions() error {
+	buckets, err := c.txDB.ListAllBuckets()
+	if err != nil {
+		return err
+	}
+	for _, bucket := range buckets {
+		err = c.txDB.Clear(bucket)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The related transactions cache was built from the cleared FBlocks
+	if c.guiDB != nil {
+		return c.guiDB.Delete(relatedTransactionsBucket, relatedTransactionsKey)
+	}
+	return nil
+}
+
+// repairAll takes a snapshot, then repairs every problem it can
+func (c *checker) repairAll() error {
+	needed := false
+	for _, p := range c.report.Problems {
+		if p.fix != nil {
+			needed = true
+		}
+	}
+	if !needed {
+		return nil
+	}
+
+	guiDump := marshal.NewWriter().Marshal(snapshotVersion)
+	walletDump := guiDump
+	var err error
+	if c.guiDB != nil {
+		if guiDump, err = dumpDatabase(c.guiDB, relatedTransactionsBucket); err != nil {
+			return err
+		}
+	}
+	if c.walletDB != nil {
+		if walletDump, err = dumpDatabase(c.walletDB); err != nil {
+			return err
+		}
+	}
+	info, err := saveSnapshot(c.profile.Dir(), "before-repair", walletDump, guiDump)
+	if err != nil {
+		return fmt.Errorf("Could not take a snapshot before repairing, nothing was repaired: %s", err.Error())
+	}
+	c.report.note("Snapshot %s was taken before repairing", info.Name)
+
+	for i := range c.report.Problems {
+		p := &c.report.Problems[i]
+		if p.fix == nil {
+			continue
+		}
+		err = p.fix()
+		if err != nil {
+			p.Problem += ". The repair failed: " + err.Error()
+			continue
+		}
+		p.Repaired = true
+	}
+
+	if c.guiChanged {
+		err = c.guiDB.Put([]byte("gui-wallet"), []byte("wallet"), c.gui)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/FactomProject/enterprise-wallet/fct"
+)
+
+// FeeFunc returns the fee of the transaction being put together, if it had the given
+// number of inputs. Every input adds to the fee.
+type FeeFunc func(inputs int) (uint64, error)
+
+// CoinSelector decides which addresses pay for a transaction. The addresses returned
+// must hold at least the amount plus the fee for that many inputs.
+type CoinSelector interface {
+	Select(candidates []AddressBalancePair, amount uint64, fee FeeFunc) ([]AddressBalancePair, error)
+}
+
+// CoinSelectorFunc lets a function be used as a CoinSelector
+type CoinSelectorFunc func(candidates []AddressBalancePair, amount uint64, fee FeeFunc) ([]AddressBalancePair, error)
+
+func (f CoinSelectorFunc) Select(candidates []AddressBalancePair, amount uint64, fee FeeFunc) ([]AddressBalancePair, error) {
+	return f(candidates, amount, fee)
+}
+
+// Names of the built in coin selectors
+const (
+	LargestFirst  = "largest-first"  // The biggest balances first, the old behavior
+	SmallestFirst = "smallest-first" // The smallest balances first, to consolidate them
+	FewestInputs  = "fewest-inputs"  // As few inputs as possible for the lowest fee, without using bigger balances than needed
+	ExactMatch    = "exact-match"    // Only addresses that are emptied exactly
+	SingleAddress = "single-address" // The smallest single address that can pay, so funds are never mixed
+)
+
+// DefaultCoinSelector is used when none is chosen
+const DefaultCoinSelector = LargestFirst
+
+// ErrNotEnoughFactoids is returned when the addresses cannot cover a transaction
+var ErrNotEnoughFactoids = errors.New("Not enough factoids to cover the transaction")
+
+// exactMatchMaxInputs limits the search for an exact match, it grows quickly
+const exactMatchMaxInputs = 4
+
+var coinSelectors = make(map[string]CoinSelector)
+
+// RegisterCoinSelector makes a coin selector available by its name
+func RegisterCoinSelector(name string, s CoinSelector) error {
+	if name == "" || s == nil {
+		return fmt.Errorf("A coin selector needs a name")
+	}
+
+	name = strings.ToLower(name)
+	if _, ok := coinSelectors[name]; ok {
+		return fmt.Errorf("A coin selector named %s is already registered", name)
+	}
+	coinSelectors[name] = s
+	return nil
+}
+
+// GetCoinSelector finds a registered coin selector. No name is the DefaultCoinSelector.
+func GetCoinSelector(name string) (CoinSelector, error) {
+	if name == "" {
+		name = DefaultCoinSelector
+	}
+	s, ok := coinSelectors[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("Unknown coin selection '%s', the choices are: %s", name, strings.Join(CoinSelectorNames(), ", "))
+	}
+	return s, nil
+}
+
+// CoinSelectorNames returns the names of all registered coin selectors, sorted
+func CoinSelectorNames() []string {
+	var names []string
+	for name := range coinSelectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterCoinSelector(LargestFirst, CoinSelectorFunc(selectLargestFirst))
+	RegisterCoinSelector(SmallestFirst, CoinSelectorFunc(selectSmallestFirst))
+	RegisterCoinSelector(FewestInputs, CoinSelectorFunc(selectFewestInputs))
+	RegisterCoinSelector(ExactMatch, CoinSelectorFunc(selectExactMatch))
+	RegisterCoinSelector(SingleAddress, CoinSelectorFunc(selectSingleAddress))
+}
+
+// sortedPairs returns a sorted copy, so the caller's list is left alone
+func sortedPairs(candidates []AddressBalancePair, largestFirst bool) []AddressBalancePair {
+	list := make([]AddressBalancePair, len(candidates))
+	copy(list, candidates)
+	if largestFirst {
+		sort.Stable(sort.Reverse(AddressBalancePairs(list)))
+	} else {
+		sort.Stable(AddressBalancePairs(list))
+	}
+	return list
+}
+
+// takeInOrder takes addresses in the order given until they cover the amount and fee.
+// An address holding less than the fee it adds is skipped, it would cost more than it pays.
+func takeInOrder(list []AddressBalancePair, amount uint64, fee FeeFunc) ([]AddressBalancePair, error) {
+	var selected []AddressBalancePair
+	var sum uint64
+	for _, c := range list {
+		before, err := fee(len(selected))
+		if err != nil {
+			return nil, err
+		}
+		after, err := fee(len(selected) + 1)
+		if err != nil {
+			return nil, err
+		}
+		if c.Balance <= after-before {
+			continue
+		}
+
+		selected = append(selected, c)
+		sum += c.Balance
+		if sum >= amount+after {
+			return selected, nil
+		}
+	}
+	return nil, ErrNotEnoughFactoids
+}
+
+func selectLargestFirst(candidates []AddressBalancePair, amount uint64, fee FeeFunc) ([]AddressBalancePair, error) {
+	return takeInOrder(sortedPairs(candidates, true), amount, fee)
+}
+
+func selectSmallestFirst(candidates []AddressBalancePair, amount uint64, fee FeeFunc) ([]AddressBalancePair, error) {
+	return takeInOrder(sortedPairs(candidates, false), amount, fee)
+}
+
+// selectFewestInputs needs as many inputs as largest first, but the last one is the
+// smallest address that can cover what is left
+func selectFewestInputs(candidates []AddressBalancePair, amount uint64, fee FeeFunc) ([]AddressBalancePair, error) {
+	list := sortedPairs(candidates, true)
+	selected, err := takeInOrder(list, amount, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(selected)
+	f, err := fee(n)
+	if err != nil {
+		return nil, err
+	}
+	var sum uint64
+	for _, c := range selected[:n-1] {
+		sum += c.Balance
+	}
+	left := amount + f - sum
+
+	// The list is largest first, so the last that can cover it is the smallest
+	used := make(map[string]bool)
+	for _, c := range selected[:n-1] {
+		used[c.Address] = true
+	}
+	last := selected[n-1]
+	for _, c := range list {
+		if !used[c.Address] && c.Balance >= left && c.Balance < last.Balance {
+			last = c
+		}
+	}
+	return append(selected[:n-1:n-1], last), nil
+}
+
+// selectExactMatch finds addresses whose balances add up to exactly the amount plus
+// the fee, so every address used is emptied
+func selectExactMatch(candidates []AddressBalancePair, amount uint64, fee FeeFunc) ([]AddressBalancePair, error) {
+	list := sortedPairs(candidates, true)
+
+	var found []AddressBalancePair
+	var search func(start int, selected []AddressBalancePair, sum uint64) error
+	search = func(start int, selected []AddressBalancePair, sum uint64) error {
+		if len(selected) > 0 {
+			f, err := fee(len(selected))
+			if err != nil {
+				return err
+			}
+			if sum == amount+f {
+				found = append([]AddressBalancePair{}, selected...)
+				return nil
+			}
+			if sum > amount+f {
+				return nil
+			}
+		}
+		if len(selected) == exactMatchMaxInputs {
+			return nil
+		}
+
+		for i := start; i < len(list) && found == nil; i++ {
+			err := search(i+1, append(selected, list[i]), sum+list[i].Balance)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := search(0, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("No addresses add up to exactly %s FCT plus the fee. Choose another way to select the inputs.", fct.Amount(amount))
+	}
+	return found, nil
+}
+
+// selectSingleAddress pays from one address, the smallest that can
+func selectSingleAddress(candidates []AddressBalancePair, amount uint64, fee FeeFunc) ([]AddressBalancePair, error) {
+	f, err := fee(1)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range sortedPairs(candidates, false) {
+		if c.Balance >= amount+f {
+			return []AddressBalancePair{c}, nil
+		}
+	}
+	return nil, fmt.Errorf("No single address holds %s FCT, the amount plus the fee", fct.Amount(amount+f))
+}
@@ -0,0 +1,83 @@
+package wallet_test
+
+import (
+	"testing"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+func TestCoinSelectors(t *testing.T) {
+	// Every input adds 10 to the fee
+	fee := func(inputs int) (uint64, error) {
+		return uint64(10 + 10*inputs), nil
+	}
+
+	candidates := []AddressBalancePair{
+		{"a", 5}, // Less than the fee it adds
+		{"b", 100},
+		{"c", 250},
+		{"d", 1000},
+		{"e", 400},
+	}
+
+	pick := func(name string, amount uint64) []string {
+		s, err := GetCoinSelector(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, err := s.Select(candidates, amount, fee)
+		if err != nil {
+			return nil
+		}
+		var addrs []string
+		for _, c := range list {
+			addrs = append(addrs, c.Address)
+		}
+		return addrs
+	}
+
+	same := func(a []string, b ...string) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	if got := pick("", 300); !same(got, "d") {
+		t.Errorf("largest-first chose %v", got)
+	}
+	if got := pick(SmallestFirst, 300); !same(got, "b", "c") {
+		t.Errorf("smallest-first chose %v", got)
+	}
+	if got := pick(FewestInputs, 300); !same(got, "e") {
+		t.Errorf("fewest-inputs chose %v", got)
+	}
+	if got := pick(FewestInputs, 1300); !same(got, "d", "e") {
+		t.Errorf("fewest-inputs chose %v", got)
+	}
+	if got := pick(SingleAddress, 300); !same(got, "e") {
+		t.Errorf("single-address chose %v", got)
+	}
+	if got := pick(SingleAddress, 1200); got != nil {
+		t.Errorf("single-address chose %v, no address holds enough", got)
+	}
+	// 250 + 100 is 320 and the fee of 30 for 2 inputs
+	if got := pick(ExactMatch, 320); !same(got, "c", "b") {
+		t.Errorf("exact-match chose %v", got)
+	}
+	if got := pick(ExactMatch, 321); got != nil {
+		t.Errorf("exact-match chose %v, nothing adds up", got)
+	}
+	if got := pick(LargestFirst, 2000); got != nil {
+		t.Errorf("Chose %v without enough factoids", got)
+	}
+
+	if _, err := GetCoinSelector("random"); err == nil {
+		t.Error("Found a coin selector that does not exist")
+	}
+}
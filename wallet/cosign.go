@@ -0,0 +1,162 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/FactomProject/factomd/common/factoid"
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// A transaction can be signed by more than one wallet. A nosig transaction may spend from
+// addresses the wallet does not hold, and those inputs get an empty RCD until the wallet
+// holding the key signs them. The transaction is passed between the wallets by export and
+// import, each signs the inputs it holds the keys for, and it can be sent once every input
+// is signed.
+
+// InputSignature is an input of a transaction, and if it is signed
+type InputSignature struct {
+	Address string
+	Amount  uint64
+	Signed  bool
+	CanSign bool // The wallet holds the key
+}
+
+// placeholderRCD is the RCD of an input before it is signed. It is the size of a real one,
+// so the fee is the same.
+func placeholderRCD() interfaces.IRCD {
+	return factoid.NewRCD_1(make([]byte, 32))
+}
+
+// addInput adds an input to a transaction. An address the wallet does not hold can only be
+// added to a transaction that is not signed. It gets its RCD from the public key if this is
+// a watch-only wallet, or a placeholder RCD.
+func (wal *WalletDB) addInput(trans string, address string, amount uint64, sign bool) error {
+	if _, err := wal.Wallet.GetFCTAddress(address); err == nil || sign {
+		return wal.Wallet.AddInput(trans, address, amount)
+	}
+
+	t := wal.Wallet.GetTransactions()[trans]
+	if t == nil {
+		return fmt.Errorf("Transaction not found")
+	}
+	rcd := placeholderRCD()
+	if k := wal.watchKey(address); k != nil {
+		pub, err := hex.DecodeString(k.PublicKey)
+		if err != nil {
+			return err
+		}
+		rcd = factoid.NewRCD_1(pub)
+	}
+	t.AddInput(factoid.NewAddress(primitives.ConvertUserStrToAddress(address)), amount)
+	t.AddRCD(rcd)
+	return nil
+}
+
+// GetInputSignatures returns the inputs of a draft, and which are signed
+func (wal *WalletDB) GetInputSignatures(trans string) ([]InputSignature, error) {
+	if !wal.IsDraft(trans) {
+		return nil, ErrDraftNotFound
+	}
+	t := wal.Wallet.GetTransactions()[trans]
+	if t == nil {
+		return nil, fmt.Errorf("Transaction not found")
+	}
+
+	var sigs []InputSignature
+	for i, in := range t.GetInputs() {
+		addr := primitives.ConvertFctAddressToUserStr(in.GetAddress())
+		_, err := wal.Wallet.GetFCTAddress(addr)
+		sigs = append(sigs, InputSignature{
+			Address: addr,
+			Amount:  in.GetAmount(),
+			Signed:  inputSigned(t, i),
+			CanSign: err == nil,
+		})
+	}
+	return sigs, nil
+}
+
+// inputSigned is true if the RCD of an input matches its address and its signature is valid
+func inputSigned(t *factoid.Transaction, i int) bool {
+	rcds := t.GetRCDs()
+	if i >= len(rcds) {
+		return false
+	}
+	addr, err := rcds[i].GetAddress()
+	if err != nil || addr == nil || !bytes.Equal(addr.Bytes(), t.GetInputs()[i].GetAddress().Bytes()) {
+		return false
+	}
+	sig := t.GetSignatureBlock(i)
+	if sig == nil {
+		return false
+	}
+	return rcds[i].CheckSig(t, sig)
+}
+
+// SignInputs signs the inputs of a draft the wallet holds the keys for, and leaves the
+// others. It returns how many inputs it signed.
+func (wal *WalletDB) SignInputs(trans string) (int, error) {
+	if err := wal.checkUnlocked(); err != nil {
+		return 0, err
+	}
+	if err := wal.checkSecrets(); err != nil {
+		return 0, err
+	}
+	if !wal.IsDraft(trans) {
+		return 0, ErrDraftNotFound
+	}
+	t := wal.Wallet.GetTransactions()[trans]
+	if t == nil {
+		return 0, fmt.Errorf("Transaction not found")
+	}
+
+	data, err := t.MarshalBinarySig()
+	if err != nil {
+		return 0, err
+	}
+
+	signed := 0
+	for i, in := range t.GetInputs() {
+		fa, err := wal.Wallet.GetFCTAddress(primitives.ConvertFctAddressToUserStr(in.GetAddress()))
+		if err != nil {
+			continue
+		}
+		if i >= len(t.RCDs) {
+			return 0, fmt.Errorf("Input %d of the transaction has no RCD", i+1)
+		}
+		t.RCDs[i] = factoid.NewRCD_1(fa.PubBytes())
+		t.SetSignatureBlock(i, factoid.NewSingleSignatureBlock(fa.SecBytes(), data))
+		signed++
+	}
+
+	if signed > 0 {
+		if err := wal.saveDraft(trans); err != nil {
+			return signed, err
+		}
+	}
+	return signed, nil
+}
+
+// ValidateSignatures returns an error naming the inputs of a draft that are not signed,
+// or nil if the transaction can be sent
+func (wal *WalletDB) ValidateSignatures(trans string) error {
+	sigs, err := wal.GetInputSignatures(trans)
+	if err != nil {
+		return err
+	}
+
+	var unsigned []string
+	for _, s := range sigs {
+		if !s.Signed {
+			unsigned = append(unsigned, s.Address)
+		}
+	}
+	if len(unsigned) > 0 {
+		return fmt.Errorf("The inputs from %s are not signed", strings.Join(unsigned, ", "))
+	}
+	return wal.Wallet.GetTransactions()[trans].ValidateSignatures()
+}
@@ -0,0 +1,118 @@
+package wallet_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+func TestCosign(t *testing.T) {
+	defer UseTempDataDir(t)()
+
+	// Each wallet holds the key to one of the inputs
+	first, err := NewWalletDB(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	sand, err := first.AddAddress("Sand", "Fs3E9gV6DXsYzf7Fqx1fVBQPQXV695eP3k5XbmHEZVRLkMdD9qCK")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := CreateProfile("cosigner", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewProfileWalletDB(p, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	spare, err := second.AddAddress("Spare", "Fs1uHDWjYANSxXUtbdkLVkhHboaPRz1tADqs7iB16kQq5VTCvKZS")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	external := "FA3HRq8jFUhzN9c8iKTBBfXyNyijSnov1ZLJtJMKTXFQNmncWZoE"
+	defer StubFactomdBalances(1000, map[string]int64{sand.Address: 5e8, spare.Address: 5e8})()
+
+	// checkInputs checks which inputs of a draft are signed, and can be signed, by a wallet
+	checkInputs := func(step string, wal *WalletDB, trans string, signed, canSign map[string]bool) {
+		sigs, err := wal.GetInputSignatures(trans)
+		if err != nil {
+			t.Fatalf("%s: %s", step, err.Error())
+		}
+		if len(sigs) != 2 {
+			t.Fatalf("%s: expected 2 inputs, found %d", step, len(sigs))
+		}
+		for _, s := range sigs {
+			if s.Signed != signed[s.Address] || s.CanSign != canSign[s.Address] {
+				t.Errorf("%s: %s is signed %v and can be signed %v", step, s.Address, s.Signed, s.CanSign)
+			}
+		}
+
+		err = wal.ValidateSignatures(trans)
+		complete := signed[sand.Address] && signed[spare.Address]
+		if complete && err != nil {
+			t.Errorf("%s: the signed transaction is not valid: %s", step, err.Error())
+		}
+		if !complete {
+			if err == nil {
+				t.Errorf("%s: a transaction missing a signature was valid", step)
+			} else if !signed[spare.Address] && !strings.Contains(err.Error(), spare.Address) {
+				t.Errorf("%s: the unsigned input is not named in '%s'", step, err.Error())
+			}
+		}
+	}
+	mine := func(addr string) map[string]bool { return map[string]bool{addr: true} }
+	both := map[string]bool{sand.Address: true, spare.Address: true}
+
+	trans, _, err := first.ConstructTransactionFromValues("", []string{external}, []uint64{3e8},
+		[]string{sand.Address, spare.Address}, []uint64{1e8, 2e8}, sand.Address, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInputs("Made", first, trans, nil, mine(sand.Address))
+
+	n, err := first.SignInputs(trans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("The first wallet signed %d inputs", n)
+	}
+	checkInputs("Signed by the first", first, trans, mine(sand.Address), mine(sand.Address))
+
+	// Passed to the second wallet, which signs the other half
+	exported, err := first.ExportTransaction(trans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := second.ImportDraft("Cosign", exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInputs("Imported", second, d.ID, mine(sand.Address), mine(spare.Address))
+
+	n, err = second.SignInputs(d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("The second wallet signed %d inputs", n)
+	}
+	checkInputs("Signed by the second", second, d.ID, both, mine(spare.Address))
+
+	// And back to the first, to send it
+	exported, err = second.ExportTransaction(d.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err = first.ImportDraft("Cosigned", exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInputs("Returned", first, d.ID, both, mine(sand.Address))
+}
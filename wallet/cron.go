@@ -0,0 +1,147 @@
+package wallet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A cron expression has five fields: minute, hour, day of the month, month and day of the
+// week (0 is Sunday). A field is *, a number, a range a-b, or a list of them, and any of
+// these can be stepped with /n. If both days are restricted, a time matching either is
+// due, as in cron. @hourly, @daily, @weekly, @monthly and @yearly can be used as well.
+
+var cronShorthands = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64 // A bit for each value that matches
+	domAny, dowAny                bool
+}
+
+// parseCron reads a cron expression
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if s, ok := cronShorthands[strings.ToLower(expr)]; ok {
+		expr = s
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("A cron expression has 5 fields, found %d", len(fields))
+	}
+
+	c := new(cronSchedule)
+	var err error
+	bounds := []struct {
+		field    *uint64
+		min, max uint
+		name     string
+	}{
+		{&c.minute, 0, 59, "minute"},
+		{&c.hour, 0, 23, "hour"},
+		{&c.dom, 1, 31, "day of the month"},
+		{&c.month, 1, 12, "month"},
+		{&c.dow, 0, 7, "day of the week"},
+	}
+	for i, b := range bounds {
+		*b.field, err = parseCronField(fields[i], b.min, b.max)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s '%s': %s", b.name, fields[i], err.Error())
+		}
+	}
+
+	// Sunday is 0 or 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+	return c, nil
+}
+
+func parseCronField(field string, min uint, max uint) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := uint(1)
+		if i := strings.Index(part, "/"); i != -1 {
+			s, err := strconv.ParseUint(part[i+1:], 10, 8)
+			if err != nil || s == 0 {
+				return 0, fmt.Errorf("bad step")
+			}
+			step = uint(s)
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			r := strings.SplitN(part, "-", 2)
+			l, err := strconv.ParseUint(r[0], 10, 8)
+			if err != nil {
+				return 0, fmt.Errorf("not a number")
+			}
+			lo, hi = uint(l), uint(l)
+			if len(r) == 2 {
+				h, err := strconv.ParseUint(r[1], 10, 8)
+				if err != nil {
+					return 0, fmt.Errorf("not a number")
+				}
+				hi = uint(h)
+			} else if step != 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("out of range %d-%d", min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first time after t the schedule is due, or the zero time if it is
+// never due, such as on February 30th
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Scrypt parameters used when deriving a key from a passphrase
+const (
+	ScryptN      int = 1 << 15
+	ScryptR      int = 8
+	ScryptP      int = 1
+	KeyLength    int = 32
+	SaltLength   int = 32
+	nonceLength  int = 12
+	minimumInput int = nonceLength + 16 // Nonce and GCM tag
+)
+
+// DeriveKey turns a passphrase into a key suitable for Encrypt and Decrypt
+func DeriveKey(passphrase string, salt []byte, n int, r int, p int) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("A passphrase is required")
+	}
+	return scrypt.Key([]byte(passphrase), salt, n, r, p, KeyLength)
+}
+
+// NewSalt returns random bytes to be used as a salt for DeriveKey
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// Encrypt seals the plaintext with AES-GCM. The additional data is authenticated but
+// not stored, the same additional data must be given to decrypt.
+func Encrypt(key []byte, plaintext []byte, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, nonceLength)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// Decrypt opens data sealed by Encrypt
+func Decrypt(key []byte, data []byte, additional []byte) ([]byte, error) {
+	if len(data) < minimumInput {
+		return nil, fmt.Errorf("Encrypted data is too short")
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, data[:nonceLength], data[nonceLength:], additional)
+	if err != nil {
+		return nil, fmt.Errorf("Could not decrypt, the passphrase is incorrect or the data is corrupted")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
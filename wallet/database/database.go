@@ -7,6 +7,7 @@ package database
  ********************************/
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -19,6 +20,7 @@ import (
 func NewOrOpenLevelDBWallet(ldbpath string) (interfaces.IDatabase, error) {
 	// check if the file exists or if it is a directory
 	_, err := os.Stat(ldbpath)
+	exists := err == nil
 
 	// create the wallet directory if it doesn't already exist
 	if os.IsNotExist(err) {
@@ -30,6 +32,10 @@ func NewOrOpenLevelDBWallet(ldbpath string) (interfaces.IDatabase, error) {
 	db, err := hybridDB.NewLevelMapHybridDB(ldbpath, false)
 	if err != nil {
 		fmt.Printf("err opening db: %v\n", err)
+		// Never replace a database that is there, but cannot be read
+		if exists {
+			return nil, fmt.Errorf("Could not use database \"%s\": %v", ldbpath, err)
+		}
 	}
 
 	if db == nil {
@@ -48,7 +54,7 @@ func NewMapDB() (interfaces.IDatabase, error) {
 	return new(mapdb.MapDB), nil
 }
 
-func NewOrOpenBoltDBWallet(boltPath string) (interfaces.IDatabase, error) {
+func NewOrOpenBoltDBWallet(boltPath string) (db interfaces.IDatabase, err error) {
 	// check if the file exists or if it is a directory
 	fileInfo, err := os.Stat(boltPath)
 	if err == nil {
@@ -71,12 +77,19 @@ func NewOrOpenBoltDBWallet(boltPath string) (interfaces.IDatabase, error) {
 
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Printf("Could not use wallet file \"%s\"\n%v\n", boltPath, r)
-			os.Exit(1)
+			db = nil
+			err = fmt.Errorf("Could not use database file \"%s\": %v", boltPath, r)
 		}
 	}()
-	db := hybridDB.NewBoltMapHybridDB(nil, boltPath)
+	db = hybridDB.NewBoltMapHybridDB(nil, boltPath)
 
 	fmt.Println("Database started from: " + boltPath)
 	return db, nil
 }
+
+// ByteSlices sorts keys and buckets the way the databases list them
+type ByteSlices [][]byte
+
+func (b ByteSlices) Len() int           { return len(b) }
+func (b ByteSlices) Less(i, j int) bool { return bytes.Compare(b[i], b[j]) < 0 }
+func (b ByteSlices) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
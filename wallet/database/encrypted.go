@@ -0,0 +1,398 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+// ErrLocked is returned by an EncryptedDB for any access to the data while locked
+var ErrLocked = errors.New("The wallet is locked. Unlock it with your passphrase and try again.")
+
+var (
+	encryptionBucket    = []byte("wallet-encryption")
+	encryptionParamsKey = []byte("params")
+	encryptionCheck     = []byte("enterprise-wallet")
+)
+
+// EncryptedDB wraps a database and encrypts every value before it is written to it.
+// The key is derived from a passphrase, and is only held while unlocked. Keys and
+// buckets are not encrypted, only the values.
+type EncryptedDB struct {
+	db     interfaces.IDatabase
+	params *EncryptionParams
+	key    []byte // nil when locked
+	keyMux sync.RWMutex
+}
+
+var _ interfaces.IDatabase = (*EncryptedDB)(nil)
+
+// EncryptionParams are saved unencrypted next to the data, and are needed to derive the key
+type EncryptionParams struct {
+	Salt  []byte
+	N     int
+	R     int
+	P     int
+	Check []byte // encryptionCheck encrypted, to verify a passphrase
+}
+
+func (p *EncryptionParams) MarshalBinary() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (p *EncryptionParams) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	err = json.Unmarshal(data, p)
+	return nil, err
+}
+
+func (p *EncryptionParams) UnmarshalBinary(data []byte) error {
+	_, err := p.UnmarshalBinaryData(data)
+	return err
+}
+
+// RawData holds the bytes of a record exactly as they are stored. It is used to
+// move records around without knowing their type.
+type RawData struct {
+	Data []byte
+}
+
+func NewRawData(data []byte) *RawData {
+	r := new(RawData)
+	r.Data = data
+	return r
+}
+
+func (r *RawData) New() interfaces.BinaryMarshallableAndCopyable {
+	return new(RawData)
+}
+
+func (r *RawData) MarshalBinary() ([]byte, error) {
+	return r.Data, nil
+}
+
+func (r *RawData) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	r.Data = make([]byte, len(data))
+	copy(r.Data, data)
+	return nil, nil
+}
+
+func (r *RawData) UnmarshalBinary(data []byte) error {
+	_, err := r.UnmarshalBinaryData(data)
+	return err
+}
+
+// IsEncrypted checks if the database has been encrypted by EncryptDatabase. It is false if
+// the database cannot be read, use CheckEncrypted where that matters.
+func IsEncrypted(db interfaces.IDatabase) bool {
+	encrypted, err := CheckEncrypted(db)
+	return err == nil && encrypted
+}
+
+// CheckEncrypted checks if the database has been encrypted by EncryptDatabase, and returns
+// an error if that cannot be read
+func CheckEncrypted(db interfaces.IDatabase) (bool, error) {
+	data, err := db.Get(encryptionBucket, encryptionParamsKey, new(EncryptionParams))
+	if err != nil {
+		return false, err
+	}
+	return data != nil, nil
+}
+
+// OpenEncryptedDB wraps a database that was encrypted by EncryptDatabase. It starts locked.
+func OpenEncryptedDB(db interfaces.IDatabase) (*EncryptedDB, error) {
+	data, err := db.Get(encryptionBucket, encryptionParamsKey, new(EncryptionParams))
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, errors.New("The database is not encrypted")
+	}
+
+	e := new(EncryptedDB)
+	e.db = db
+	e.params = data.(*EncryptionParams)
+	return e, nil
+}
+
+// EncryptDatabase encrypts every record already in the database with a key derived from
+// the passphrase. The returned EncryptedDB is unlocked.
+func EncryptDatabase(db interfaces.IDatabase, passphrase string) (*EncryptedDB, error) {
+	encrypted, err := CheckEncrypted(db)
+	if err != nil {
+		return nil, err
+	}
+	if encrypted {
+		return nil, errors.New("The database is already encrypted")
+	}
+
+	salt, err := NewSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(EncryptionParams)
+	p.Salt = salt
+	p.N, p.R, p.P = ScryptN, ScryptR, ScryptP
+
+	key, err := DeriveKey(passphrase, p.Salt, p.N, p.R, p.P)
+	if err != nil {
+		return nil, err
+	}
+	p.Check, err = Encrypt(key, encryptionCheck, encryptionParamsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	e := new(EncryptedDB)
+	e.db = db
+	e.params = p
+	e.key = key
+
+	// Read everything before writing anything, so a failure to read leaves the database as it was
+	var records []interfaces.Record
+	buckets, err := db.ListAllBuckets()
+	if err != nil {
+		return nil, err
+	}
+	for _, bucket := range buckets {
+		keys, err := db.ListAllKeys(bucket)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			data, err := db.Get(bucket, k, new(RawData))
+			if err != nil {
+				return nil, err
+			}
+			if data == nil {
+				continue
+			}
+			records = append(records, interfaces.Record{Bucket: bucket, Key: k, Data: data})
+		}
+	}
+
+	sealed, err := e.sealRecords(key, records)
+	if err != nil {
+		return nil, err
+	}
+
+	// The params are written in the same batch as the records, so the database is never
+	// left encrypted without the salt to decrypt it. The backends write a batch at once,
+	// or not at all.
+	sealed = append(sealed, interfaces.Record{Bucket: encryptionBucket, Key: encryptionParamsKey, Data: p})
+	err = db.PutInBatch(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Unlock derives the key from the passphrase, and checks it is the correct one
+func (e *EncryptedDB) Unlock(passphrase string) error {
+	key, err := DeriveKey(passphrase, e.params.Salt, e.params.N, e.params.R, e.params.P)
+	if err != nil {
+		return err
+	}
+
+	check, err := Decrypt(key, e.params.Check, encryptionParamsKey)
+	if err != nil || !bytes.Equal(check, encryptionCheck) {
+		return errors.New("Incorrect passphrase")
+	}
+
+	e.keyMux.Lock()
+	e.key = key
+	e.keyMux.Unlock()
+	return nil
+}
+
+// LockDB forgets the key. The data cannot be read or written until unlocked again.
+func (e *EncryptedDB) LockDB() {
+	e.keyMux.Lock()
+	for i := range e.key {
+		e.key[i] = 0
+	}
+	e.key = nil
+	e.keyMux.Unlock()
+}
+
+func (e *EncryptedDB) IsLocked() bool {
+	e.keyMux.RLock()
+	defer e.keyMux.RUnlock()
+	return e.key == nil
+}
+
+// RawDB returns the database underneath, where the values are still encrypted.
+// Anything written to it directly is not encrypted.
+func (e *EncryptedDB) RawDB() interfaces.IDatabase {
+	return e.db
+}
+
+// getKey returns a copy of the key, or ErrLocked
+func (e *EncryptedDB) getKey() ([]byte, error) {
+	e.keyMux.RLock()
+	defer e.keyMux.RUnlock()
+	if e.key == nil {
+		return nil, ErrLocked
+	}
+	key := make([]byte, len(e.key))
+	copy(key, e.key)
+	return key, nil
+}
+
+// recordID binds an encrypted value to its location, so values cannot be swapped around
+func recordID(bucket []byte, key []byte) []byte {
+	id := make([]byte, 0, len(bucket)+len(key)+1)
+	id = append(id, bucket...)
+	id = append(id, 0x00)
+	id = append(id, key...)
+	return id
+}
+
+func (e *EncryptedDB) seal(key []byte, bucket []byte, k []byte, data interfaces.BinaryMarshallable) (*RawData, error) {
+	plain, err := data.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := Encrypt(key, plain, recordID(bucket, k))
+	if err != nil {
+		return nil, err
+	}
+	return NewRawData(sealed), nil
+}
+
+func (e *EncryptedDB) Put(bucket, key []byte, data interfaces.BinaryMarshallable) error {
+	k, err := e.getKey()
+	if err != nil {
+		return err
+	}
+
+	sealed, err := e.seal(k, bucket, key, data)
+	if err != nil {
+		return err
+	}
+	return e.db.Put(bucket, key, sealed)
+}
+
+func (e *EncryptedDB) PutInBatch(records []interfaces.Record) error {
+	k, err := e.getKey()
+	if err != nil {
+		return err
+	}
+
+	sealedRecords, err := e.sealRecords(k, records)
+	if err != nil {
+		return err
+	}
+	return e.db.PutInBatch(sealedRecords)
+}
+
+func (e *EncryptedDB) sealRecords(key []byte, records []interfaces.Record) ([]interfaces.Record, error) {
+	sealedRecords := make([]interfaces.Record, 0, len(records)+1)
+	for _, r := range records {
+		sealed, err := e.seal(key, r.Bucket, r.Key, r.Data)
+		if err != nil {
+			return nil, err
+		}
+		sealedRecords = append(sealedRecords, interfaces.Record{Bucket: r.Bucket, Key: r.Key, Data: sealed})
+	}
+	return sealedRecords, nil
+}
+
+func (e *EncryptedDB) Get(bucket, key []byte, destination interfaces.BinaryMarshallable) (interfaces.BinaryMarshallable, error) {
+	k, err := e.getKey()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := e.db.Get(bucket, key, new(RawData))
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	plain, err := Decrypt(k, data.(*RawData).Data, recordID(bucket, key))
+	if err != nil {
+		return nil, err
+	}
+
+	err = destination.UnmarshalBinary(plain)
+	if err != nil {
+		return nil, err
+	}
+	return destination, nil
+}
+
+func (e *EncryptedDB) GetAll(bucket []byte, sample interfaces.BinaryMarshallableAndCopyable) ([]interfaces.BinaryMarshallableAndCopyable, [][]byte, error) {
+	k, err := e.getKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	all, keys, err := e.db.GetAll(bucket, new(RawData))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	answer := make([]interfaces.BinaryMarshallableAndCopyable, 0, len(all))
+	for i, data := range all {
+		plain, err := Decrypt(k, data.(*RawData).Data, recordID(bucket, keys[i]))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		dest := sample.New()
+		err = dest.UnmarshalBinary(plain)
+		if err != nil {
+			return nil, nil, err
+		}
+		answer = append(answer, dest)
+	}
+	return answer, keys, nil
+}
+
+func (e *EncryptedDB) Delete(bucket, key []byte) error {
+	if e.IsLocked() {
+		return ErrLocked
+	}
+	return e.db.Delete(bucket, key)
+}
+
+func (e *EncryptedDB) Clear(bucket []byte) error {
+	if e.IsLocked() {
+		return ErrLocked
+	}
+	return e.db.Clear(bucket)
+}
+
+// ListAllKeys is allowed while locked, keys are not encrypted
+func (e *EncryptedDB) ListAllKeys(bucket []byte) ([][]byte, error) {
+	return e.db.ListAllKeys(bucket)
+}
+
+func (e *EncryptedDB) ListAllBuckets() ([][]byte, error) {
+	buckets, err := e.db.ListAllBuckets()
+	if err != nil {
+		return nil, err
+	}
+
+	// The encryption params are not part of the data
+	answer := make([][]byte, 0, len(buckets))
+	for _, b := range buckets {
+		if !bytes.Equal(b, encryptionBucket) {
+			answer = append(answer, b)
+		}
+	}
+	return answer, nil
+}
+
+func (e *EncryptedDB) Trim() {
+	e.db.Trim()
+}
+
+func (e *EncryptedDB) Close() error {
+	e.LockDB()
+	return e.db.Close()
+}
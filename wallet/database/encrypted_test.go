@@ -0,0 +1,130 @@
+package database_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet/database"
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+func TestEncryptedDB(t *testing.T) {
+	db, _ := NewMapDB()
+	err := db.Put([]byte("bucket"), []byte("key"), NewRawData([]byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc, err := EncryptDatabase(db, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsEncrypted(db) {
+		t.Fatal("Database should be encrypted")
+	}
+
+	// The underlying database must not hold the plaintext
+	raw, err := db.Get([]byte("bucket"), []byte("key"), new(RawData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw.(*RawData).Data, []byte("secret")) {
+		t.Fatal("Value was not encrypted")
+	}
+
+	data, err := enc.Get([]byte("bucket"), []byte("key"), new(RawData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data.(*RawData).Data, []byte("secret")) {
+		t.Fatal("Value was not decrypted")
+	}
+
+	enc.LockDB()
+	_, err = enc.Get([]byte("bucket"), []byte("key"), new(RawData))
+	if err != ErrLocked {
+		t.Fatal("Expected a locked error")
+	}
+
+	enc, err = OpenEncryptedDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enc.Unlock("wrong") == nil {
+		t.Fatal("Wrong passphrase unlocked the database")
+	}
+	if err = enc.Unlock("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = enc.Get([]byte("bucket"), []byte("key"), new(RawData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data.(*RawData).Data, []byte("secret")) {
+		t.Fatal("Value was not decrypted after unlock")
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := DeriveKey("passphrase", salt, 1<<10, ScryptR, ScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := Encrypt(key, []byte("plaintext"), []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain, err := Decrypt(key, sealed, []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain, []byte("plaintext")) {
+		t.Fatal("Plaintext does not match")
+	}
+
+	_, err = Decrypt(key, sealed, []byte("other"))
+	if err == nil {
+		t.Fatal("Decrypted with the wrong additional data")
+	}
+}
+
+// failingBatchDB fails every batch write
+type failingBatchDB struct {
+	interfaces.IDatabase
+}
+
+func (f *failingBatchDB) PutInBatch(records []interfaces.Record) error {
+	return errors.New("Batch failed")
+}
+
+func TestEncryptDatabaseFailure(t *testing.T) {
+	db, _ := NewMapDB()
+	err := db.Put([]byte("bucket"), []byte("key"), NewRawData([]byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The records and the params are written together, so a failed write leaves neither
+	if _, err = EncryptDatabase(&failingBatchDB{db}, "passphrase"); err == nil {
+		t.Fatal("Expected the batch error")
+	}
+	if encrypted, err := CheckEncrypted(db); err != nil || encrypted {
+		t.Fatalf("Database should not be encrypted, found %v %v", encrypted, err)
+	}
+	raw, err := db.Get([]byte("bucket"), []byte("key"), new(RawData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw.(*RawData).Data, []byte("secret")) {
+		t.Fatal("Value was changed by the failed encryption")
+	}
+}
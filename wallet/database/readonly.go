@@ -0,0 +1,62 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+// ErrReadOnly is returned by a ReadOnlyDB for any write
+var ErrReadOnly = errors.New("The database was opened read only")
+
+// ReadOnlyDB wraps a database, and refuses every write to it
+type ReadOnlyDB struct {
+	db interfaces.IDatabase
+}
+
+var _ interfaces.IDatabase = (*ReadOnlyDB)(nil)
+
+func NewReadOnlyDB(db interfaces.IDatabase) *ReadOnlyDB {
+	r := new(ReadOnlyDB)
+	r.db = db
+	return r
+}
+
+func (r *ReadOnlyDB) Put(bucket, key []byte, data interfaces.BinaryMarshallable) error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnlyDB) PutInBatch(records []interfaces.Record) error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnlyDB) Get(bucket, key []byte, destination interfaces.BinaryMarshallable) (interfaces.BinaryMarshallable, error) {
+	return r.db.Get(bucket, key, destination)
+}
+
+func (r *ReadOnlyDB) GetAll(bucket []byte, sample interfaces.BinaryMarshallableAndCopyable) ([]interfaces.BinaryMarshallableAndCopyable, [][]byte, error) {
+	return r.db.GetAll(bucket, sample)
+}
+
+func (r *ReadOnlyDB) Delete(bucket, key []byte) error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnlyDB) Clear(bucket []byte) error {
+	return ErrReadOnly
+}
+
+func (r *ReadOnlyDB) ListAllKeys(bucket []byte) ([][]byte, error) {
+	return r.db.ListAllKeys(bucket)
+}
+
+func (r *ReadOnlyDB) ListAllBuckets() ([][]byte, error) {
+	return r.db.ListAllBuckets()
+}
+
+func (r *ReadOnlyDB) Trim() {
+}
+
+func (r *ReadOnlyDB) Close() error {
+	return r.db.Close()
+}
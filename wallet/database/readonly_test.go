@@ -0,0 +1,44 @@
+package database_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet/database"
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+func TestReadOnlyDB(t *testing.T) {
+	db, err := NewMapDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, key := []byte("bucket"), []byte("key")
+	if err = db.Put(bucket, key, NewRawData([]byte("value"))); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReadOnlyDB(db)
+	data, err := r.Get(bucket, key, new(RawData))
+	if err != nil || data == nil || !bytes.Equal(data.(*RawData).Data, []byte("value")) {
+		t.Fatal("Could not read through a read only database")
+	}
+
+	if r.Put(bucket, key, NewRawData([]byte("new"))) != ErrReadOnly {
+		t.Error("Put should be refused")
+	}
+	if r.PutInBatch([]interfaces.Record{{Bucket: bucket, Key: key, Data: NewRawData(nil)}}) != ErrReadOnly {
+		t.Error("PutInBatch should be refused")
+	}
+	if r.Delete(bucket, key) != ErrReadOnly {
+		t.Error("Delete should be refused")
+	}
+	if r.Clear(bucket) != ErrReadOnly {
+		t.Error("Clear should be refused")
+	}
+
+	data, err = db.Get(bucket, key, new(RawData))
+	if err != nil || data == nil || !bytes.Equal(data.(*RawData).Data, []byte("value")) {
+		t.Fatal("The database was changed")
+	}
+}
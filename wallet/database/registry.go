@@ -0,0 +1,138 @@
+package database
+
+/********************************
+ *                              *
+ *       Backend Registry       *
+ *                              *
+ ********************************/
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+// DBKind is one of the 3 databases the wallet uses
+type DBKind int
+
+const (
+	WalletDB DBKind = iota // Private keys and seed
+	GUIDB                  // Names and settings
+	TXDB                   // Transaction cache
+)
+
+func (k DBKind) String() string {
+	switch k {
+	case WalletDB:
+		return "Wallet"
+	case GUIDB:
+		return "GUI"
+	case TXDB:
+		return "Transaction"
+	}
+	return "[Unknown database]"
+}
+
+// Backend is a storage type the wallet databases can be kept in
+type Backend struct {
+	Name string                                          // Name used to select the backend, not case sensitive
+	Open func(path string) (interfaces.IDatabase, error) // Opens, or creates, the database at the path
+	// Default file names of each database, inside the data directory
+	Paths map[DBKind]string
+	// InMemory backends ignore the path, and lose everything on close
+	InMemory bool
+	// TXOnly backends can only hold the transaction database
+	TXOnly bool
+}
+
+// CanHold returns an error if the backend cannot be used for the kind of database
+func (b *Backend) CanHold(kind DBKind) error {
+	if b.TXOnly && kind != TXDB {
+		return fmt.Errorf("The %s database type can only be used for the transaction database", b.Name)
+	}
+	return nil
+}
+
+// Path returns where the database of the given kind is kept in the data directory
+func (b *Backend) Path(dataDir string, kind DBKind) string {
+	if b.InMemory {
+		return ""
+	}
+	return filepath.Join(dataDir, b.Paths[kind])
+}
+
+var backends = make(map[string]*Backend)
+
+// RegisterBackend makes a backend available by its name
+func RegisterBackend(b *Backend) error {
+	if b == nil || b.Name == "" || b.Open == nil {
+		return fmt.Errorf("A backend needs a name and an open function")
+	}
+
+	name := strings.ToLower(b.Name)
+	if _, ok := backends[name]; ok {
+		return fmt.Errorf("A backend named %s is already registered", b.Name)
+	}
+	backends[name] = b
+	return nil
+}
+
+// GetBackend finds a registered backend. Names are not case sensitive
+func GetBackend(name string) (*Backend, error) {
+	b, ok := backends[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("Unknown database type '%s', types available are: %s", name, strings.Join(BackendNames(), ", "))
+	}
+	return b, nil
+}
+
+// BackendNames returns the names of all registered backends, sorted
+func BackendNames() []string {
+	var names []string
+	for _, b := range backends {
+		names = append(names, b.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterBackend(&Backend{
+		Name:     "Map",
+		Open:     func(path string) (interfaces.IDatabase, error) { return NewMapDB() },
+		InMemory: true,
+	})
+
+	RegisterBackend(&Backend{
+		Name: "LDB",
+		Open: NewOrOpenLevelDBWallet,
+		Paths: map[DBKind]string{
+			WalletDB: "factoid_wallet_ldb.db",
+			GUIDB:    "factoid_gui_ldb.db",
+			TXDB:     "factoid_blocks_ldb_cache.db",
+		},
+	})
+
+	RegisterBackend(&Backend{
+		Name: "Bolt",
+		Open: NewOrOpenBoltDBWallet,
+		Paths: map[DBKind]string{
+			WalletDB: "factom_wallet.db",
+			GUIDB:    "factom_wallet_gui.db",
+			TXDB:     "factoid_blocks.cache",
+		},
+	})
+
+	// Can be used by many wallets and processes at once, see SharedCache
+	RegisterBackend(&Backend{
+		Name: "Shared",
+		Open: OpenSharedCache,
+		Paths: map[DBKind]string{
+			TXDB: "factoid_blocks.shared",
+		},
+		TXOnly: true,
+	})
+}
@@ -0,0 +1,43 @@
+package database_test
+
+import (
+	"testing"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet/database"
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+func TestGetBackend(t *testing.T) {
+	for _, name := range []string{"Map", "map", "LDB", "ldb", "Bolt", "BOLT"} {
+		if _, err := GetBackend(name); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err := GetBackend("NotABackend"); err == nil {
+		t.Error("Unknown backend should fail")
+	}
+}
+
+func TestRegisterBackend(t *testing.T) {
+	b := &Backend{
+		Name:     "TestBackend",
+		Open:     func(path string) (interfaces.IDatabase, error) { return NewMapDB() },
+		InMemory: true,
+	}
+
+	if err := RegisterBackend(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterBackend(b); err == nil {
+		t.Error("Registering a name twice should fail")
+	}
+
+	found, err := GetBackend("testbackend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Path("/tmp", WalletDB) != "" {
+		t.Error("In memory backends have no path")
+	}
+}
@@ -0,0 +1,571 @@
+package database
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/factomd/common/factoid"
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/database/databaseOverlay"
+)
+
+// SharedCache is a store of public data, such as the FBlock cache, that any number of
+// wallets in this and other processes can use at once. Every record is a file, written
+// under another name and renamed into place, so it is never read half written.
+//
+// Only the writer, the process holding the lock file, adds to the files. Any other
+// process reads them, and keeps what it writes in memory. Once the writer goes away,
+// the next process to write takes the lock. Two writers at once can only waste a
+// download, as a record is only ever replaced by the same data or a newer head: the
+// height of a chain head is checked against the head in the files before it is written.
+type SharedCache struct {
+	dir string
+
+	refs     int
+	writer   bool
+	token    string    // Written to the lock file, to know it is still ours
+	lastTry  time.Time // Last attempt to take the lock
+	stopBeat chan struct{}
+
+	// Records written while not the writer, by hex bucket and hex key
+	mem map[string]map[string][]byte
+
+	sync.Mutex
+}
+
+const (
+	sharedLockName = "writer.lock"
+
+	// The writer touches the lock file this often. A lock that has not been touched for
+	// sharedLockStale was left by a writer that did not exit cleanly, and can be taken.
+	sharedLockBeat  = 30 * time.Second
+	sharedLockStale = 2 * time.Minute
+)
+
+var (
+	sharedCaches   = make(map[string]*SharedCache)
+	sharedCacheMux sync.Mutex
+
+	// The head of a chain is the hash of its newest block
+	sharedHeadBucket  = sharedName(databaseOverlay.CHAIN_HEAD)
+	sharedBlockBucket = sharedName(databaseOverlay.FACTOIDBLOCK)
+)
+
+// OpenSharedCache attaches to the cache in the directory, making it if it does not exist.
+// If the cache is already open in this process, the same one is attached to. Each
+// database returned must be closed.
+func OpenSharedCache(dir string) (interfaces.IDatabase, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sharedCacheMux.Lock()
+	defer sharedCacheMux.Unlock()
+
+	c, ok := sharedCaches[abs]
+	if !ok {
+		fi, err := os.Stat(abs)
+		if err == nil && !fi.IsDir() {
+			return nil, fmt.Errorf("The path %s is a file, the shared cache is a directory", abs)
+		}
+		err = os.MkdirAll(abs, 0700)
+		if err != nil {
+			return nil, err
+		}
+
+		c = new(SharedCache)
+		c.dir = abs
+		c.mem = make(map[string]map[string][]byte)
+		c.tryLock()
+		sharedCaches[abs] = c
+	}
+
+	c.refs++
+	return &sharedCacheDB{cache: c}, nil
+}
+
+// IsSharedCacheWriter is true if the database is a shared cache, and this process is
+// the one that writes to it
+func IsSharedCacheWriter(db interfaces.IDatabase) bool {
+	s, ok := db.(*sharedCacheDB)
+	if !ok {
+		return false
+	}
+	s.cache.Lock()
+	defer s.cache.Unlock()
+	return s.cache.writer
+}
+
+func (c *SharedCache) lockPath() string {
+	return filepath.Join(c.dir, sharedLockName)
+}
+
+// tryLock tries to become the writer. Must be called with the cache locked, or before
+// anyone else can see it.
+func (c *SharedCache) tryLock() bool {
+	c.lastTry = time.Now()
+	path := c.lockPath()
+
+	c.removeStaleLock()
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return false
+	}
+	token := fmt.Sprintf("%d %d", os.Getpid(), time.Now().UnixNano())
+	_, err = f.WriteString(token)
+	f.Close()
+	c.token = token
+	if err != nil || !c.ownsLock() {
+		// Moved aside by a process that found it while we were writing the token
+		if err != nil {
+			os.Remove(path)
+		}
+		return false
+	}
+
+	c.writer = true
+	c.stopBeat = make(chan struct{})
+	go c.heartbeat(c.stopBeat)
+
+	// Anything kept in memory can now be shared. The heads go last, after their blocks.
+	buckets := make([]string, 0, len(c.mem))
+	for bucket := range c.mem {
+		if bucket != sharedHeadBucket {
+			buckets = append(buckets, bucket)
+		}
+	}
+	if c.mem[sharedHeadBucket] != nil {
+		buckets = append(buckets, sharedHeadBucket)
+	}
+	for _, bucket := range buckets {
+		records := c.mem[bucket]
+		for key, data := range records {
+			if !c.olderHead(bucket, key, data) {
+				if err := c.writeFile(bucket, key, data); err != nil {
+					return true
+				}
+			}
+			delete(records, key)
+		}
+		delete(c.mem, bucket)
+	}
+	return true
+}
+
+// removeStaleLock removes the lock file if it has not been touched for sharedLockStale.
+// Another process can find the same stale lock, remove it and make its own before this
+// one removes it, so the lock is moved aside first and only removed if it is still the
+// stale one. A fresh lock moved aside is put back.
+func (c *SharedCache) removeStaleLock() {
+	path := c.lockPath()
+	fi, err := os.Stat(path)
+	if err != nil || time.Since(fi.ModTime()) <= sharedLockStale {
+		return
+	}
+
+	aside := fmt.Sprintf("%s.%d-%d", path, os.Getpid(), time.Now().UnixNano())
+	if os.Rename(path, aside) != nil {
+		return // Someone else moved it
+	}
+	moved, err := os.Stat(aside)
+	if err == nil && time.Since(moved.ModTime()) <= sharedLockStale {
+		// Not the stale lock, unless a newer lock was made since, put it back. Link fails if
+		// there is a lock again.
+		os.Link(aside, path)
+	}
+	os.Remove(aside)
+}
+
+// heartbeat keeps the lock file fresh, so no one takes it from a writer still running
+func (c *SharedCache) heartbeat(stop chan struct{}) {
+	ticker := time.NewTicker(sharedLockBeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.Lock()
+			if !c.ownsLock() {
+				// Taken by someone who thought we were gone
+				c.writer = false
+				c.Unlock()
+				return
+			}
+			now := time.Now()
+			os.Chtimes(c.lockPath(), now, now)
+			c.Unlock()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (c *SharedCache) ownsLock() bool {
+	data, err := ioutil.ReadFile(c.lockPath())
+	return err == nil && string(data) == c.token
+}
+
+// canWrite is true if records can go to the files. A process that is not the writer
+// tries to take the lock every so often, in case the writer is gone.
+func (c *SharedCache) canWrite() bool {
+	if !c.writer && time.Since(c.lastTry) > sharedLockBeat {
+		c.tryLock()
+	}
+	return c.writer
+}
+
+func (c *SharedCache) release() {
+	if !c.writer {
+		return
+	}
+	close(c.stopBeat)
+	if c.ownsLock() {
+		os.Remove(c.lockPath())
+	}
+	c.writer = false
+}
+
+// recordPath returns the file of a record. Records are spread over directories by the
+// end of the key, which varies the most for both heights and hashes.
+func (c *SharedCache) recordPath(bucket string, key string) string {
+	shard := "_"
+	if len(key) >= 2 {
+		shard = key[len(key)-2:]
+	}
+	return filepath.Join(c.dir, bucket, shard, key)
+}
+
+// sharedName is the name of the file or directory of a key or bucket
+func sharedName(b []byte) string {
+	if len(b) == 0 {
+		return "_"
+	}
+	return hex.EncodeToString(b)
+}
+
+// parseSharedName reverses sharedName. Anything else, such as a temporary file, fails.
+func parseSharedName(name string) ([]byte, error) {
+	if name == "_" {
+		return []byte{}, nil
+	}
+	return hex.DecodeString(name)
+}
+
+func (c *SharedCache) writeFile(bucket string, key string, data []byte) error {
+	path := c.recordPath(bucket, key)
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// olderHead is true if the record is the head of a chain, and the head in the files is of
+// a higher block. A head whose block cannot be found is written. Must be called with the
+// cache locked.
+func (c *SharedCache) olderHead(bucket string, key string, data []byte) bool {
+	if bucket != sharedHeadBucket {
+		return false
+	}
+	current, err := c.readFile(bucket, key)
+	if err != nil || current == nil || bytes.Equal(current, data) {
+		return false
+	}
+	currentHeight, ok := c.blockHeight(current)
+	if !ok {
+		return false
+	}
+	height, ok := c.blockHeight(data)
+	return ok && height < currentHeight
+}
+
+// blockHeight returns the height of the factoid block with the hash given, if the cache
+// has it. Must be called with the cache locked.
+func (c *SharedCache) blockHeight(hash []byte) (uint32, bool) {
+	b, k := sharedBlockBucket, sharedName(hash)
+	data, err := c.readFile(b, k)
+	if err == nil && data == nil {
+		data = c.mem[b][k]
+	}
+	if err != nil || data == nil {
+		return 0, false
+	}
+	block, err := factoid.UnmarshalFBlock(data)
+	if err != nil {
+		return 0, false
+	}
+	return block.GetDatabaseHeight(), true
+}
+
+func (c *SharedCache) readFile(bucket string, key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(c.recordPath(bucket, key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (c *SharedCache) put(bucket []byte, key []byte, data interfaces.BinaryMarshallable) error {
+	raw, err := data.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	b, k := sharedName(bucket), sharedName(key)
+
+	c.Lock()
+	defer c.Unlock()
+	if c.canWrite() {
+		if c.olderHead(b, k, raw) {
+			return nil
+		}
+		return c.writeFile(b, k, raw)
+	}
+
+	if c.mem[b] == nil {
+		c.mem[b] = make(map[string][]byte)
+	}
+	c.mem[b][k] = raw
+	return nil
+}
+
+func (c *SharedCache) get(bucket []byte, key []byte) ([]byte, error) {
+	b, k := sharedName(bucket), sharedName(key)
+
+	// The files come first, the writer keeps them newer than what we have
+	data, err := c.readFile(b, k)
+	if err != nil || data != nil {
+		return data, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	return c.mem[b][k], nil
+}
+
+func (c *SharedCache) listKeys(bucket []byte) ([][]byte, error) {
+	b := sharedName(bucket)
+	found := make(map[string]bool)
+
+	shards, err := ioutil.ReadDir(filepath.Join(c.dir, b))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, shard := range shards {
+		if !shard.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(c.dir, b, shard.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			found[f.Name()] = true
+		}
+	}
+
+	c.Lock()
+	for k := range c.mem[b] {
+		found[k] = true
+	}
+	c.Unlock()
+
+	var keys [][]byte
+	for name := range found {
+		key, err := parseSharedName(name)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Sort(ByteSlices(keys))
+	return keys, nil
+}
+
+func (c *SharedCache) listBuckets() ([][]byte, error) {
+	found := make(map[string]bool)
+
+	dirs, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dirs {
+		if d.IsDir() {
+			found[d.Name()] = true
+		}
+	}
+
+	c.Lock()
+	for b := range c.mem {
+		found[b] = true
+	}
+	c.Unlock()
+
+	var buckets [][]byte
+	for name := range found {
+		bucket, err := parseSharedName(name)
+		if err != nil {
+			continue
+		}
+		buckets = append(buckets, bucket)
+	}
+	sort.Sort(ByteSlices(buckets))
+	return buckets, nil
+}
+
+// remove deletes a record. Only the writer can remove a record from the files, anyone
+// else only forgets what it kept in memory.
+func (c *SharedCache) remove(bucket []byte, key []byte) error {
+	b, k := sharedName(bucket), sharedName(key)
+
+	c.Lock()
+	defer c.Unlock()
+	delete(c.mem[b], k)
+	if c.canWrite() {
+		err := os.Remove(c.recordPath(b, k))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *SharedCache) clear(bucket []byte) error {
+	b := sharedName(bucket)
+
+	c.Lock()
+	defer c.Unlock()
+	delete(c.mem, b)
+	if c.canWrite() {
+		return os.RemoveAll(filepath.Join(c.dir, b))
+	}
+	return nil
+}
+
+// sharedCacheDB is one attachment to a SharedCache. The cache is closed once every
+// attachment is.
+type sharedCacheDB struct {
+	cache  *SharedCache
+	closed bool
+}
+
+var _ interfaces.IDatabase = (*sharedCacheDB)(nil)
+
+func (s *sharedCacheDB) Put(bucket, key []byte, data interfaces.BinaryMarshallable) error {
+	return s.cache.put(bucket, key, data)
+}
+
+func (s *sharedCacheDB) PutInBatch(records []interfaces.Record) error {
+	for _, r := range records {
+		err := s.cache.put(r.Bucket, r.Key, r.Data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sharedCacheDB) Get(bucket, key []byte, destination interfaces.BinaryMarshallable) (interfaces.BinaryMarshallable, error) {
+	data, err := s.cache.get(bucket, key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	err = destination.UnmarshalBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return destination, nil
+}
+
+func (s *sharedCacheDB) GetAll(bucket []byte, sample interfaces.BinaryMarshallableAndCopyable) ([]interfaces.BinaryMarshallableAndCopyable, [][]byte, error) {
+	keys, err := s.cache.listKeys(bucket)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	answer := make([]interfaces.BinaryMarshallableAndCopyable, 0, len(keys))
+	answerKeys := make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		data, err := s.cache.get(bucket, k)
+		if err != nil {
+			return nil, nil, err
+		}
+		if data == nil { // Removed since listed
+			continue
+		}
+
+		dest := sample.New()
+		err = dest.UnmarshalBinary(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		answer = append(answer, dest)
+		answerKeys = append(answerKeys, k)
+	}
+	return answer, answerKeys, nil
+}
+
+func (s *sharedCacheDB) Delete(bucket, key []byte) error {
+	return s.cache.remove(bucket, key)
+}
+
+func (s *sharedCacheDB) Clear(bucket []byte) error {
+	return s.cache.clear(bucket)
+}
+
+func (s *sharedCacheDB) ListAllKeys(bucket []byte) ([][]byte, error) {
+	return s.cache.listKeys(bucket)
+}
+
+func (s *sharedCacheDB) ListAllBuckets() ([][]byte, error) {
+	return s.cache.listBuckets()
+}
+
+func (s *sharedCacheDB) Trim() {
+}
+
+// Close detaches from the cache. It can be called more than once.
+func (s *sharedCacheDB) Close() error {
+	sharedCacheMux.Lock()
+	defer sharedCacheMux.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	c := s.cache
+	c.refs--
+	if c.refs > 0 {
+		return nil
+	}
+
+	c.Lock()
+	c.release()
+	c.Unlock()
+	delete(sharedCaches, c.dir)
+	return nil
+}
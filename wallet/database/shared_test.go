@@ -0,0 +1,122 @@
+package database_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet/database"
+)
+
+func TestSharedCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shared-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bucket, key := []byte("blocks"), []byte{0x00, 0x01}
+
+	a, err := OpenSharedCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSharedCacheWriter(a) {
+		t.Fatal("The first to open the cache should write to it")
+	}
+	// A second wallet in the same process attaches to the same cache
+	b, err := OpenSharedCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.Put(bucket, key, NewRawData([]byte("written")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := b.Get(bucket, key, new(RawData))
+	if err != nil || data == nil || !bytes.Equal(data.(*RawData).Data, []byte("written")) {
+		t.Fatal("Record not found by the other attachment")
+	}
+
+	keys, err := b.ListAllKeys(bucket)
+	if err != nil || len(keys) != 1 || !bytes.Equal(keys[0], key) {
+		t.Fatalf("Expected the one key, found %x", keys)
+	}
+
+	a.Close()
+	a.Close() // Closing twice must not detach the other
+	if !IsSharedCacheWriter(b) {
+		t.Fatal("Detaching one wallet released the cache")
+	}
+	b.Close()
+
+	// Another process holds the lock
+	lock := filepath.Join(dir, "writer.lock")
+	err = ioutil.WriteFile(lock, []byte("other"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenSharedCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsSharedCacheWriter(r) {
+		t.Fatal("Took the lock from a running writer")
+	}
+	data, err = r.Get(bucket, key, new(RawData))
+	if err != nil || data == nil {
+		t.Fatal("A reader cannot read what the writer wrote")
+	}
+
+	other := []byte{0x00, 0x02}
+	err = r.Put(bucket, other, NewRawData([]byte("memory")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = r.Get(bucket, other, new(RawData))
+	if err != nil || data == nil {
+		t.Fatal("A reader lost what it wrote")
+	}
+	r.Close()
+
+	// What the reader wrote was never shared
+	r, err = OpenSharedCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = r.Get(bucket, other, new(RawData))
+	if err != nil || data != nil {
+		t.Fatal("A reader wrote to the shared files")
+	}
+	r.Close()
+
+	if data, _ := ioutil.ReadFile(lock); string(data) != "other" {
+		t.Fatal("A reader removed the lock of the writer")
+	}
+
+	// A writer that did not exit cleanly leaves a stale lock
+	old := time.Now().Add(-time.Hour)
+	err = os.Chtimes(lock, old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := OpenSharedCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSharedCacheWriter(w) {
+		t.Fatal("A stale lock was not taken")
+	}
+	if aside, _ := filepath.Glob(lock + ".*"); len(aside) != 0 {
+		t.Fatalf("The stale lock was left at %v", aside)
+	}
+	w.Close()
+	if _, err := os.Stat(lock); !os.IsNotExist(err) {
+		t.Fatal("The lock was not released on close")
+	}
+}
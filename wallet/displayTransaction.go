@@ -20,6 +20,10 @@ type DisplayTransaction struct {
 	Date      string
 	Time      string
 	ExactTime time.Time
+
+	// Status of a transaction the wallet sent that is not in the transaction database
+	// yet, see Broadcast. Empty once it is.
+	Status string `json:",omitempty"`
 }
 
 func (a *DisplayTransaction) IsSameAs(b DisplayTransaction) bool {
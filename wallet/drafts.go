@@ -0,0 +1,348 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// The factom wallet only keeps transactions in memory, by name. Every transaction the GUI
+// puts together is a draft, named by a random ID, so any number can be pending at once.
+// Drafts are saved in the GUI database and loaded again on launch. A draft is removed
+// once it is sent.
+
+var draftsBucket = []byte("drafts")
+
+// MaxDraftLabelLength is the longest a draft label is allowed to be
+const MaxDraftLabelLength int = 60
+
+// ErrDraftNotFound is returned when no draft has the ID given
+var ErrDraftNotFound = errors.New("No draft found with that ID. It may have been sent or deleted.")
+
+// Draft is a transaction that has not been sent. The ID is also its name in the factom wallet.
+type Draft struct {
+	ID          string
+	Label       string
+	Created     int64  // Unix time
+	Updated     int64  // Unix time
+	Transaction string // As exported by ExportTransaction, empty until it has been exported
+}
+
+func (d *Draft) MarshalBinary() ([]byte, error) {
+	return json.Marshal(d)
+}
+
+func (d *Draft) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	err = json.Unmarshal(data, d)
+	return nil, err
+}
+
+func (d *Draft) UnmarshalBinary(data []byte) error {
+	_, err := d.UnmarshalBinaryData(data)
+	return err
+}
+
+func (d *Draft) New() interfaces.BinaryMarshallableAndCopyable {
+	return new(Draft)
+}
+
+// DraftInfo is a draft with what its transaction holds, for display
+type DraftInfo struct {
+	Draft
+	Inputs  []TransactionAddressInfo
+	Outputs []TransactionAddressInfo
+	Signed  bool
+}
+
+// DraftInfos is used for sorting, oldest first
+type DraftInfos []DraftInfo
+
+func (slice DraftInfos) Len() int {
+	return len(slice)
+}
+
+func (slice DraftInfos) Less(i, j int) bool {
+	return slice[i].Created < slice[j].Created
+}
+
+func (slice DraftInfos) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+func newDraftID() (string, error) {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+func checkDraftLabel(label string) error {
+	if len(label) > MaxDraftLabelLength {
+		return fmt.Errorf("Label too long, must be less than %d characters", MaxDraftLabelLength)
+	}
+	return nil
+}
+
+// loadDrafts puts the saved drafts back into the factom wallet
+func (w *WalletDB) loadDrafts() error {
+	w.draftLock.Lock()
+	defer w.draftLock.Unlock()
+
+	w.drafts = make(map[string]*Draft)
+	list, _, err := w.GUIlDB.GetAll(draftsBucket, new(Draft))
+	if err != nil {
+		return err
+	}
+
+	for _, data := range list {
+		d, ok := data.(*Draft)
+		if !ok {
+			continue
+		}
+		err = w.loadDraftTransaction(d)
+		if err != nil {
+			fmt.Printf("Draft %s could not be loaded: %s\n", d.ID, err.Error())
+			continue
+		}
+		w.drafts[d.ID] = d
+	}
+	return nil
+}
+
+// loadDraftTransaction replaces the transaction of a draft with the one last saved
+func (w *WalletDB) loadDraftTransaction(d *Draft) error {
+	w.Wallet.DeleteTransaction(d.ID)
+	if d.Transaction == "" {
+		return w.Wallet.NewTransaction(d.ID)
+	}
+	return w.ImportTransaction(d.ID, d.Transaction)
+}
+
+// putDraft saves a draft with its transaction as it is now. The draft lock must be held.
+func (w *WalletDB) putDraft(d *Draft) error {
+	if j, err := w.ExportTransaction(d.ID); err == nil {
+		d.Transaction = j
+	}
+	d.Updated = time.Now().Unix()
+
+	err := w.GUIlDB.Put(draftsBucket, []byte(d.ID), d)
+	if err != nil {
+		return err
+	}
+	w.drafts[d.ID] = d
+	return nil
+}
+
+// NewDraft makes an empty draft
+func (w *WalletDB) NewDraft(label string) (*Draft, error) {
+	return w.newDraft(label, "")
+}
+
+// ImportDraft makes a draft from a transaction exported by ExportTransaction
+func (w *WalletDB) ImportDraft(label string, transaction string) (*Draft, error) {
+	return w.newDraft(label, transaction)
+}
+
+func (w *WalletDB) newDraft(label string, transaction string) (*Draft, error) {
+	if err := checkDraftLabel(label); err != nil {
+		return nil, err
+	}
+	id, err := newDraftID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	d := &Draft{ID: id, Label: label, Created: now, Transaction: transaction}
+	err = w.loadDraftTransaction(d)
+	if err != nil {
+		w.Wallet.DeleteTransaction(id)
+		return nil, err
+	}
+
+	w.draftLock.Lock()
+	defer w.draftLock.Unlock()
+	err = w.putDraft(d)
+	if err != nil {
+		w.Wallet.DeleteTransaction(id)
+		return nil, err
+	}
+	c := *d
+	return &c, nil
+}
+
+// UpdateDraft changes the label of a draft
+func (w *WalletDB) UpdateDraft(id string, label string) error {
+	if err := checkDraftLabel(label); err != nil {
+		return err
+	}
+
+	w.draftLock.Lock()
+	defer w.draftLock.Unlock()
+	d, ok := w.drafts[id]
+	if !ok {
+		return ErrDraftNotFound
+	}
+	d.Label = label
+	return w.putDraft(d)
+}
+
+// DuplicateDraft copies a draft under a new ID. No label keeps the label of the draft copied.
+func (w *WalletDB) DuplicateDraft(id string, label string) (*Draft, error) {
+	w.draftLock.Lock()
+	d, ok := w.drafts[id]
+	if ok && label == "" {
+		label = d.Label
+	}
+	w.draftLock.Unlock()
+	if !ok {
+		return nil, ErrDraftNotFound
+	}
+
+	j, err := w.ExportTransaction(id)
+	if err != nil {
+		return nil, err
+	}
+	return w.newDraft(label, j)
+}
+
+// DeleteDraft removes a draft and its transaction
+func (w *WalletDB) DeleteDraft(id string) error {
+	w.draftLock.Lock()
+	defer w.draftLock.Unlock()
+	if _, ok := w.drafts[id]; !ok {
+		return ErrDraftNotFound
+	}
+
+	err := w.GUIlDB.Delete(draftsBucket, []byte(id))
+	if err != nil {
+		return err
+	}
+	delete(w.drafts, id)
+	w.Wallet.DeleteTransaction(id)
+	return nil
+}
+
+// IsDraft is true if a draft has the ID
+func (w *WalletDB) IsDraft(id string) bool {
+	w.draftLock.Lock()
+	defer w.draftLock.Unlock()
+	_, ok := w.drafts[id]
+	return ok
+}
+
+// GetDraft returns a draft, and what its transaction holds
+func (w *WalletDB) GetDraft(id string) (*DraftInfo, error) {
+	w.draftLock.Lock()
+	d, ok := w.drafts[id]
+	var info DraftInfo
+	if ok {
+		info.Draft = *d
+	}
+	w.draftLock.Unlock()
+	if !ok {
+		return nil, ErrDraftNotFound
+	}
+
+	t := w.Wallet.GetTransactions()[id]
+	if t == nil {
+		return &info, nil
+	}
+	for _, in := range t.GetInputs() {
+		info.Inputs = append(info.Inputs, w.draftAddressInfo(primitives.ConvertFctAddressToUserStr(in.GetAddress()), in.GetAmount(), "FCT"))
+	}
+	for _, out := range t.GetOutputs() {
+		info.Outputs = append(info.Outputs, w.draftAddressInfo(primitives.ConvertFctAddressToUserStr(out.GetAddress()), out.GetAmount(), "FCT"))
+	}
+	for _, out := range t.GetECOutputs() {
+		info.Outputs = append(info.Outputs, w.draftAddressInfo(primitives.ConvertECAddressToUserStr(out.GetAddress()), out.GetAmount(), "EC"))
+	}
+	info.Signed = len(info.Inputs) > 0 && t.ValidateSignatures() == nil
+	return &info, nil
+}
+
+func (w *WalletDB) draftAddressInfo(addr string, amount uint64, kind string) TransactionAddressInfo {
+	name := ""
+	if anp, list := w.GetGUIAddress(addr); list != -1 && anp != nil {
+		name = anp.Name
+	}
+	return TransactionAddressInfo{Name: name, Address: addr, Amount: amount, Type: kind}
+}
+
+// ListDrafts returns every draft, oldest first
+func (w *WalletDB) ListDrafts() []DraftInfo {
+	w.draftLock.Lock()
+	var ids []string
+	for id := range w.drafts {
+		ids = append(ids, id)
+	}
+	w.draftLock.Unlock()
+
+	list := make(DraftInfos, 0, len(ids))
+	for _, id := range ids {
+		info, err := w.GetDraft(id)
+		if err == nil {
+			list = append(list, *info)
+		}
+	}
+	sort.Sort(list)
+	return list
+}
+
+// saveDraft saves the transaction of a draft after it has changed. Transactions that are
+// not drafts are left alone.
+func (w *WalletDB) saveDraft(id string) error {
+	w.draftLock.Lock()
+	defer w.draftLock.Unlock()
+	d, ok := w.drafts[id]
+	if !ok {
+		return nil
+	}
+	return w.putDraft(d)
+}
+
+// openDraft empties a draft, so a transaction can be constructed in it. No ID makes a new
+// draft.
+func (w *WalletDB) openDraft(id string) (trans string, created bool, err error) {
+	if id == "" {
+		d, err := w.NewDraft("")
+		if err != nil {
+			return "", false, err
+		}
+		return d.ID, true, nil
+	}
+
+	if !w.IsDraft(id) {
+		return id, false, ErrDraftNotFound
+	}
+	w.Wallet.DeleteTransaction(id)
+	return id, false, w.Wallet.NewTransaction(id)
+}
+
+// closeDraft saves a draft once a transaction is constructed in it. If constructing failed,
+// a new draft is removed, and one that existed is put back the way it was.
+func (w *WalletDB) closeDraft(id string, created bool, err error) error {
+	if err == nil {
+		return w.saveDraft(id)
+	}
+
+	if created {
+		w.DeleteDraft(id)
+		return err
+	}
+	w.draftLock.Lock()
+	if d, ok := w.drafts[id]; ok {
+		w.loadDraftTransaction(d)
+	}
+	w.draftLock.Unlock()
+	return err
+}
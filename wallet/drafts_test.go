@@ -0,0 +1,72 @@
+package wallet_test
+
+import (
+	"testing"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+func TestDrafts(t *testing.T) {
+	// The GUI database holds the drafts, it must outlive the wallet
+	defer UseTempDataDir(t)()
+
+	wal, err := NewWalletDB(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := wal.NewDraft("Rent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := wal.NewDraft("Rent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID == b.ID {
+		t.Fatal("Two drafts have the same ID")
+	}
+	if _, ok := wal.Wallet.GetTransactions()[a.ID]; !ok {
+		t.Fatal("The draft has no transaction")
+	}
+
+	if err = wal.UpdateDraft(a.ID, "Rent for June"); err != nil {
+		t.Fatal(err)
+	}
+	c, err := wal.DuplicateDraft(a.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Label != "Rent for June" {
+		t.Fatalf("The copy is labeled '%s'", c.Label)
+	}
+	if err = wal.DeleteDraft(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = wal.DeleteDraft(b.ID); err != ErrDraftNotFound {
+		t.Fatal("Deleted a draft twice")
+	}
+	wal.Close()
+
+	// Drafts survive a restart
+	wal, err = NewWalletDB(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+
+	list := wal.ListDrafts()
+	if len(list) != 2 {
+		t.Fatalf("Expected 2 drafts, found %d", len(list))
+	}
+	info, err := wal.GetDraft(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Label != "Rent for June" {
+		t.Fatalf("Label not saved, found '%s'", info.Label)
+	}
+	if _, ok := wal.Wallet.GetTransactions()[c.ID]; !ok {
+		t.Fatal("The transaction of a draft was not loaded")
+	}
+}
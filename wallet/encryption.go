@@ -0,0 +1,143 @@
+package wallet
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/enterprise-wallet/wallet/database"
+)
+
+// An encrypted wallet keeps its private keys and seed encrypted in the wallet database.
+// It launches locked, and must be unlocked with the passphrase before anything
+// needing a secret can be done. The GUI database is not encrypted, it only holds names.
+
+// WALLET_LOCK_TIMEOUT is how long an unlocked wallet can sit idle before it locks itself.
+// 0 disables the timeout.
+var WALLET_LOCK_TIMEOUT time.Duration = 10 * time.Minute
+
+// ErrWalletLocked is returned by any action that needs a secret while the wallet is locked
+var ErrWalletLocked = database.ErrLocked
+
+type walletLock struct {
+	encryptedDB *database.EncryptedDB // nil if the wallet is not encrypted
+	lockTimer   *time.Timer
+	sync.Mutex
+}
+
+// IsEncrypted returns true if the wallet database is encrypted with a passphrase
+func (w *WalletDB) IsEncrypted() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.lock.encryptedDB != nil
+}
+
+// IsLocked returns true if the wallet is encrypted and not unlocked
+func (w *WalletDB) IsLocked() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.lock.encryptedDB != nil && w.lock.encryptedDB.IsLocked()
+}
+
+// Unlock decrypts the wallet with the passphrase. It will lock again after WALLET_LOCK_TIMEOUT
+// of inactivity.
+func (w *WalletDB) Unlock(passphrase string) error {
+	w.lock.Lock()
+	enc := w.lock.encryptedDB
+	w.lock.Unlock()
+
+	if enc == nil {
+		return fmt.Errorf("The wallet is not encrypted")
+	}
+
+	err := enc.Unlock(passphrase)
+	if err != nil {
+		return err
+	}
+	w.ResetLockTimer()
+
+	// The journal could not be checked against the wallet while locked
+	err = w.recoverJournal()
+	if err != nil {
+		return err
+	}
+
+	// Addresses could not be read while locked
+	err = w.UpdateGUIDB()
+	if err != nil {
+		return err
+	}
+
+	// The cache could not be checked against the seed while locked
+	if w.cacheSeedHash != "" && w.cacheSeedHash != w.seedHash() {
+		w.InvalidateTransactionCache()
+	}
+	return nil
+}
+
+// Lock forgets the key of an encrypted wallet
+func (w *WalletDB) Lock() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.lock.encryptedDB == nil {
+		return fmt.Errorf("The wallet is not encrypted")
+	}
+
+	if w.lock.lockTimer != nil {
+		w.lock.lockTimer.Stop()
+		w.lock.lockTimer = nil
+	}
+	w.lock.encryptedDB.LockDB()
+	return nil
+}
+
+// EncryptWallet encrypts the wallet database with the passphrase. The wallet is left unlocked.
+func (w *WalletDB) EncryptWallet(passphrase string) error {
+	w.lock.Lock()
+	if w.lock.encryptedDB != nil {
+		w.lock.Unlock()
+		return fmt.Errorf("The wallet is already encrypted")
+	}
+
+	enc, err := database.EncryptDatabase(w.Wallet.DBO.DB, passphrase)
+	if err != nil {
+		w.lock.Unlock()
+		return err
+	}
+	w.Wallet.DBO.DB = enc
+	w.lock.encryptedDB = enc
+	w.lock.Unlock()
+
+	// The snapshots taken before hold the keys in the clear
+	w.encryptSnapshots(passphrase)
+
+	w.ResetLockTimer()
+	return nil
+}
+
+// ResetLockTimer restarts the idle timeout of an unlocked wallet. Should be called on any
+// user activity.
+func (w *WalletDB) ResetLockTimer() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.lock.encryptedDB == nil || w.lock.encryptedDB.IsLocked() || WALLET_LOCK_TIMEOUT <= 0 {
+		return
+	}
+
+	if w.lock.lockTimer != nil {
+		w.lock.lockTimer.Stop()
+	}
+	w.lock.lockTimer = time.AfterFunc(WALLET_LOCK_TIMEOUT, func() {
+		w.Lock()
+	})
+}
+
+// checkUnlocked returns ErrWalletLocked if the secrets cannot be read
+func (w *WalletDB) checkUnlocked() error {
+	if w.IsLocked() {
+		return ErrWalletLocked
+	}
+	return nil
+}
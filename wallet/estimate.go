@@ -0,0 +1,327 @@
+package wallet
+
+import (
+	"fmt"
+
+	"github.com/FactomProject/enterprise-wallet/fct"
+	"github.com/FactomProject/factom"
+)
+
+// An estimate works out what make-transaction would do, without putting a transaction
+// in the wallet or signing anything. The inputs are chosen the same way, and the fee is
+// calculated on a transaction like the one that would be made.
+
+// The fee schedule of factomd, in entry credits
+const (
+	feePerKiB       uint64 = 1  // Of the transaction, without signatures, rounded up
+	feePerOutput    uint64 = 10 // Factoid or entry credit output
+	feePerSignature uint64 = 10
+)
+
+// EstimateRequest is the transaction to estimate. The types are those of make-transaction.
+type EstimateRequest struct {
+	TransType     string // factoid, ec, custom, nosig or sweep
+	ToAddresses   []string
+	ToAmounts     []uint64 // Factoshis to a factoid address, entry credits to an entry credit address
+	FromAddresses []string
+	FromAmounts   []uint64 // Factoshis
+	FeeAddress    string
+	CoinSelection string
+}
+
+// EstimateInput is an input of an estimate
+type EstimateInput struct {
+	Address string
+	Amount  uint64 // Factoshis, with the fee if it pays it
+	Fee     uint64 // Factoshis for its signature, the SignatureFee of the breakdown
+}
+
+// EstimateOutput is an output of an estimate
+type EstimateOutput struct {
+	Address      string
+	Amount       uint64 // Factoshis, less the fee if it pays it
+	EntryCredits uint64 // For an entry credit address
+	Fee          uint64 // Factoshis for the output, the OutputFee of the breakdown
+}
+
+// FeeBreakdown is what the fee of an estimate pays for, in factoshis. Total is the sum
+// of the size, output and signature fees.
+type FeeBreakdown struct {
+	Size          int // Bytes of the transaction, without signatures
+	SizeFee       uint64
+	OutputFee     uint64 // Of each output
+	OutputFees    uint64
+	SignatureFee  uint64 // Of each input
+	SignatureFees uint64
+	Total         uint64
+}
+
+// newFeeBreakdown works out the fee of a transaction from the fee schedule
+func newFeeBreakdown(size int, outputs int, signatures int, rate uint64) FeeBreakdown {
+	b := FeeBreakdown{Size: size, OutputFee: feePerOutput * rate, SignatureFee: feePerSignature * rate}
+	b.SizeFee = uint64((size+1023)/1024) * feePerKiB * rate
+	b.OutputFees = uint64(outputs) * b.OutputFee
+	b.SignatureFees = uint64(signatures) * b.SignatureFee
+	b.Total = b.SizeFee + b.OutputFees + b.SignatureFees
+	return b
+}
+
+// EstimateBalance is the balance of an address in the wallet, before and after
+type EstimateBalance struct {
+	Address string
+	Name    string
+	Type    string // FCT in factoshis, or EC in entry credits
+	Before  int64
+	After   int64
+}
+
+// TransactionEstimate is what a transaction would look like
+type TransactionEstimate struct {
+	Rate     uint64 // Factoshis per entry credit
+	Inputs   []EstimateInput
+	Outputs  []EstimateOutput
+	Total    uint64 // Factoshis sent, without the fee
+	Fee      FeeBreakdown
+	Balances []EstimateBalance
+}
+
+// EstimateTransaction works out the inputs, outputs, fee and balances of a transaction,
+// without making it
+func (wal *WalletDB) EstimateTransaction(req EstimateRequest) (*TransactionEstimate, error) {
+	if len(req.ToAddresses) != len(req.ToAmounts) {
+		return nil, fmt.Errorf("Lengths of output addresses to amounts does not match")
+	} else if len(req.FromAddresses) != len(req.FromAmounts) && req.TransType != "sweep" {
+		return nil, fmt.Errorf("Lengths of input addresses to amounts does not match")
+	}
+
+	rate, err := getRate()
+	if err != nil {
+		return nil, err
+	}
+
+	toAddresses := req.ToAddresses
+	toAmounts := append([]uint64(nil), req.ToAmounts...)
+	var inputs []AddressBalancePair
+	var feeAddress string
+	spendable := make(map[string]uint64) // Of the inputs chosen by a coin selector
+
+	switch req.TransType {
+	case "factoid", "ec":
+		if len(toAddresses) == 0 {
+			return nil, fmt.Errorf("No recipient given")
+		}
+		selector, err := GetCoinSelector(req.CoinSelection)
+		if err != nil {
+			return nil, err
+		}
+		total, err := outputTotal(toAddresses, toAmounts, rate)
+		if err != nil {
+			return nil, err
+		}
+		list, err := wal.spendableBalances(false)
+		if err != nil {
+			return nil, err
+		}
+		chosen, err := selector.Select(list, total, feeFunc(toAddresses, toAmounts, list, rate))
+		if err != nil {
+			return nil, err
+		}
+		if len(chosen) == 0 {
+			return nil, ErrNotEnoughFactoids
+		}
+		for _, in := range chosen {
+			spendable[in.Address] = in.Balance
+		}
+		inputs, err = payInputs(chosen, total)
+		if err != nil {
+			return nil, err
+		}
+		feeAddress = inputs[len(inputs)-1].Address
+	case "custom", "nosig":
+		for i, addr := range req.FromAddresses {
+			inputs = append(inputs, AddressBalancePair{addr, req.FromAmounts[i]})
+		}
+		total, err := outputTotal(toAddresses, toAmounts, rate)
+		if err != nil {
+			return nil, err
+		}
+		var totalIn uint64
+		for _, in := range inputs {
+			totalIn += in.Balance
+		}
+		if total != totalIn {
+			return nil, fmt.Errorf("The inputs must add up to the outputs. The needed input is: %s FCT.\n", fct.Amount(total))
+		}
+		feeAddress = req.FeeAddress
+	case "sweep":
+		if len(toAddresses) != 1 {
+			return nil, fmt.Errorf("A sweep needs one output address")
+		}
+		if err := wal.checkSweepDestination(toAddresses[0]); err != nil {
+			return nil, err
+		}
+		if len(req.FromAddresses) == 0 {
+			inputs, err = wal.spendableBalances(false)
+		} else {
+			inputs, err = wal.sweepInputs(req.FromAddresses)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(inputs) == 0 {
+			return nil, fmt.Errorf("There are no factoids to sweep")
+		}
+		var total uint64
+		for _, in := range inputs {
+			total += in.Balance
+		}
+		toAmounts = []uint64{total}
+		feeAddress = toAddresses[0]
+	default:
+		return nil, fmt.Errorf("Not a valid type")
+	}
+
+	t, err := newFeeTransaction(toAddresses, toAmounts, inputs, rate)
+	if err != nil {
+		return nil, err
+	}
+	fee, err := t.CalculateFee(rate)
+	if err != nil {
+		return nil, err
+	}
+	data, err := t.MarshalBinarySig()
+	if err != nil {
+		return nil, err
+	}
+
+	e := new(TransactionEstimate)
+	e.Rate = rate
+	e.Fee = newFeeBreakdown(len(data), len(toAddresses), len(inputs), rate)
+	// The transaction will pay what factomd charges, the breakdown must say the same
+	if e.Fee.Total != fee {
+		return nil, fmt.Errorf("The fee is %s FCT, but its breakdown adds up to %s FCT", fct.Amount(fee), fct.Amount(e.Fee.Total))
+	}
+
+	// An output that is the fee address pays the fee, otherwise the input does
+	paid := false
+	for i, addr := range toAddresses {
+		if addr == feeAddress && addr[:2] == "FA" {
+			if toAmounts[i] <= fee {
+				return nil, fmt.Errorf("The output to %s cannot cover the fee", addr)
+			}
+			toAmounts[i] -= fee
+			paid = true
+			break
+		}
+	}
+	for i := range inputs {
+		if paid {
+			break
+		}
+		if inputs[i].Address == feeAddress {
+			balance, ok := spendable[feeAddress]
+			if !ok {
+				balance, err = wal.spendableBalance(feeAddress, true)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if inputs[i].Balance+fee > balance {
+				return nil, ErrNotEnoughFactoids
+			}
+			inputs[i].Balance += fee
+			paid = true
+		}
+	}
+	if !paid {
+		return nil, fmt.Errorf("The fee address must be an input or a factoid output")
+	}
+
+	for _, in := range inputs {
+		e.Inputs = append(e.Inputs, EstimateInput{Address: in.Address, Amount: in.Balance, Fee: e.Fee.SignatureFee})
+	}
+	for i, addr := range toAddresses {
+		out := EstimateOutput{Address: addr, Amount: toAmounts[i], Fee: e.Fee.OutputFee}
+		if addr[:2] == "EC" {
+			out.Amount = toAmounts[i] * rate
+			out.EntryCredits = toAmounts[i]
+		}
+		e.Outputs = append(e.Outputs, out)
+		e.Total += out.Amount
+	}
+
+	e.Balances, err = wal.estimateBalances(e)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// outputTotal returns the factoshis the outputs need. Entry credit amounts are converted at the rate.
+func outputTotal(toAddresses []string, amounts []uint64, rate uint64) (uint64, error) {
+	var total uint64
+	for i, addr := range toAddresses {
+		if !factom.IsValidAddress(addr) {
+			return 0, fmt.Errorf("%s is not a valid address", addr)
+		}
+		switch addr[:2] {
+		case "FA":
+			total += amounts[i]
+		case "EC":
+			total += amounts[i] * rate
+		default:
+			return 0, fmt.Errorf("%s is not a public address", addr)
+		}
+	}
+	return total, nil
+}
+
+// estimateBalances returns the balance of every address of the wallet in an estimate,
+// before and after the transaction
+func (wal *WalletDB) estimateBalances(e *TransactionEstimate) ([]EstimateBalance, error) {
+	var balances []EstimateBalance
+	index := make(map[string]int)
+
+	add := func(addr string, change int64) error {
+		if i, ok := index[addr]; ok {
+			balances[i].After += change
+			return nil
+		}
+		anp, list := wal.GetGUIAddress(addr)
+		if list != 1 && list != 2 || anp == nil {
+			return nil
+		}
+
+		b := EstimateBalance{Address: addr, Name: anp.Name, Type: "FCT"}
+		var err error
+		if addr[:2] == "EC" {
+			b.Type = "EC"
+			b.Before, err = getECBalance(addr)
+		} else {
+			b.Before, err = getFactoidBalance(addr)
+		}
+		if err != nil {
+			return err
+		}
+		b.After = b.Before + change
+		index[addr] = len(balances)
+		balances = append(balances, b)
+		return nil
+	}
+
+	for _, in := range e.Inputs {
+		if err := add(in.Address, -int64(in.Amount)); err != nil {
+			return nil, err
+		}
+	}
+	for _, out := range e.Outputs {
+		change := int64(out.Amount)
+		if out.EntryCredits > 0 {
+			change = int64(out.EntryCredits)
+		}
+		if err := add(out.Address, change); err != nil {
+			return nil, err
+		}
+	}
+	return balances, nil
+}
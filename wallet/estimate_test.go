@@ -0,0 +1,95 @@
+package wallet_test
+
+import (
+	"testing"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+func TestEstimateTransaction(t *testing.T) {
+	defer UseTempDataDir(t)()
+
+	wal, err := NewWalletDB(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+
+	sand, err := wal.AddAddress("Sand", "Fs3E9gV6DXsYzf7Fqx1fVBQPQXV695eP3k5XbmHEZVRLkMdD9qCK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spare, err := wal.AddAddress("Spare", "Fs1uHDWjYANSxXUtbdkLVkhHboaPRz1tADqs7iB16kQq5VTCvKZS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	credits, err := wal.GenerateEntryCreditAddress("Credits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	external := "FA3HRq8jFUhzN9c8iKTBBfXyNyijSnov1ZLJtJMKTXFQNmncWZoE"
+
+	var rate uint64 = 1000
+	defer StubFactomdBalances(rate, map[string]int64{sand.Address: 5e8, spare.Address: 2e8})()
+
+	reqs := []EstimateRequest{
+		{TransType: "factoid", ToAddresses: []string{external}, ToAmounts: []uint64{1e8}},
+		{TransType: "ec", ToAddresses: []string{credits.Address}, ToAmounts: []uint64{100}},
+		{TransType: "custom", ToAddresses: []string{external}, ToAmounts: []uint64{1e8},
+			FromAddresses: []string{sand.Address}, FromAmounts: []uint64{1e8}, FeeAddress: sand.Address},
+		// The output pays the fee
+		{TransType: "nosig", ToAddresses: []string{sand.Address}, ToAmounts: []uint64{1e8},
+			FromAddresses: []string{external}, FromAmounts: []uint64{1e8}, FeeAddress: sand.Address},
+		{TransType: "sweep", ToAddresses: []string{spare.Address}, ToAmounts: []uint64{0},
+			FromAddresses: []string{sand.Address}},
+	}
+
+	for _, req := range reqs {
+		e, err := wal.EstimateTransaction(req)
+		if err != nil {
+			t.Errorf("%s: %s", req.TransType, err.Error())
+			continue
+		}
+
+		f := e.Fee
+		if f.SizeFee == 0 || f.SizeFee+f.OutputFees+f.SignatureFees != f.Total {
+			t.Errorf("%s: the fee breakdown %+v does not add up", req.TransType, f)
+		}
+		if f.OutputFees != uint64(len(e.Outputs))*f.OutputFee || f.SignatureFees != uint64(len(e.Inputs))*f.SignatureFee {
+			t.Errorf("%s: %d outputs and %d inputs do not make the fee breakdown %+v", req.TransType, len(e.Outputs), len(e.Inputs), f)
+		}
+
+		var in, signatureFees, outputFees uint64
+		for _, i := range e.Inputs {
+			in += i.Amount
+			signatureFees += i.Fee
+		}
+		for _, o := range e.Outputs {
+			outputFees += o.Fee
+		}
+		if signatureFees != f.SignatureFees || outputFees != f.OutputFees {
+			t.Errorf("%s: inputs pay %d and outputs %d, the breakdown says %d and %d", req.TransType, signatureFees, outputFees, f.SignatureFees, f.OutputFees)
+		}
+		if in != e.Total+f.Total {
+			t.Errorf("%s: the inputs give %d, the outputs get %d and the fee is %d", req.TransType, in, e.Total, f.Total)
+		}
+
+		if req.TransType == "sweep" {
+			if in != 5e8 {
+				t.Errorf("Swept %d of 500000000", in)
+			}
+			for _, b := range e.Balances {
+				if b.Address == spare.Address && b.After != 2e8+int64(e.Total) {
+					t.Errorf("Expected %d after the sweep, found %d", 2e8+int64(e.Total), b.After)
+				}
+			}
+		}
+	}
+
+	// The input paying the fee cannot cover it on top of the rest of its balance
+	all := EstimateRequest{TransType: "custom", ToAddresses: []string{external}, ToAmounts: []uint64{5e8},
+		FromAddresses: []string{sand.Address}, FromAmounts: []uint64{5e8}, FeeAddress: sand.Address}
+	if _, err = wal.EstimateTransaction(all); err != ErrNotEnoughFactoids {
+		t.Errorf("Expected not enough factoids for the fee, found %v", err)
+	}
+}
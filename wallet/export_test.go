@@ -0,0 +1,48 @@
+package wallet
+
+import (
+	"time"
+
+	"github.com/FactomProject/factom"
+)
+
+// Unexported parts of the wallet, for the tests in wallet_test
+
+func (wal *WalletDB) SweepOutput(trans string, toAddress string, total uint64, rate uint64) (*ReturnTransStruct, error) {
+	return wal.sweepOutput(trans, toAddress, total, rate)
+}
+
+func (w *WalletDB) RecordRawBroadcast(txid string, raw string) error {
+	return w.recordRawBroadcast(txid, raw)
+}
+
+// StubFactomd sends the requests to factomd to f instead, until the function returned is called
+func StubFactomd(f func(req *factom.JSON2Request) (*factom.JSON2Response, error)) func() {
+	old := factomdRequest
+	factomdRequest = f
+	return func() { factomdRequest = old }
+}
+
+func (b *Broadcast) Due(now time.Time) bool {
+	return b.due(now)
+}
+
+// CheckBroadcast asks factomd about a transaction, it needs no wallet
+func CheckBroadcast(b *Broadcast, now time.Time) bool {
+	return new(WalletDB).checkBroadcast(b, now)
+}
+
+// StubFactomdBalances gives the rate and balances given instead of asking factomd, until the
+// function returned is called. Addresses not given have nothing.
+func StubFactomdBalances(rate uint64, balances map[string]int64) func() {
+	oldRate, oldFactoid, oldEC := factomdRate, factomdFactoidBalance, factomdECBalance
+	factomdRate = func() (uint64, error) { return rate, nil }
+	factomdFactoidBalance = func(addr string) (int64, error) { return balances[addr], nil }
+	factomdECBalance = func(addr string) (int64, error) { return balances[addr], nil }
+	return func() { factomdRate, factomdFactoidBalance, factomdECBalance = oldRate, oldFactoid, oldEC }
+}
+
+// RunScheduledPayments makes the scheduled payments due at now, without the scheduler
+func (w *WalletDB) RunScheduledPayments(now time.Time) {
+	w.runScheduledPayments(now, make(chan struct{}))
+}
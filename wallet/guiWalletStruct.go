@@ -1,12 +1,12 @@
 package wallet
 
 import (
-	"bytes"
 	"fmt"
 	"strings"
 	"sync"
 
 	"github.com/FactomProject/enterprise-wallet/address"
+	"github.com/FactomProject/enterprise-wallet/marshal"
 	"github.com/FactomProject/factom"
 )
 
@@ -182,6 +182,30 @@ func (w *WalletStruct) ChangeAddressName(address string, toName string) error {
 	return fmt.Errorf("Could not change name")
 }
 
+// SetAddressPolicy replaces the spending policy of one of the factoid addresses
+func (w *WalletStruct) SetAddressPolicy(address string, frozen bool, reserved string, minBalance uint64) error {
+	anp, list, i := w.GetAddress(address)
+	if list == -1 || anp == nil || i == -1 {
+		return fmt.Errorf("Address not found")
+	} else if list != 1 {
+		return fmt.Errorf("Spending policies can only be set on your factoid addresses")
+	}
+
+	w.Lock()
+	defer w.Unlock()
+	if strings.Compare(w.FactoidAddresses.List[i].Address, address) != 0 { // To be sure
+		return fmt.Errorf("Could not change the spending policy")
+	}
+
+	err := w.FactoidAddresses.List[i].SetReserved(reserved)
+	if err != nil {
+		return err
+	}
+	w.FactoidAddresses.List[i].Frozen = frozen
+	w.FactoidAddresses.List[i].MinBalance = minBalance
+	return nil
+}
+
 func (w *WalletStruct) GetAllAddresses() []address.AddressNamePair {
 	w.RLock()
 	defer w.RUnlock()
@@ -203,6 +227,15 @@ func (w *WalletStruct) GetAllMyGUIAddresses() []address.AddressNamePair {
 	return anpList
 }
 
+// Reset removes all addresses from every list
+func (w *WalletStruct) Reset() {
+	w.Lock()
+	w.FactoidAddresses = address.NewAddressList()
+	w.EntryCreditAddresses = address.NewAddressList()
+	w.ExternalAddresses = address.NewAddressList()
+	w.Unlock()
+}
+
 // Simply remove all seeded flags
 func (w *WalletStruct) ResetSeeded() {
 	w.Lock()
@@ -243,46 +276,78 @@ func (w *WalletStruct) IsSameAs(b *WalletStruct) bool {
 	return true
 }
 
+// Version of the WalletStruct binary format, and its field tags
+const (
+	walletStructVersion byte = 1
+
+	walletTagFactoidAddresses     uint64 = 1
+	walletTagEntryCreditAddresses uint64 = 2
+	walletTagExternalAddresses    uint64 = 3
+)
+
 func (w *WalletStruct) MarshalBinary() ([]byte, error) {
 	w.Lock()
 	defer w.Unlock()
-	buf := new(bytes.Buffer)
+	m := marshal.NewWriter()
 
 	data, err := w.FactoidAddresses.MarshalBinary()
 	if err != nil {
 		return nil, err
 	}
-	buf.Write(data)
+	m.Bytes(walletTagFactoidAddresses, data)
 
 	data, err = w.EntryCreditAddresses.MarshalBinary()
 	if err != nil {
 		return nil, err
 	}
-	buf.Write(data)
+	m.Bytes(walletTagEntryCreditAddresses, data)
 
 	data, err = w.ExternalAddresses.MarshalBinary()
 	if err != nil {
 		return nil, err
 	}
-	buf.Write(data)
+	m.Bytes(walletTagExternalAddresses, data)
 
-	return buf.Next(buf.Len()), nil
+	return m.Marshal(walletStructVersion), nil
 }
 
 func (w *WalletStruct) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
 	w.Lock()
 	defer w.Unlock()
 
-	if w.FactoidAddresses == nil {
-		w.FactoidAddresses = address.NewAddressList()
+	w.FactoidAddresses = address.NewAddressList()
+	w.EntryCreditAddresses = address.NewAddressList()
+	w.ExternalAddresses = address.NewAddressList()
+
+	if !marshal.IsVersioned(data) {
+		return w.unmarshalLegacy(data)
 	}
-	if w.EntryCreditAddresses == nil {
-		w.EntryCreditAddresses = address.NewAddressList()
+
+	_, fields, newData, err := marshal.Unmarshal(data)
+	if err != nil {
+		return data, err
 	}
-	if w.ExternalAddresses == nil {
-		w.ExternalAddresses = address.NewAddressList()
+
+	for _, f := range fields {
+		switch f.Tag {
+		case walletTagFactoidAddresses:
+			err = w.FactoidAddresses.UnmarshalBinary(f.Data)
+		case walletTagEntryCreditAddresses:
+			err = w.EntryCreditAddresses.UnmarshalBinary(f.Data)
+		case walletTagExternalAddresses:
+			err = w.ExternalAddresses.UnmarshalBinary(f.Data)
+		}
+		if err != nil {
+			return data, err
+		}
 	}
 
+	return newData, nil
+}
+
+// unmarshalLegacy reads the layout used before the versioned format, the 3
+// address lists one after another
+func (w *WalletStruct) unmarshalLegacy(data []byte) (newData []byte, err error) {
 	newData = data
 	newData, err = w.FactoidAddresses.UnmarshalBinaryData(newData)
 	if err != nil {
@@ -307,6 +372,51 @@ func (w *WalletStruct) UnmarshalBinary(data []byte) error {
 	return err
 }
 
+// UnmarshalBinaryChecked is UnmarshalBinary, but addresses that cannot be decoded are
+// left out and returned in problems. See address.AddressList.UnmarshalBinaryChecked
+func (w *WalletStruct) UnmarshalBinaryChecked(data []byte) (problems []error, err error) {
+	if !marshal.IsVersioned(data) {
+		return nil, w.UnmarshalBinary(data)
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	w.FactoidAddresses = address.NewAddressList()
+	w.EntryCreditAddresses = address.NewAddressList()
+	w.ExternalAddresses = address.NewAddressList()
+
+	_, fields, _, err := marshal.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range fields {
+		var list *address.AddressList
+		var listNum int
+		switch f.Tag {
+		case walletTagFactoidAddresses:
+			list, listNum = w.FactoidAddresses, 1
+		case walletTagEntryCreditAddresses:
+			list, listNum = w.EntryCreditAddresses, 2
+		case walletTagExternalAddresses:
+			list, listNum = w.ExternalAddresses, 3
+		default:
+			continue
+		}
+
+		listProblems, err := list.UnmarshalBinaryChecked(f.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", listName(listNum), err.Error())
+		}
+		for _, p := range listProblems {
+			problems = append(problems, fmt.Errorf("%s: %s", listName(listNum), p.Error()))
+		}
+	}
+
+	return problems, nil
+}
+
 func (w *WalletStruct) RemoveAddressFromAnyList(address string) (*address.AddressNamePair, error) {
 	anp, list, _ := w.GetAddress(address)
 	if list > 3 {
@@ -379,7 +489,7 @@ func (w *WalletStruct) AddBalancesToAddresses() {
 
 	if len(faList) > 0 {
 		for i, fa := range faList {
-			bal, err := factom.GetFactoidBalance(fa.Address)
+			bal, err := getFactoidBalance(fa.Address)
 			if err != nil {
 				fa.Balance = -1
 				faList[i] = fa
@@ -393,7 +503,7 @@ func (w *WalletStruct) AddBalancesToAddresses() {
 
 	if len(ecList) > 0 {
 		for i, ec := range ecList {
-			bal, err := factom.GetECBalance(ec.Address)
+			bal, err := getECBalance(ec.Address)
 			if err != nil {
 				ec.Balance = -1
 				ecList[i] = ec
@@ -408,7 +518,7 @@ func (w *WalletStruct) AddBalancesToAddresses() {
 	if len(exList) > 0 {
 		for i, a := range exList {
 			if a.Address[:2] == "FA" {
-				bal, err := factom.GetFactoidBalance(a.Address)
+				bal, err := getFactoidBalance(a.Address)
 				if err != nil {
 					a.Balance = -1
 					exList[i] = a
@@ -417,7 +527,7 @@ func (w *WalletStruct) AddBalancesToAddresses() {
 					exList[i] = a
 				}
 			} else if a.Address[:2] == "EC" {
-				bal, err := factom.GetECBalance(a.Address)
+				bal, err := getECBalance(a.Address)
 				if err != nil {
 					a.Balance = -1
 					exList[i] = a
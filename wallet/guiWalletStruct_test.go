@@ -4,7 +4,7 @@ import (
 	//crand "crypto/rand"
 	//"fmt"
 	//"math/rand"
-	//"strings"
+	"strings"
 	"testing"
 
 	//ad "github.com/FactomProject/enterprise-wallet/address"
@@ -298,3 +298,45 @@ func TestRemove(t *testing.T) {
 // FA39udanfmkZXZxPUjMWqmXvdUNKSN9D3UCTnNsJX9B4n7dadCUb
 // EC32x9uN4xMEMQbw66oob2de94z3b1JWhn23E9srgG3aCzhCCa3P
 // EC3FmWu7iX85r6UvTaqBEZgNNGAmNE1Vd2ZXRGaxHr1g8jRcS6TQ
+
+func TestAddressPolicy(t *testing.T) {
+	gw := NewWallet()
+	fa := "FA2SDU3UhBwrBR2q7jbFAbxnqUW6s5Z2cX6cakdQ6U53uSLRoPLR"
+	ec := "EC32x9uN4xMEMQbw66oob2de94z3b1JWhn23E9srgG3aCzhCCa3P"
+
+	if err := gw.SetAddressPolicy(fa, true, "", 0); err == nil {
+		t.Fatal("Address does not exist yet")
+	}
+
+	if _, err := gw.AddAddress("fa", fa, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gw.AddAddress("ec", ec, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gw.SetAddressPolicy(ec, true, "", 0); err == nil {
+		t.Fatal("Set a spending policy on an entry credit address")
+	}
+	if err := gw.SetAddressPolicy(fa, false, strings.Repeat("a", 61), 0); err == nil {
+		t.Fatal("Reserved an address with a purpose that is too long")
+	}
+
+	if err := gw.SetAddressPolicy(fa, true, "Payroll", 5e8); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := gw.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw2 := NewWallet()
+	if err = gw2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	anp, _, _ := gw2.GetAddress(fa)
+	if !anp.Frozen || anp.Reserved != "Payroll" || anp.MinBalance != 5e8 {
+		t.Fatalf("Spending policy was not saved, found %v", anp)
+	}
+}
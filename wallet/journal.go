@@ -0,0 +1,211 @@
+package wallet
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factom/wallet"
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+// Some actions write to both the wallet database and the GUI database. If the wallet
+// stops between the two writes, the databases disagree. Before such an action starts,
+// what it is about to do is written to a journal in the GUI database, and it is removed
+// once both databases are written. Anything left in the journal on launch did not finish,
+// and is rolled forward if the wallet database was written, or back if it was not.
+
+var journalBucket = []byte("journal")
+
+// Journaled operations
+const (
+	journalAddAddress    = "add-address"    // Generate or import a key
+	journalRemoveAddress = "remove-address" // Remove an address from the GUI
+	journalRename        = "rename"         // Change the name of an address
+	journalImportSeed    = "import-seed"    // Replace the seed
+)
+
+// journalEntry is an operation that has started, but not yet finished
+type journalEntry struct {
+	ID       uint64
+	Op       string
+	Address  string
+	Name     string
+	List     int
+	Seeded   bool
+	SeedHash string // Only the hash, the seed is never written to the GUI database
+}
+
+func (e *journalEntry) MarshalBinary() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+func (e *journalEntry) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	err = json.Unmarshal(data, e)
+	return nil, err
+}
+
+func (e *journalEntry) UnmarshalBinary(data []byte) error {
+	_, err := e.UnmarshalBinaryData(data)
+	return err
+}
+
+func (e *journalEntry) New() interfaces.BinaryMarshallableAndCopyable {
+	return new(journalEntry)
+}
+
+func (e *journalEntry) key() []byte {
+	var k [8]byte
+	binary.BigEndian.PutUint64(k[:], e.ID)
+	return k[:]
+}
+
+var journalCounter uint64 = uint64(time.Now().UnixNano())
+
+// beginJournal must be called before the first write of an operation
+func (w *WalletDB) beginJournal(e *journalEntry) error {
+	e.ID = atomic.AddUint64(&journalCounter, 1)
+	err := w.GUIlDB.Put(journalBucket, e.key(), e)
+	if err != nil {
+		return fmt.Errorf("The GUI database encountered an error, nothing was changed. Please try again.")
+	}
+	return nil
+}
+
+// endJournal must be called once all writes of an operation are done
+func (w *WalletDB) endJournal(e *journalEntry) {
+	w.GUIlDB.Delete(journalBucket, e.key())
+}
+
+// hashSeed is used to record a seed in the journal without saving the seed
+func hashSeed(seed string) string {
+	h := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(h[:])
+}
+
+// recoverJournal finishes, or undoes, any operation that was interrupted. The wallet
+// must be unlocked, as the wallet database has to be read.
+func (w *WalletDB) recoverJournal() error {
+	if w.IsLocked() {
+		return nil
+	}
+
+	entries, keys, err := w.GUIlDB.GetAll(journalBucket, new(journalEntry))
+	if err != nil {
+		return err
+	}
+
+	for i, data := range entries {
+		e, ok := data.(*journalEntry)
+		if !ok {
+			w.GUIlDB.Delete(journalBucket, keys[i])
+			continue
+		}
+
+		switch e.Op {
+		case journalAddAddress:
+			w.recoverAddAddress(e)
+		case journalRemoveAddress:
+			// Only the GUI database is written, finish it
+			if _, list := w.GetGUIAddress(e.Address); list != -1 {
+				w.guiWallet.RemoveAddressFromAnyList(e.Address)
+			}
+			if e.List == 1 || e.List == 2 {
+				w.InvalidateTransactionCache()
+			}
+		case journalRename:
+			// Only the GUI database is written, finish it
+			if anp, list := w.GetGUIAddress(e.Address); list != -1 && anp.Name != e.Name {
+				w.guiWallet.ChangeAddressName(e.Address, e.Name)
+			}
+		case journalImportSeed:
+			seed, err := w.Wallet.GetSeed()
+			if err == nil && hashSeed(seed) == e.SeedHash {
+				// The new seed was saved, the seeded flags belong to the old one
+				w.guiWallet.ResetSeeded()
+				w.InvalidateTransactionCache()
+			}
+		}
+
+		err = w.Save()
+		if err != nil {
+			return err
+		}
+		w.GUIlDB.Delete(journalBucket, keys[i])
+	}
+
+	return nil
+}
+
+// recoverAddAddress keeps the name the user chose if the key made it into the wallet
+// database, and drops the name if it did not
+func (w *WalletDB) recoverAddAddress(e *journalEntry) {
+	var err error
+	switch e.List {
+	case 1:
+		_, err = w.Wallet.GetFCTAddress(e.Address)
+	case 2:
+		_, err = w.Wallet.GetECAddress(e.Address)
+	default:
+		return
+	}
+	inWallet := err == nil
+
+	anp, list := w.GetGUIAddress(e.Address)
+	switch {
+	case inWallet && list == -1:
+		if e.Seeded {
+			w.guiWallet.AddSeededAddress(e.Name, e.Address, e.List)
+		} else {
+			w.guiWallet.AddAddress(e.Name, e.Address, e.List)
+		}
+	case inWallet && anp.Name != e.Name:
+		w.guiWallet.ChangeAddressName(e.Address, e.Name)
+	case !inWallet && list != -1:
+		w.guiWallet.RemoveAddressFromAnyList(e.Address)
+	}
+}
+
+// nextSeededAddress returns the address the seed will generate next, so it can be
+// journaled before it is written
+func (w *WalletDB) nextSeededAddress(list int) (string, error) {
+	seed, err := w.Wallet.GetDBSeed()
+	if err != nil {
+		return "", err
+	}
+
+	switch list {
+	case 1:
+		return seededAddress(seed, list, seed.NextFactoidAddressIndex)
+	case 2:
+		return seededAddress(seed, list, seed.NextECAddressIndex)
+	}
+	return "", fmt.Errorf("Invalid list")
+}
+
+// seededAddress returns the address the seed makes at the index
+func seededAddress(seed *wallet.DBSeed, list int, index uint32) (string, error) {
+	switch list {
+	case 1:
+		add, err := factom.MakeBIP44FactoidAddress(seed.MnemonicSeed, bip44Account, 0, index)
+		if err != nil {
+			return "", err
+		}
+		return add.String(), nil
+	case 2:
+		add, err := factom.MakeBIP44ECAddress(seed.MnemonicSeed, bip44Account, 0, index)
+		if err != nil {
+			return "", err
+		}
+		return add.String(), nil
+	}
+	return "", fmt.Errorf("Invalid list")
+}
+
+// bip44Account is the hardened account the wallet derives its seeded addresses from
+const bip44Account uint32 = 0x80000000
@@ -0,0 +1,331 @@
+package wallet
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FactomProject/enterprise-wallet/fct"
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// A wallet that holds the keys can run offline, on a machine with no network, and sign
+// what an online wallet made. The online wallet exports the unsigned transaction with the
+// entry credit rate and the balances of its inputs, which the offline wallet cannot look
+// up. The offline wallet imports it, shows what it does, signs it and exports it back, and
+// the online wallet imports the signed transaction and sends it.
+
+var (
+	// OFFLINE keeps the wallet from ever calling factomd. Everything that needs factomd
+	// returns ErrOffline instead.
+	OFFLINE = false
+
+	// OFFLINE_CHUNK_SIZE is the most characters in a chunk of an exported transaction,
+	// small enough for a QR code
+	OFFLINE_CHUNK_SIZE = 800
+)
+
+var ErrOffline = errors.New("The wallet is running offline, and cannot reach factomd")
+
+// The calls to factomd all go through these, so an offline wallet never makes them
+
+// The factom calls they make, tests replace them
+var (
+	factomdRate           = factom.GetRate
+	factomdFactoidBalance = factom.GetFactoidBalance
+	factomdECBalance      = factom.GetECBalance
+	factomdRequest        = factom.SendFactomdRequest
+)
+
+func getRate() (uint64, error) {
+	if OFFLINE {
+		return 0, ErrOffline
+	}
+	return factomdRate()
+}
+
+func getFactoidBalance(address string) (int64, error) {
+	if OFFLINE {
+		return 0, ErrOffline
+	}
+	return factomdFactoidBalance(address)
+}
+
+func getECBalance(address string) (int64, error) {
+	if OFFLINE {
+		return 0, ErrOffline
+	}
+	return factomdECBalance(address)
+}
+
+func sendFactomdRequest(req *factom.JSON2Request) (*factom.JSON2Response, error) {
+	if OFFLINE {
+		return nil, ErrOffline
+	}
+	return factomdRequest(req)
+}
+
+// OfflineTransaction is a transaction passed between an online and an offline wallet.
+// Rate and Balances are what the online wallet saw when it exported it, they are empty
+// when the offline wallet exports the signed transaction.
+type OfflineTransaction struct {
+	Transaction string               // As exported by ExportTransaction
+	Rate        uint64               `json:",omitempty"`
+	Balances    []AddressBalancePair `json:",omitempty"`
+	Created     int64
+}
+
+// OfflineReview is what an imported transaction does, to be checked before it is signed
+// or sent. Problems lists anything that looks wrong.
+type OfflineReview struct {
+	DraftID   string
+	Inputs    []InputSignature
+	Outputs   []EstimateOutput
+	Rate      uint64
+	Fee       uint64 // Paid, the inputs less the outputs
+	NeededFee uint64 // At the rate
+	Signed    bool
+	Problems  []string
+}
+
+// ExportOfflineTransaction exports a draft to be signed by an offline wallet. An offline
+// wallet exports only the transaction, for the online wallet to send.
+func (wal *WalletDB) ExportOfflineTransaction(trans string) (*OfflineTransaction, error) {
+	if !wal.IsDraft(trans) {
+		return nil, ErrDraftNotFound
+	}
+	t := wal.Wallet.GetTransactions()[trans]
+	if t == nil {
+		return nil, fmt.Errorf("Transaction not found")
+	}
+
+	o := new(OfflineTransaction)
+	o.Created = time.Now().Unix()
+	var err error
+	o.Transaction, err = wal.ExportTransaction(trans)
+	if err != nil {
+		return nil, err
+	}
+	if OFFLINE {
+		return o, nil
+	}
+
+	o.Rate, err = getRate()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, in := range t.GetInputs() {
+		addr := primitives.ConvertFctAddressToUserStr(in.GetAddress())
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		bal, err := getFactoidBalance(addr)
+		if err != nil {
+			return nil, err
+		}
+		o.Balances = append(o.Balances, AddressBalancePair{addr, uint64(bal)})
+	}
+	return o, nil
+}
+
+// ImportOfflineTransaction puts an exported transaction in a new draft, and reviews it.
+// Online, the rate and balances are looked up rather than taken from the export.
+func (wal *WalletDB) ImportOfflineTransaction(o *OfflineTransaction) (*OfflineReview, error) {
+	d, err := wal.ImportDraft("Offline", o.Transaction)
+	if err != nil {
+		return nil, err
+	}
+	t := wal.Wallet.GetTransactions()[d.ID]
+	if t == nil {
+		return nil, fmt.Errorf("Transaction had an error importing.")
+	}
+
+	r := &OfflineReview{DraftID: d.ID, Rate: o.Rate}
+	r.Inputs, err = wal.GetInputSignatures(d.ID)
+	if err != nil {
+		return nil, err
+	}
+	r.Signed = wal.ValidateSignatures(d.ID) == nil
+
+	balances := make(map[string]uint64)
+	if OFFLINE {
+		for _, b := range o.Balances {
+			balances[b.Address] = b.Balance
+		}
+	} else {
+		r.Rate, err = getRate()
+		if err != nil {
+			return nil, err
+		}
+		for _, in := range r.Inputs {
+			bal, err := getFactoidBalance(in.Address)
+			if err != nil {
+				return nil, err
+			}
+			balances[in.Address] = uint64(bal)
+		}
+	}
+
+	var totalIn, totalOut uint64
+	spent := make(map[string]uint64)
+	for _, in := range r.Inputs {
+		totalIn += in.Amount
+		spent[in.Address] += in.Amount
+	}
+	for addr, amount := range spent {
+		bal, ok := balances[addr]
+		if !ok {
+			r.Problems = append(r.Problems, fmt.Sprintf("The balance of %s is not known", addr))
+		} else if amount > bal {
+			r.Problems = append(r.Problems, fmt.Sprintf("%s spends %s FCT, but only has %s FCT", addr, fct.Amount(amount), fct.Amount(bal)))
+		}
+	}
+
+	for _, out := range t.GetOutputs() {
+		r.Outputs = append(r.Outputs, EstimateOutput{
+			Address: primitives.ConvertFctAddressToUserStr(out.GetAddress()),
+			Amount:  out.GetAmount(),
+		})
+		totalOut += out.GetAmount()
+	}
+	for _, out := range t.GetECOutputs() {
+		e := EstimateOutput{Address: primitives.ConvertECAddressToUserStr(out.GetAddress()), Amount: out.GetAmount()}
+		if r.Rate > 0 {
+			e.EntryCredits = out.GetAmount() / r.Rate
+		}
+		r.Outputs = append(r.Outputs, e)
+		totalOut += out.GetAmount()
+	}
+
+	if totalOut > totalIn {
+		r.Problems = append(r.Problems, "The outputs are more than the inputs")
+	} else {
+		r.Fee = totalIn - totalOut
+	}
+	if r.Rate == 0 {
+		r.Problems = append(r.Problems, "The entry credit rate is not known, so the fee cannot be checked")
+	} else {
+		r.NeededFee, err = t.CalculateFee(r.Rate)
+		if err != nil {
+			return nil, err
+		}
+		if r.Fee < r.NeededFee {
+			r.Problems = append(r.Problems, fmt.Sprintf("The fee is %s FCT, but %s FCT is needed", fct.Amount(r.Fee), fct.Amount(r.NeededFee)))
+		} else if r.Fee > 10*r.NeededFee {
+			r.Problems = append(r.Problems, fmt.Sprintf("The fee is %s FCT, more than 10 times the %s FCT needed", fct.Amount(r.Fee), fct.Amount(r.NeededFee)))
+		}
+	}
+	return r, nil
+}
+
+// EncodeOfflineTransaction returns an exported transaction as text, to be saved to a file
+func EncodeOfflineTransaction(o *OfflineTransaction) (string, error) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// DecodeOfflineTransaction reads an exported transaction, either the text saved to a file
+// or all the chunks of it, in any order
+func DecodeOfflineTransaction(data string, chunks []string) (*OfflineTransaction, error) {
+	if len(chunks) > 0 {
+		var err error
+		data, err = JoinOfflineChunks(chunks)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	o := new(OfflineTransaction)
+	err := json.Unmarshal([]byte(data), o)
+	if err != nil {
+		return nil, err
+	}
+	if o.Transaction == "" {
+		return nil, fmt.Errorf("There is no transaction in the data given")
+	}
+	return o, nil
+}
+
+// SplitOfflineChunks splits an encoded transaction into chunks small enough for QR codes.
+// Each chunk is "ewtx:<id>:<n>/<total>:<data>", where the id is the same for all of them.
+func SplitOfflineChunks(encoded string) []string {
+	data := base64.URLEncoding.EncodeToString([]byte(encoded))
+	sum := sha256.Sum256([]byte(data))
+	id := hex.EncodeToString(sum[:4])
+
+	size := OFFLINE_CHUNK_SIZE - len("ewtx:"+id+":000/000:")
+	if size < 1 {
+		size = 1
+	}
+	total := (len(data) + size - 1) / size
+	var chunks []string
+	for i := 0; i < total; i++ {
+		end := (i + 1) * size
+		if end > len(data) {
+			end = len(data)
+		}
+		chunks = append(chunks, fmt.Sprintf("ewtx:%s:%d/%d:%s", id, i+1, total, data[i*size:end]))
+	}
+	return chunks
+}
+
+// JoinOfflineChunks puts the chunks of SplitOfflineChunks back together
+func JoinOfflineChunks(chunks []string) (string, error) {
+	var id string
+	var parts []string
+	for _, c := range chunks {
+		f := strings.SplitN(strings.TrimSpace(c), ":", 4)
+		if len(f) != 4 || f[0] != "ewtx" {
+			return "", fmt.Errorf("Not a chunk of an exported transaction")
+		}
+		nums := strings.SplitN(f[2], "/", 2)
+		if len(nums) != 2 {
+			return "", fmt.Errorf("Not a chunk of an exported transaction")
+		}
+		n, err := strconv.Atoi(nums[0])
+		if err != nil {
+			return "", fmt.Errorf("Not a chunk of an exported transaction")
+		}
+		total, err := strconv.Atoi(nums[1])
+		if err != nil || n < 1 || n > total {
+			return "", fmt.Errorf("Not a chunk of an exported transaction")
+		}
+
+		if parts == nil {
+			id = f[1]
+			parts = make([]string, total)
+		} else if f[1] != id || total != len(parts) {
+			return "", fmt.Errorf("The chunks are from different transactions")
+		}
+		parts[n-1] = f[3]
+	}
+
+	for i, p := range parts {
+		if p == "" {
+			return "", fmt.Errorf("Chunk %d of %d is missing", i+1, len(parts))
+		}
+	}
+	data := strings.Join(parts, "")
+	sum := sha256.Sum256([]byte(data))
+	if hex.EncodeToString(sum[:4]) != id {
+		return "", fmt.Errorf("The chunks do not match their checksum")
+	}
+
+	decoded, err := base64.URLEncoding.DecodeString(data)
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
@@ -0,0 +1,61 @@
+package wallet_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+func TestOfflineChunks(t *testing.T) {
+	size := OFFLINE_CHUNK_SIZE
+	OFFLINE_CHUNK_SIZE = 40
+	defer func() { OFFLINE_CHUNK_SIZE = size }()
+
+	o := &OfflineTransaction{
+		Transaction: `{"jsonrpc":"2.0","id":0,"params":{"transaction":"` + strings.Repeat("0a1b", 60) + `"},"method":"factoid-submit"}`,
+		Rate:        1000,
+		Balances:    []AddressBalancePair{{"FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1Q", 5e8}},
+		Created:     1500000000,
+	}
+	data, err := EncodeOfflineTransaction(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := SplitOfflineChunks(data)
+	if len(chunks) < 2 {
+		t.Fatalf("Expected the transaction split in chunks, found %d", len(chunks))
+	}
+	for _, c := range chunks {
+		if len(c) > OFFLINE_CHUNK_SIZE {
+			t.Errorf("Chunk is %d long, more than %d", len(c), OFFLINE_CHUNK_SIZE)
+		}
+	}
+
+	// Any order
+	reversed := make([]string, len(chunks))
+	for i, c := range chunks {
+		reversed[len(chunks)-1-i] = c
+	}
+	back, err := DecodeOfflineTransaction("", reversed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Transaction != o.Transaction || back.Rate != o.Rate || len(back.Balances) != 1 || back.Balances[0] != o.Balances[0] {
+		t.Errorf("Transaction read back wrong: %v", back)
+	}
+
+	if _, err := DecodeOfflineTransaction(data, nil); err != nil {
+		t.Errorf("Could not read the text back: %s", err.Error())
+	}
+
+	if _, err := JoinOfflineChunks(chunks[1:]); err == nil {
+		t.Error("Missing chunk was not found")
+	}
+
+	other := SplitOfflineChunks(strings.Replace(data, "1000", "2000", 1))
+	if _, err := JoinOfflineChunks(append([]string{other[0]}, chunks[1:]...)); err == nil {
+		t.Error("Chunks of different transactions were joined")
+	}
+}
@@ -1,15 +1,13 @@
 package wallet
 
+import (
+	"path/filepath"
+)
+
 var (
 	WalletBoltV1Path = "/.factom/factoid_wallet_bolt.db"
 
-	/* M2 Fodler Paths, uses '/wallet/'' */
-	walletLDBPath  = "/.factom/wallet/factoid_wallet_ldb.db"
-	walletBoltPath = "/.factom/wallet/factom_wallet.db"
-
-	guiLDBPath  = "/.factom/wallet/factoid_gui_ldb.db"
-	guiBoltPath = "/.factom/wallet/factom_wallet_gui.db"
-
-	txdbLDBPath  = "/.factom/wallet/factoid_blocks_ldb_cache.db/"
-	txdbBoltPath = "/.factom/wallet/factoid_blocks.cache"
+	// DATA_DIR is the directory the wallet, GUI and transaction databases are kept in.
+	// The file names come from the backend, see database.Backend
+	DATA_DIR = filepath.Join(GetHomeDir(), ".factom", "wallet")
 )
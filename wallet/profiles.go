@@ -0,0 +1,224 @@
+package wallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultProfile is the wallet kept directly in DATA_DIR. It always exists, and is the
+// wallet used before there were profiles.
+const DefaultProfile = "default"
+
+// MaxProfileNameLength is the longest a profile name is allowed to be
+const MaxProfileNameLength int = 32
+
+// Profile is a named wallet. Every profile has its own wallet and GUI databases. The
+// transaction database only holds public data from factomd, so it can be shared with
+// the default profile instead of being synced again.
+type Profile struct {
+	Name      string
+	SharedTX  bool // Use the transaction database of the default profile
+	WatchOnly bool // Holds public keys only, see ImportPublicKey
+	Created   int64
+}
+
+// Dir returns the directory the wallet and GUI databases of the profile are kept in
+func (p *Profile) Dir() string {
+	if p.Name == DefaultProfile {
+		return DATA_DIR
+	}
+	return filepath.Join(DATA_DIR, "wallets", p.Name)
+}
+
+// TXDir returns the directory the transaction database of the profile is kept in
+func (p *Profile) TXDir() string {
+	if p.SharedTX {
+		return DATA_DIR
+	}
+	return p.Dir()
+}
+
+// profileRegistry is saved as JSON in DATA_DIR, and holds every profile but the default
+type profileRegistry struct {
+	Active   string
+	Profiles []Profile
+}
+
+var profileLock sync.Mutex
+
+func registryPath() string {
+	return filepath.Join(DATA_DIR, "wallets.json")
+}
+
+func readRegistry() (*profileRegistry, error) {
+	reg := new(profileRegistry)
+	data, err := ioutil.ReadFile(registryPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return reg, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, reg)
+	if err != nil {
+		return nil, fmt.Errorf("The list of wallets at %s could not be read: %s", registryPath(), err.Error())
+	}
+	return reg, nil
+}
+
+func (reg *profileRegistry) write() error {
+	data, err := json.MarshalIndent(reg, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(DATA_DIR, 0700)
+	if err != nil {
+		return err
+	}
+
+	path := registryPath()
+	err = ioutil.WriteFile(path+".tmp", data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (reg *profileRegistry) get(name string) *Profile {
+	if name == DefaultProfile {
+		return &Profile{Name: DefaultProfile}
+	}
+	for _, p := range reg.Profiles {
+		if p.Name == name {
+			c := p
+			return &c
+		}
+	}
+	return nil
+}
+
+// ValidProfileName returns an error if the name cannot be used for a profile. The name
+// is used as a directory name, so only 'a-z, A-Z, 0-9, _ , -' are allowed.
+func ValidProfileName(name string) error {
+	if len(name) == 0 || len(name) > MaxProfileNameLength {
+		return fmt.Errorf("A wallet name must be 1 to %d characters", MaxProfileNameLength)
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+		default:
+			return fmt.Errorf("A wallet name can only contain the following characters 'a-z, A-Z, 0-9, _ , -'")
+		}
+	}
+	return nil
+}
+
+// ListProfiles returns every profile, the default first
+func ListProfiles() ([]Profile, error) {
+	profileLock.Lock()
+	defer profileLock.Unlock()
+
+	reg, err := readRegistry()
+	if err != nil {
+		return nil, err
+	}
+	return append([]Profile{{Name: DefaultProfile}}, reg.Profiles...), nil
+}
+
+// GetProfile finds a profile by name
+func GetProfile(name string) (*Profile, error) {
+	profileLock.Lock()
+	defer profileLock.Unlock()
+
+	reg, err := readRegistry()
+	if err != nil {
+		return nil, err
+	}
+	p := reg.get(name)
+	if p == nil {
+		return nil, fmt.Errorf("There is no wallet named '%s'", name)
+	}
+	return p, nil
+}
+
+// CreateProfile adds a new profile. Its databases are made the first time it is opened.
+func CreateProfile(name string, sharedTX bool) (*Profile, error) {
+	return createProfile(Profile{Name: name, SharedTX: sharedTX})
+}
+
+// CreateWatchOnlyProfile adds a new profile that only holds public keys
+func CreateWatchOnlyProfile(name string, sharedTX bool) (*Profile, error) {
+	return createProfile(Profile{Name: name, SharedTX: sharedTX, WatchOnly: true})
+}
+
+func createProfile(p Profile) (*Profile, error) {
+	name := p.Name
+	if err := ValidProfileName(name); err != nil {
+		return nil, err
+	}
+
+	profileLock.Lock()
+	defer profileLock.Unlock()
+
+	reg, err := readRegistry()
+	if err != nil {
+		return nil, err
+	}
+	if reg.get(name) != nil {
+		return nil, fmt.Errorf("A wallet named '%s' already exists", name)
+	}
+
+	p.Created = time.Now().Unix()
+	err = os.MkdirAll(p.Dir(), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	reg.Profiles = append(reg.Profiles, p)
+	err = reg.write()
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ActiveProfile returns the profile last switched to, which is opened on launch
+func ActiveProfile() (*Profile, error) {
+	profileLock.Lock()
+	defer profileLock.Unlock()
+
+	reg, err := readRegistry()
+	if err != nil {
+		return nil, err
+	}
+	if p := reg.get(reg.Active); p != nil {
+		return p, nil
+	}
+	return reg.get(DefaultProfile), nil
+}
+
+// SetActiveProfile remembers the profile to open on the next launch
+func SetActiveProfile(name string) error {
+	profileLock.Lock()
+	defer profileLock.Unlock()
+
+	reg, err := readRegistry()
+	if err != nil {
+		return err
+	}
+	if reg.get(name) == nil {
+		return fmt.Errorf("There is no wallet named '%s'", name)
+	}
+	if reg.Active == name {
+		return nil
+	}
+	reg.Active = name
+	return reg.write()
+}
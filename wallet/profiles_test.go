@@ -0,0 +1,98 @@
+package wallet_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+func TestProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallet-profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldDir := DATA_DIR
+	DATA_DIR = dir
+	defer func() { DATA_DIR = oldDir }()
+
+	p, err := ActiveProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != DefaultProfile || p.Dir() != dir {
+		t.Fatal("The default profile should be active, and kept in DATA_DIR")
+	}
+
+	for _, bad := range []string{"", "../up", "has space", "a/b", "123456789012345678901234567890123"} {
+		if _, err = CreateProfile(bad, false); err == nil {
+			t.Fatalf("Created a profile named '%s'", bad)
+		}
+	}
+
+	shared, err := CreateProfile("shared", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	own, err := CreateProfile("own", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = CreateProfile("own", true); err == nil {
+		t.Fatal("Created the same profile twice")
+	}
+
+	if shared.TXDir() != dir || shared.Dir() != filepath.Join(dir, "wallets", "shared") {
+		t.Fatal("Profile sharing transactions has the wrong directories")
+	}
+	if own.TXDir() != own.Dir() {
+		t.Fatal("Profile with its own transactions has the wrong directories")
+	}
+
+	list, err := ListProfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[0].Name != DefaultProfile {
+		t.Fatalf("Expected the default and 2 more profiles, found %v", list)
+	}
+
+	if err = SetActiveProfile("missing"); err == nil {
+		t.Fatal("Set a profile that does not exist as active")
+	}
+	err = SetActiveProfile("own")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = ActiveProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "own" {
+		t.Fatalf("Expected 'own' to be active, found '%s'", p.Name)
+	}
+
+	// Profiles do not share addresses
+	GUI_DB, WALLET_DB, TX_DB = MAP, MAP, MAP
+	a, err := NewProfileWalletDB(own, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := NewProfileWalletDB(shared, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	anp, err := a.GenerateFactoidAddress("OnlyInOwn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, list := b.GetGUIAddress(anp.Address); list != -1 {
+		t.Fatal("An address of one profile was found in another")
+	}
+}
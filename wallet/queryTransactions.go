@@ -0,0 +1,179 @@
+package wallet
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The related transactions can be searched without rebuilding the cache. A query filters
+// the transactions last loaded by related-transactions, sorts them and returns a page.
+
+// TransactionQuery filters, sorts and pages the related transactions. The filters left
+// empty are not used.
+type TransactionQuery struct {
+	Address string // An input or output
+	Name    string // Part of the name of an input or output, in any case
+	TxID    string // Start of the transaction id
+
+	// The transaction did any of these for the wallet, any action if none are set
+	Sent      bool
+	Received  bool
+	Converted bool
+
+	MinAmount  uint64 // Factoshis output, see TransactionAmount
+	MaxAmount  uint64
+	FromTime   int64 // Unix time
+	ToTime     int64
+	FromHeight uint32
+	ToHeight   uint32
+
+	SortBy    string // "time" or "amount", time if empty
+	Ascending bool   // Oldest or smallest first, newest or largest first if false
+
+	Current int // Index of the first transaction to return
+	More    int // How many transactions to return, all of them if 0
+}
+
+// TransactionQueryResult is a page of the transactions matching a query
+type TransactionQueryResult struct {
+	Total        int // Transactions matching the filters
+	Cached       int // Transactions searched
+	Transactions []DisplayTransaction
+}
+
+// TransactionAmount is the factoshis a transaction outputs, to factoid and entry credit
+// addresses. The fee is not included.
+func TransactionAmount(t DisplayTransaction) uint64 {
+	return t.TotalFCTOutput + t.TotalECOutput
+}
+
+// QueryTransactions searches the related transactions already loaded
+func (w *WalletDB) QueryTransactions(q *TransactionQuery) (*TransactionQueryResult, error) {
+	if q.SortBy != "" && q.SortBy != "time" && q.SortBy != "amount" {
+		return nil, fmt.Errorf("Transactions can be sorted by time or amount")
+	}
+
+	// The names shown may be out of date, so match the current names of the addresses
+	var named map[string]bool
+	if q.Name != "" {
+		named = make(map[string]bool)
+		name := strings.ToLower(q.Name)
+		for _, anp := range w.GetAllGUIAddresses() {
+			if strings.Contains(strings.ToLower(anp.Name), name) {
+				named[anp.Address] = true
+			}
+		}
+	}
+
+	cached := w.ActiveCachedTransactions
+	r := &TransactionQueryResult{Cached: len(cached)}
+	r.Transactions, r.Total = q.Apply(cached, named)
+	r.Transactions = w.ScrubDisplayTransactionsForNameChanges(r.Transactions)
+	return r, nil
+}
+
+// Apply returns the page of the transactions that match the query, and how many match in
+// all. The transactions given are not changed. If named is not nil, a transaction matches
+// the name if it has one of its addresses, otherwise the names in the transaction are used.
+func (q *TransactionQuery) Apply(trans []DisplayTransaction, named map[string]bool) ([]DisplayTransaction, int) {
+	var matched []DisplayTransaction
+	for _, t := range trans {
+		if t.TxID == "empty" { // Stands in for no transactions, see GetRelatedTransactions
+			continue
+		}
+		if q.matches(t, named) {
+			matched = append(matched, t)
+		}
+	}
+
+	sort.Stable(transactionSort{matched, q.SortBy == "amount", q.Ascending})
+
+	total := len(matched)
+	if q.Current < 0 || q.Current >= total {
+		return []DisplayTransaction{}, total
+	}
+	end := total
+	if q.More > 0 && q.Current+q.More < total {
+		end = q.Current + q.More
+	}
+	return matched[q.Current:end], total
+}
+
+func (q *TransactionQuery) matches(t DisplayTransaction, named map[string]bool) bool {
+	if q.TxID != "" && !strings.HasPrefix(t.TxID, strings.ToLower(q.TxID)) {
+		return false
+	}
+	if (q.Sent || q.Received || q.Converted) &&
+		!(q.Sent && t.Action[0] || q.Received && t.Action[1] || q.Converted && t.Action[2]) {
+		return false
+	}
+
+	amount := TransactionAmount(t)
+	if q.MinAmount != 0 && amount < q.MinAmount {
+		return false
+	}
+	if q.MaxAmount != 0 && amount > q.MaxAmount {
+		return false
+	}
+	if q.FromTime != 0 && t.ExactTime.Unix() < q.FromTime {
+		return false
+	}
+	if q.ToTime != 0 && t.ExactTime.Unix() > q.ToTime {
+		return false
+	}
+	if q.FromHeight != 0 && t.Height < q.FromHeight {
+		return false
+	}
+	if q.ToHeight != 0 && t.Height > q.ToHeight {
+		return false
+	}
+
+	if q.Address == "" && q.Name == "" {
+		return true
+	}
+	addressFound, nameFound := q.Address == "", q.Name == ""
+	name := strings.ToLower(q.Name)
+	for _, list := range [][]TransactionAddressInfo{t.Inputs, t.Outputs} {
+		for _, info := range list {
+			if info.Address == q.Address {
+				addressFound = true
+			}
+			if named != nil {
+				if named[info.Address] {
+					nameFound = true
+				}
+			} else if q.Name != "" && strings.Contains(strings.ToLower(info.Name), name) {
+				nameFound = true
+			}
+		}
+	}
+	return addressFound && nameFound
+}
+
+// transactionSort sorts transactions by time or amount, newest or largest first unless
+// ascending
+type transactionSort struct {
+	list      []DisplayTransaction
+	byAmount  bool
+	ascending bool
+}
+
+func (s transactionSort) Len() int {
+	return len(s.list)
+}
+
+func (s transactionSort) Less(i, j int) bool {
+	a, b := s.list[i], s.list[j]
+	if s.ascending {
+		a, b = b, a
+	}
+	if s.byAmount {
+		return TransactionAmount(a) > TransactionAmount(b)
+	}
+	return a.ExactTime.After(b.ExactTime)
+}
+
+func (s transactionSort) Swap(i, j int) {
+	s.list[i], s.list[j] = s.list[j], s.list[i]
+}
@@ -0,0 +1,69 @@
+package wallet_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+func TestTransactionQuery(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	tx := func(id string, height uint32, amount uint64, action [3]bool, name string, addr string) DisplayTransaction {
+		return DisplayTransaction{
+			TxID:           id,
+			Height:         height,
+			ExactTime:      start.Add(time.Duration(height) * time.Minute),
+			Action:         action,
+			TotalFCTOutput: amount,
+			Outputs:        []TransactionAddressInfo{{Name: name, Address: addr, Amount: amount, Type: "FCT"}},
+		}
+	}
+	sent, received, converted := [3]bool{true, false, false}, [3]bool{false, true, false}, [3]bool{false, false, true}
+
+	// Newest first, as cached
+	trans := []DisplayTransaction{
+		tx("dd01", 40, 4e8, converted, "", "EC2DKSYyRcNWf7RS963VFYgMExoHRYLHVeCfQ9PGPmNzwrcmgm2r"),
+		tx("cc01", 30, 1e8, sent, "Alice", "FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1Q"),
+		tx("bb01", 20, 3e8, received, "Bob", "FA3EPZYqodgyEGXNMbiZKE5TS2x2J9wF8J9MvPZb52iGR78xMgCb"),
+		tx("aa01", 10, 2e8, received, "alice", "FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1Q"),
+		{TxID: "empty"},
+	}
+
+	ids := func(list []DisplayTransaction) string {
+		s := ""
+		for _, t := range list {
+			s += t.TxID[:2]
+		}
+		return s
+	}
+	check := func(q *TransactionQuery, expected string, expectedTotal int) {
+		page, total := q.Apply(trans, nil)
+		if ids(page) != expected || total != expectedTotal {
+			t.Errorf("%+v: expected %s of %d, found %s of %d", q, expected, expectedTotal, ids(page), total)
+		}
+	}
+
+	check(&TransactionQuery{}, "ddccbbaa", 4)
+	check(&TransactionQuery{Received: true}, "bbaa", 2)
+	check(&TransactionQuery{Sent: true, Converted: true}, "ddcc", 2)
+	check(&TransactionQuery{Name: "ALI"}, "ccaa", 2)
+	check(&TransactionQuery{Address: "FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1Q", Received: true}, "aa", 1)
+	check(&TransactionQuery{MinAmount: 2e8, MaxAmount: 3e8}, "bbaa", 2)
+	check(&TransactionQuery{FromHeight: 20, ToTime: start.Add(30 * time.Minute).Unix()}, "ccbb", 2)
+	check(&TransactionQuery{TxID: "BB"}, "bb", 1)
+	check(&TransactionQuery{SortBy: "amount"}, "ddbbaacc", 4)
+	check(&TransactionQuery{SortBy: "amount", Ascending: true, Current: 1, More: 2}, "aabb", 4)
+	check(&TransactionQuery{Ascending: true, Current: 3}, "dd", 4)
+	check(&TransactionQuery{Current: 4}, "", 4)
+
+	// The current names of the addresses are used if given
+	named := map[string]bool{"FA3EPZYqodgyEGXNMbiZKE5TS2x2J9wF8J9MvPZb52iGR78xMgCb": true}
+	if page, _ := (&TransactionQuery{Name: "Alice"}).Apply(trans, named); ids(page) != "bb" {
+		t.Errorf("Expected the current names used, found %s", ids(page))
+	}
+
+	if trans[0].TxID != "dd01" || trans[3].TxID != "aa01" {
+		t.Error("The cached transactions were reordered")
+	}
+}
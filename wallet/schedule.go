@@ -0,0 +1,536 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+// A scheduled payment sends the same outputs again and again, every interval or when a
+// cron expression is due (see cron.go). They are saved in the GUI database, with a history
+// of every payment made. The scheduler only runs once started, so a wallet opened to back
+// up or check it never pays anything. A payment that fails is tried again a few times, then
+// skipped. Payments missed while the wallet was not running are not made up; the scheduler
+// makes the one most recently due, then waits for the next.
+//
+// A payment is signed and saved before it is sent. Trying it again sends the same signed
+// transaction, with the same txid, so a payment factomd took despite an error, or that was
+// sent just before the wallet stopped, is never made twice.
+
+var schedulesBucket = []byte("scheduled-payments")
+
+var (
+	// SCHEDULE_CHECK_INTERVAL is how often the scheduler looks for payments that are due
+	SCHEDULE_CHECK_INTERVAL time.Duration = 30 * time.Second
+	// SCHEDULE_RETRY_INTERVAL is how long a failed payment waits to be tried again
+	SCHEDULE_RETRY_INTERVAL time.Duration = 5 * time.Minute
+	// SCHEDULE_MAX_RETRIES is how many times a failed payment is tried again before it is skipped
+	SCHEDULE_MAX_RETRIES int = 5
+)
+
+// MinScheduleInterval is the shortest time allowed between payments
+const MinScheduleInterval time.Duration = time.Minute
+
+// MaxScheduleHistory is how many payments are kept in the history of a scheduled payment
+const MaxScheduleHistory int = 100
+
+// ErrScheduleNotFound is returned when no scheduled payment has the ID given
+var ErrScheduleNotFound = errors.New("No scheduled payment found with that ID")
+
+// ScheduledPayment is a payment made on a schedule
+type ScheduledPayment struct {
+	ID            string
+	Label         string
+	ToAddresses   []string
+	ToAmounts     []uint64 // Factoshis to a factoid address, entry credits to an entry credit address
+	FromAddresses []string // The addresses that can pay, any if empty
+	CoinSelection string
+
+	Interval int64  // Seconds between payments, if there is no cron expression
+	Cron     string // Cron expression, in the local time of the wallet
+	Start    int64  // Unix time of the first payment
+	End      int64  // Unix time after which no payments are made, 0 if it never ends
+	Created  int64  // Unix time
+
+	Paused    bool
+	Cancelled bool
+	Finished  bool // Past the end
+
+	Next     int64 // Unix time the next payment is due, 0 if there is none
+	RetryAt  int64 // Unix time a failed payment is tried again, 0 if it has not failed
+	Attempts int   // Failed attempts at the payment that is due
+
+	// The signed transaction of the payment that is due, until it is sent or given up on
+	Signed *ScheduledTransaction `json:",omitempty"`
+
+	History []ScheduledRun // Oldest first
+}
+
+// ScheduledTransaction is the signed transaction of a payment that is due
+type ScheduledTransaction struct {
+	Due     int64 // Unix time the payment is due
+	DraftID string
+	TxID    string
+	Raw     string // Hex of the signed transaction
+	Fee     uint64
+}
+
+// ScheduledRun is one attempt at a scheduled payment
+type ScheduledRun struct {
+	Due     int64 // Unix time the payment was due
+	Time    int64 // Unix time it was attempted
+	Attempt int
+	TxID    string // Set if it was sent
+	Fee     uint64
+	Error   string // Why it failed
+}
+
+func (p *ScheduledPayment) MarshalBinary() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (p *ScheduledPayment) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	err = json.Unmarshal(data, p)
+	return nil, err
+}
+
+func (p *ScheduledPayment) UnmarshalBinary(data []byte) error {
+	_, err := p.UnmarshalBinaryData(data)
+	return err
+}
+
+func (p *ScheduledPayment) New() interfaces.BinaryMarshallableAndCopyable {
+	return new(ScheduledPayment)
+}
+
+// ScheduledPayments is used for sorting, oldest first
+type ScheduledPayments []ScheduledPayment
+
+func (slice ScheduledPayments) Len() int {
+	return len(slice)
+}
+
+func (slice ScheduledPayments) Less(i, j int) bool {
+	return slice[i].Created < slice[j].Created
+}
+
+func (slice ScheduledPayments) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// NextDue returns the first time after t a payment is due, or the zero time if there is none
+func (p *ScheduledPayment) NextDue(t time.Time) time.Time {
+	var next time.Time
+	if p.Cron != "" {
+		c, err := parseCron(p.Cron)
+		if err != nil {
+			return time.Time{}
+		}
+		next = c.next(t)
+		for !next.IsZero() && next.Unix() < p.Start {
+			next = c.next(next)
+		}
+	} else {
+		if p.Interval <= 0 {
+			return time.Time{}
+		}
+		n := p.Start
+		if t.Unix() >= n {
+			n += ((t.Unix()-p.Start)/p.Interval + 1) * p.Interval
+		}
+		next = time.Unix(n, 0)
+	}
+
+	if next.IsZero() || (p.End != 0 && next.Unix() > p.End) {
+		return time.Time{}
+	}
+	return next
+}
+
+// active is true if the payment is still made
+func (p *ScheduledPayment) active() bool {
+	return !p.Paused && !p.Cancelled && !p.Finished
+}
+
+// due is true if the payment should be made now
+func (p *ScheduledPayment) due(now time.Time) bool {
+	if !p.active() || p.Next == 0 || now.Unix() < p.Next {
+		return false
+	}
+	return p.RetryAt == 0 || now.Unix() >= p.RetryAt
+}
+
+// schedule sets when the next payment is due, after t
+func (p *ScheduledPayment) schedule(t time.Time) {
+	p.RetryAt, p.Attempts = 0, 0
+	p.Next = 0
+	if next := p.NextDue(t); !next.IsZero() {
+		p.Next = next.Unix()
+	} else {
+		p.Finished = true
+	}
+}
+
+func (w *WalletDB) checkScheduledPayment(p *ScheduledPayment) error {
+	if len(p.ToAddresses) == 0 {
+		return fmt.Errorf("No recipient given")
+	}
+	if len(p.ToAddresses) != len(p.ToAmounts) {
+		return fmt.Errorf("Lengths of address to amount does not match")
+	}
+	if len(p.Label) > MaxDraftLabelLength {
+		return fmt.Errorf("Label too long, must be less than %d characters", MaxDraftLabelLength)
+	}
+	for i, addr := range p.ToAddresses {
+		if !w.IsValidAddress(addr) || (addr[:2] != "FA" && addr[:2] != "EC") {
+			return fmt.Errorf("%s is not a valid public address", addr)
+		}
+		if p.ToAmounts[i] == 0 {
+			return fmt.Errorf("The amount to %s must be more than 0", addr)
+		}
+	}
+	for _, addr := range p.FromAddresses {
+		if anp, list := w.GetGUIAddress(addr); list != 1 || anp == nil {
+			return fmt.Errorf("%s is not one of your factoid addresses", addr)
+		}
+	}
+	if _, err := GetCoinSelector(p.CoinSelection); err != nil {
+		return err
+	}
+
+	if p.Cron != "" {
+		if p.Interval != 0 {
+			return fmt.Errorf("Give an interval or a cron expression, not both")
+		}
+		if _, err := parseCron(p.Cron); err != nil {
+			return err
+		}
+	} else if time.Duration(p.Interval)*time.Second < MinScheduleInterval {
+		return fmt.Errorf("The interval must be at least %s", MinScheduleInterval.String())
+	}
+	if p.End != 0 && p.End < p.Start {
+		return fmt.Errorf("The end is before the start")
+	}
+	return nil
+}
+
+// CreateScheduledPayment saves a new scheduled payment. If it has no start, it starts now.
+func (w *WalletDB) CreateScheduledPayment(p ScheduledPayment) (*ScheduledPayment, error) {
+	// Scheduled payments are signed and sent without anyone there
+	if err := w.checkSecrets(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if p.Start == 0 {
+		p.Start = now.Unix()
+	}
+	if err := w.checkScheduledPayment(&p); err != nil {
+		return nil, err
+	}
+
+	id, err := newDraftID()
+	if err != nil {
+		return nil, err
+	}
+	p.ID = id
+	p.Created = now.Unix()
+	p.Paused, p.Cancelled, p.Finished = false, false, false
+	p.History = nil
+
+	from := time.Unix(p.Start, 0)
+	if now.After(from) {
+		from = now
+	}
+	p.schedule(from.Add(-time.Second))
+	if p.Finished {
+		return nil, fmt.Errorf("No payment would ever be due")
+	}
+
+	w.scheduleLock.Lock()
+	defer w.scheduleLock.Unlock()
+	err = w.GUIlDB.Put(schedulesBucket, []byte(p.ID), &p)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetScheduledPayment returns a scheduled payment, with its history
+func (w *WalletDB) GetScheduledPayment(id string) (*ScheduledPayment, error) {
+	w.scheduleLock.Lock()
+	defer w.scheduleLock.Unlock()
+	return w.getScheduledPayment(id)
+}
+
+func (w *WalletDB) getScheduledPayment(id string) (*ScheduledPayment, error) {
+	data, err := w.GUIlDB.Get(schedulesBucket, []byte(id), new(ScheduledPayment))
+	if err != nil {
+		return nil, err
+	}
+	p, ok := data.(*ScheduledPayment)
+	if !ok || p == nil {
+		return nil, ErrScheduleNotFound
+	}
+	return p, nil
+}
+
+// ListScheduledPayments returns every scheduled payment, oldest first
+func (w *WalletDB) ListScheduledPayments() ([]ScheduledPayment, error) {
+	w.scheduleLock.Lock()
+	defer w.scheduleLock.Unlock()
+	return w.listScheduledPayments()
+}
+
+func (w *WalletDB) listScheduledPayments() ([]ScheduledPayment, error) {
+	all, _, err := w.GUIlDB.GetAll(schedulesBucket, new(ScheduledPayment))
+	if err != nil {
+		return nil, err
+	}
+
+	list := make(ScheduledPayments, 0, len(all))
+	for _, data := range all {
+		if p, ok := data.(*ScheduledPayment); ok {
+			list = append(list, *p)
+		}
+	}
+	sort.Sort(list)
+	return list, nil
+}
+
+// PauseScheduledPayment pauses a scheduled payment, or resumes it. Payments that were due
+// while it was paused are not made.
+func (w *WalletDB) PauseScheduledPayment(id string, paused bool) error {
+	return w.changeScheduledPayment(id, func(p *ScheduledPayment) error {
+		if p.Cancelled {
+			return fmt.Errorf("The scheduled payment was cancelled")
+		}
+		if !paused && p.Paused {
+			p.schedule(time.Now().Add(-time.Second))
+		}
+		p.Paused = paused
+		return nil
+	})
+}
+
+// CancelScheduledPayment stops a scheduled payment for good. It is kept for its history.
+func (w *WalletDB) CancelScheduledPayment(id string) error {
+	return w.changeScheduledPayment(id, func(p *ScheduledPayment) error {
+		p.Cancelled = true
+		p.Next, p.RetryAt, p.Attempts = 0, 0, 0
+		return nil
+	})
+}
+
+func (w *WalletDB) changeScheduledPayment(id string, change func(p *ScheduledPayment) error) error {
+	w.scheduleLock.Lock()
+	defer w.scheduleLock.Unlock()
+
+	p, err := w.getScheduledPayment(id)
+	if err != nil {
+		return err
+	}
+	err = change(p)
+	if err != nil {
+		return err
+	}
+	return w.GUIlDB.Put(schedulesBucket, []byte(p.ID), p)
+}
+
+type scheduler struct {
+	stop chan struct{}
+	done chan struct{} // Closed once the scheduler has stopped
+	sync.Mutex
+}
+
+// StartScheduler makes the scheduled payments as they are due, until the wallet is closed
+func (w *WalletDB) StartScheduler() {
+	w.scheduler.Lock()
+	defer w.scheduler.Unlock()
+	if w.scheduler.stop != nil {
+		return
+	}
+
+	w.scheduler.stop = make(chan struct{})
+	w.scheduler.done = make(chan struct{})
+	go func(stop chan struct{}, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(SCHEDULE_CHECK_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				w.runScheduledPayments(now, stop)
+			case <-stop:
+				return
+			}
+		}
+	}(w.scheduler.stop, w.scheduler.done)
+}
+
+// stopScheduler stops the scheduler, and waits for a payment being made to finish, so the
+// databases are not closed under it
+func (w *WalletDB) stopScheduler() {
+	w.scheduler.Lock()
+	defer w.scheduler.Unlock()
+	if w.scheduler.stop != nil {
+		close(w.scheduler.stop)
+		<-w.scheduler.done
+		w.scheduler.stop, w.scheduler.done = nil, nil
+	}
+}
+
+// runScheduledPayments makes every payment that is due
+func (w *WalletDB) runScheduledPayments(now time.Time, stop chan struct{}) {
+	w.scheduleLock.Lock()
+	defer w.scheduleLock.Unlock()
+
+	list, err := w.listScheduledPayments()
+	if err != nil {
+		fmt.Printf("Could not load the scheduled payments: %s\n", err.Error())
+		return
+	}
+
+	for i := range list {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		p := &list[i]
+		if !p.due(now) {
+			continue
+		}
+		w.runScheduledPayment(p, now)
+		err = w.GUIlDB.Put(schedulesBucket, []byte(p.ID), p)
+		if err != nil {
+			fmt.Printf("Could not save scheduled payment %s: %s\n", p.ID, err.Error())
+		}
+	}
+}
+
+// runScheduledPayment makes a payment that is due, and records how it went
+func (w *WalletDB) runScheduledPayment(p *ScheduledPayment, now time.Time) {
+	run := ScheduledRun{Due: p.Next, Time: now.Unix(), Attempt: p.Attempts + 1}
+	run.TxID, run.Fee, run.Error = w.payScheduled(p, now)
+
+	p.History = append(p.History, run)
+	if len(p.History) > MaxScheduleHistory {
+		p.History = p.History[len(p.History)-MaxScheduleHistory:]
+	}
+
+	if run.Error != "" && p.Attempts < SCHEDULE_MAX_RETRIES {
+		p.Attempts++
+		p.RetryAt = now.Add(SCHEDULE_RETRY_INTERVAL).Unix()
+		return
+	}
+
+	// Paid or given up on. Anything missed since it was due is skipped.
+	if p.Signed != nil {
+		if w.IsDraft(p.Signed.DraftID) {
+			w.DeleteDraft(p.Signed.DraftID)
+		}
+		p.Signed = nil
+	}
+	from := time.Unix(p.Next, 0)
+	if now.After(from) {
+		from = now
+	}
+	p.schedule(from)
+}
+
+// payScheduled sends the payment that is due. The first attempt signs it and saves it
+// before sending, later attempts send the same transaction again, unless factomd already
+// has it.
+func (w *WalletDB) payScheduled(p *ScheduledPayment, now time.Time) (txid string, fee uint64, problem string) {
+	if p.Signed == nil || p.Signed.Due != p.Next {
+		err := w.signScheduled(p)
+		if err != nil {
+			return "", 0, err.Error()
+		}
+	} else if w.scheduledAccepted(p.Signed, now) {
+		// The last attempt reached factomd, though it looked like it failed
+		return p.Signed.TxID, p.Signed.Fee, ""
+	}
+
+	s := p.Signed
+	params := map[string]string{"transaction": s.Raw}
+	_, err := submitTransaction(factom.NewJSON2Request("factoid-submit", factom.APICounter(), params))
+	if err != nil {
+		return "", 0, err.Error()
+	}
+
+	err = w.recordRawBroadcast(s.TxID, s.Raw)
+	if err != nil {
+		fmt.Printf("Could not record the transaction %s was sent: %s\n", s.TxID, err.Error())
+	}
+	return s.TxID, s.Fee, ""
+}
+
+// signScheduled makes and signs the transaction of the payment that is due, and saves it
+// with the payment. It is not sent if it cannot be saved.
+func (w *WalletDB) signScheduled(p *ScheduledPayment) error {
+	if err := w.checkUnlocked(); err != nil {
+		return err
+	}
+	selector, err := GetCoinSelector(p.CoinSelection)
+	if err != nil {
+		return err
+	}
+
+	trans, r, err := w.constructTransaction("", p.ToAddresses, p.ToAmounts, selector, p.FromAddresses)
+	if err != nil {
+		return err
+	}
+	t := w.Wallet.GetTransactions()[trans]
+	if t == nil {
+		w.DeleteDraft(trans)
+		return fmt.Errorf("Transaction not found")
+	}
+	raw, err := t.MarshalBinary()
+	if err != nil {
+		w.DeleteDraft(trans)
+		return err
+	}
+
+	p.Signed = &ScheduledTransaction{
+		Due:     p.Next,
+		DraftID: trans,
+		TxID:    t.GetSigHash().String(),
+		Raw:     hex.EncodeToString(raw),
+		Fee:     r.Fee,
+	}
+	err = w.GUIlDB.Put(schedulesBucket, []byte(p.ID), p)
+	if err != nil {
+		w.DeleteDraft(trans)
+		p.Signed = nil
+		return fmt.Errorf("Could not save the payment before sending it: %s", err.Error())
+	}
+	return nil
+}
+
+// scheduledAccepted is true if factomd has the signed transaction of a payment
+func (w *WalletDB) scheduledAccepted(s *ScheduledTransaction, now time.Time) bool {
+	b := &Broadcast{TxID: s.TxID, Raw: s.Raw, Sent: now.Unix()}
+	if !w.checkBroadcast(b, now) {
+		return false
+	}
+	if b.Status != BroadcastAcknowledged && b.Status != BroadcastConfirmed {
+		return false
+	}
+
+	w.broadcastLock.Lock()
+	_, err := w.getBroadcast(s.TxID)
+	w.broadcastLock.Unlock()
+	if err == ErrBroadcastNotFound {
+		w.recordRawBroadcast(s.TxID, s.Raw)
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package wallet_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+func TestScheduledPaymentNextDue(t *testing.T) {
+	start := time.Date(2017, time.March, 10, 12, 0, 0, 0, time.Local)
+
+	p := ScheduledPayment{Interval: 3600, Start: start.Unix()}
+	if next := p.NextDue(start.Add(-time.Hour)); !next.Equal(start) {
+		t.Errorf("Interval: first due %s", next)
+	}
+	if next := p.NextDue(start); !next.Equal(start.Add(time.Hour)) {
+		t.Errorf("Interval: next due %s", next)
+	}
+	if next := p.NextDue(start.Add(150 * time.Minute)); !next.Equal(start.Add(3 * time.Hour)) {
+		t.Errorf("Interval: missed payments not skipped, due %s", next)
+	}
+	p.End = start.Add(2 * time.Hour).Unix()
+	if next := p.NextDue(start.Add(2 * time.Hour)); !next.IsZero() {
+		t.Errorf("Interval: due %s, after the end", next)
+	}
+
+	cron := func(expr string, after time.Time) time.Time {
+		p := ScheduledPayment{Cron: expr, Start: start.Unix()}
+		return p.NextDue(after)
+	}
+	tests := []struct {
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		{"0 9 1 * *", start, time.Date(2017, time.April, 1, 9, 0, 0, 0, time.Local)},
+		{"*/15 * * * *", start.Add(time.Minute), start.Add(15 * time.Minute)},
+		{"30 8-10 * * 1-5", start, time.Date(2017, time.March, 13, 8, 30, 0, 0, time.Local)}, // A Friday
+		{"0 0 * * 7", start, time.Date(2017, time.March, 12, 0, 0, 0, 0, time.Local)},
+		{"@daily", start, time.Date(2017, time.March, 11, 0, 0, 0, 0, time.Local)},
+		{"0 0 30 2 *", start, time.Time{}},
+		// Before the start
+		{"0 0 * * *", start.AddDate(0, 0, -5), time.Date(2017, time.March, 11, 0, 0, 0, 0, time.Local)},
+	}
+	for _, test := range tests {
+		if got := cron(test.expr, test.after); !got.Equal(test.want) {
+			t.Errorf("%s: due %s, expected %s", test.expr, got, test.want)
+		}
+	}
+
+	if got := cron("60 * * * *", start); !got.IsZero() {
+		t.Errorf("An invalid cron expression is due %s", got)
+	}
+}
+
+func TestScheduledPaymentPaid(t *testing.T) {
+	defer UseTempDataDir(t)()
+
+	wal, err := NewWalletDB(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+
+	sand, err := wal.AddAddress("Sand", "Fs3E9gV6DXsYzf7Fqx1fVBQPQXV695eP3k5XbmHEZVRLkMdD9qCK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer StubFactomdBalances(1000, map[string]int64{sand.Address: 5e8})()
+	factomd := new(fakeFactomd) // Unreachable at first
+	defer StubFactomd(factomd.request)()
+
+	p, err := wal.CreateScheduledPayment(ScheduledPayment{
+		ToAddresses: []string{"FA3HRq8jFUhzN9c8iKTBBfXyNyijSnov1ZLJtJMKTXFQNmncWZoE"},
+		ToAmounts:   []uint64{1e8},
+		Interval:    3600,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	due := time.Unix(p.Next, 0)
+
+	// Sending fails, but the signed transaction is saved to send again
+	wal.RunScheduledPayments(due)
+	if p, err = wal.GetScheduledPayment(p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if p.Signed == nil || p.Signed.Raw == "" || p.Signed.TxID == "" || p.Signed.Fee == 0 {
+		t.Fatalf("The signed transaction was not saved: %+v", p.Signed)
+	}
+	if p.Attempts != 1 || p.RetryAt == 0 || len(p.History) != 1 || p.History[0].Error == "" {
+		t.Fatalf("Expected one failed attempt, found %d attempts and history %+v", p.Attempts, p.History)
+	}
+	if err = wal.ValidateSignatures(p.Signed.DraftID); err != nil {
+		t.Error(err)
+	}
+	signed := *p.Signed
+
+	// The retry sends the same transaction, and the next payment is scheduled
+	factomd.status = "NotConfirmed"
+	wal.RunScheduledPayments(time.Unix(p.RetryAt, 0))
+	if p, err = wal.GetScheduledPayment(p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if factomd.submitted != 1 {
+		t.Errorf("Submitted %d times", factomd.submitted)
+	}
+	last := p.History[len(p.History)-1]
+	if len(p.History) != 2 || last.Error != "" || last.TxID != signed.TxID || last.Fee != signed.Fee {
+		t.Errorf("Expected the saved transaction paid, found history %+v", p.History)
+	}
+	if p.Signed != nil || p.Attempts != 0 || p.RetryAt != 0 || p.Next != due.Add(time.Hour).Unix() {
+		t.Errorf("The next payment was not scheduled: %+v", p)
+	}
+	if b, err := wal.GetBroadcast(signed.TxID); err != nil || b.Raw != signed.Raw {
+		t.Errorf("The payment is not tracked: %v", err)
+	}
+}
@@ -0,0 +1,793 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/enterprise-wallet/marshal"
+	"github.com/FactomProject/enterprise-wallet/wallet/database"
+	"github.com/FactomProject/factom/wallet"
+	"github.com/FactomProject/factomd/common/interfaces"
+)
+
+// Snapshots are copies of the wallet and GUI databases (the GUI database holds the
+// settings), kept in the snapshots directory. They are taken periodically, and before
+// anything that removes data. Records are copied exactly as they are stored, so the
+// keys of an encrypted wallet stay encrypted in its snapshots. When a wallet is encrypted,
+// the snapshots taken before are encrypted too. The related transactions cache is left
+// out, it is large and is built again.
+//
+// Snapshot layout (see the marshal package):
+//	Version 1
+//	Fields: Type, Created, Reason, Wallet database, GUI database, Checksum of both databases
+// A database is a list of records, a record is a bucket, key and value.
+
+var (
+	// SNAPSHOT_RETENTION is how many snapshots are kept, the oldest are removed first.
+	// 0 disables automatic snapshots.
+	SNAPSHOT_RETENTION int = 24
+	// SNAPSHOT_INTERVAL is how often a periodic snapshot is taken. One is only taken if
+	// something changed since the last.
+	SNAPSHOT_INTERVAL time.Duration = time.Hour
+)
+
+const (
+	snapshotVersion byte   = 1
+	snapshotType    string = "enterprise-wallet-snapshot"
+	snapshotExt     string = ".snapshot"
+
+	snapshotTagType     uint64 = 1
+	snapshotTagCreated  uint64 = 2
+	snapshotTagReason   uint64 = 3
+	snapshotTagWallet   uint64 = 4
+	snapshotTagGUI      uint64 = 5
+	snapshotTagChecksum uint64 = 6
+
+	dumpTagRecord uint64 = 1
+
+	recordTagBucket uint64 = 1
+	recordTagKey    uint64 = 2
+	recordTagData   uint64 = 3
+)
+
+// SnapshotDir returns the directory the snapshots of the databases in dir are kept in
+func SnapshotDir(dir string) string {
+	return filepath.Join(dir, "snapshots")
+}
+
+// SnapshotDir returns the directory the snapshots of this wallet are kept in
+func (w *WalletDB) SnapshotDir() string {
+	return SnapshotDir(w.Profile.Dir())
+}
+
+// ListSnapshots returns the snapshots of this wallet, see ListSnapshots
+func (w *WalletDB) ListSnapshots() ([]SnapshotInfo, error) {
+	return ListSnapshots(w.Profile.Dir())
+}
+
+// SnapshotInfo describes a snapshot file
+type SnapshotInfo struct {
+	Name    string // File name in the snapshot directory
+	Created int64
+	Reason  string
+	Size    int64
+	Good    bool   // False if the snapshot cannot be read, or its checksum does not match
+	Problem string // Why the snapshot is not good
+}
+
+type snapshot struct {
+	info     SnapshotInfo
+	walletDB []byte
+	guiDB    []byte
+	sum      []byte
+}
+
+type snapshotter struct {
+	auto    bool   // Automatic snapshots are taken
+	lastSum []byte // Checksum of the last snapshot taken
+	stop    chan struct{}
+	sync.Mutex
+}
+
+func snapshotChecksum(walletDB []byte, guiDB []byte) []byte {
+	h := sha256.New()
+	h.Write(walletDB)
+	h.Write(guiDB)
+	return h.Sum(nil)
+}
+
+// dumpDatabase copies every record of the database, as it is stored. The buckets in skip
+// are left out.
+func dumpDatabase(db interfaces.IDatabase, skip ...[]byte) ([]byte, error) {
+	buckets, err := db.ListAllBuckets()
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(database.ByteSlices(buckets))
+
+	dump := marshal.NewWriter()
+buckets:
+	for _, bucket := range buckets {
+		for _, b := range skip {
+			if bytes.Equal(bucket, b) {
+				continue buckets
+			}
+		}
+		values, keys, err := db.GetAll(bucket, new(database.RawData))
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			raw, ok := v.(*database.RawData)
+			if !ok {
+				return nil, fmt.Errorf("Could not read bucket %s", bucket)
+			}
+			r := marshal.NewWriter()
+			r.Bytes(recordTagBucket, bucket)
+			r.Bytes(recordTagKey, keys[i])
+			r.Bytes(recordTagData, raw.Data)
+			dump.Bytes(dumpTagRecord, r.Marshal(snapshotVersion))
+		}
+	}
+	return dump.Marshal(snapshotVersion), nil
+}
+
+// loadDump replaces everything in the database with the records of a dump
+func loadDump(db interfaces.IDatabase, data []byte) error {
+	_, fields, _, err := marshal.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+
+	var records []interfaces.Record
+	for _, f := range fields {
+		if f.Tag != dumpTagRecord {
+			continue
+		}
+		_, rfields, _, err := marshal.Unmarshal(f.Data)
+		if err != nil {
+			return err
+		}
+		var r interfaces.Record
+		var value []byte
+		for _, rf := range rfields {
+			switch rf.Tag {
+			case recordTagBucket:
+				r.Bucket = rf.Data
+			case recordTagKey:
+				r.Key = rf.Data
+			case recordTagData:
+				value = rf.Data
+			}
+		}
+		r.Data = database.NewRawData(value)
+		records = append(records, r)
+	}
+
+	buckets, err := db.ListAllBuckets()
+	if err != nil {
+		return err
+	}
+	for _, bucket := range buckets {
+		err = db.Clear(bucket)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+	return db.PutInBatch(records)
+}
+
+// walletRawDB is the wallet database without the encryption layer
+func (w *WalletDB) walletRawDB() interfaces.IDatabase {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.lock.encryptedDB != nil {
+		return w.lock.encryptedDB.RawDB()
+	}
+	return w.Wallet.DBO.DB
+}
+
+// TakeSnapshot saves a snapshot of the wallet and GUI databases to the snapshot directory
+func (w *WalletDB) TakeSnapshot(reason string) (*SnapshotInfo, error) {
+	return w.takeSnapshot(reason, false)
+}
+
+// takeSnapshot skips the snapshot, and returns nil, if onlyIfChanged and nothing changed
+func (w *WalletDB) takeSnapshot(reason string, onlyIfChanged bool) (*SnapshotInfo, error) {
+	w.snapshots.Lock()
+	defer w.snapshots.Unlock()
+
+	walletDump, err := dumpDatabase(w.walletRawDB())
+	if err != nil {
+		return nil, err
+	}
+	guiDump, err := dumpDatabase(w.GUIlDB, relatedTransactionsBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := snapshotChecksum(walletDump, guiDump)
+	if onlyIfChanged && bytes.Equal(sum, w.snapshots.lastSum) {
+		return nil, nil
+	}
+
+	info, err := saveSnapshot(w.Profile.Dir(), reason, walletDump, guiDump)
+	if err != nil {
+		return nil, err
+	}
+
+	w.snapshots.lastSum = sum
+	return info, nil
+}
+
+// saveSnapshot writes the dumps of the databases in dir to a new snapshot file, and
+// removes the oldest snapshots past SNAPSHOT_RETENTION
+func saveSnapshot(dir string, reason string, walletDump []byte, guiDump []byte) (*SnapshotInfo, error) {
+	info := new(SnapshotInfo)
+	created := time.Now()
+	info.Created = created.Unix()
+	info.Reason = cleanReason(reason)
+	info.Name = created.Format("20060102-150405.000000") + "-" + info.Reason + snapshotExt
+	info.Good = true
+
+	err := writeSnapshot(dir, info, walletDump, guiDump)
+	if err != nil {
+		return nil, err
+	}
+
+	pruneSnapshots(dir)
+	return info, nil
+}
+
+// writeSnapshot writes a snapshot file, replacing any with the same name
+func writeSnapshot(dir string, info *SnapshotInfo, walletDump []byte, guiDump []byte) error {
+	sum := snapshotChecksum(walletDump, guiDump)
+
+	m := marshal.NewWriter()
+	m.String(snapshotTagType, snapshotType)
+	m.Uint64(snapshotTagCreated, uint64(info.Created))
+	m.String(snapshotTagReason, info.Reason)
+	m.Bytes(snapshotTagWallet, walletDump)
+	m.Bytes(snapshotTagGUI, guiDump)
+	m.Bytes(snapshotTagChecksum, sum)
+	data := m.Marshal(snapshotVersion)
+	info.Size = int64(len(data))
+
+	snapDir := SnapshotDir(dir)
+	err := os.MkdirAll(snapDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	// Written under another name first, so a snapshot is never found half written
+	path := filepath.Join(snapDir, info.Name)
+	err = ioutil.WriteFile(path+".tmp", data, 0600)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return nil
+}
+
+// encryptSnapshots encrypts the wallet database in every snapshot taken before the wallet
+// was encrypted, so its keys are not left in the clear. A snapshot that cannot be read or
+// encrypted is removed.
+func (w *WalletDB) encryptSnapshots(passphrase string) {
+	w.snapshots.Lock()
+	defer w.snapshots.Unlock()
+
+	dir := w.Profile.Dir()
+	names, err := snapshotNames(dir)
+	if err != nil {
+		fmt.Printf("Could not encrypt the snapshots: %s\n", err.Error())
+		return
+	}
+	for _, name := range names {
+		err = encryptSnapshot(dir, name, passphrase)
+		if err != nil {
+			fmt.Printf("Removing snapshot %s, it could not be encrypted: %s\n", name, err.Error())
+			os.Remove(filepath.Join(SnapshotDir(dir), name))
+		}
+	}
+	w.snapshots.lastSum = nil
+}
+
+func encryptSnapshot(dir string, name string, passphrase string) error {
+	s, err := readSnapshot(dir, name)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := database.NewMapDB()
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()
+	err = loadDump(tmp, s.walletDB)
+	if err != nil {
+		return err
+	}
+	encrypted, err := database.CheckEncrypted(tmp)
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		return nil
+	}
+
+	_, err = database.EncryptDatabase(tmp, passphrase)
+	if err != nil {
+		return err
+	}
+	walletDump, err := dumpDatabase(tmp)
+	if err != nil {
+		return err
+	}
+	return writeSnapshot(dir, &s.info, walletDump, s.guiDB)
+}
+
+// cleanReason makes the reason safe to use in a file name
+func cleanReason(reason string) string {
+	reason = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, reason)
+	if reason == "" {
+		return "manual"
+	}
+	return reason
+}
+
+// SnapshotBefore takes a snapshot before something that removes data, if automatic
+// snapshots are on. The action is not stopped if the snapshot fails.
+func (w *WalletDB) SnapshotBefore(reason string) {
+	if !w.snapshots.auto {
+		return
+	}
+	_, err := w.takeSnapshot("before-"+reason, true)
+	if err != nil {
+		fmt.Printf("Could not take a snapshot before %s: %s\n", reason, err.Error())
+	}
+}
+
+// startSnapshots takes a snapshot of the databases just opened, then one every
+// SNAPSHOT_INTERVAL
+func (w *WalletDB) startSnapshots() {
+	if !w.snapshots.auto {
+		return
+	}
+
+	if newest := newestGoodSnapshot(w.Profile.Dir()); newest != nil {
+		if s, err := readSnapshot(w.Profile.Dir(), newest.Name); err == nil {
+			w.snapshots.lastSum = s.sum
+		}
+	}
+	_, err := w.takeSnapshot("startup", true)
+	if err != nil {
+		fmt.Printf("Could not take a snapshot: %s\n", err.Error())
+	}
+
+	if SNAPSHOT_INTERVAL <= 0 {
+		return
+	}
+	w.snapshots.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(SNAPSHOT_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_, err := w.takeSnapshot("periodic", true)
+				if err != nil {
+					fmt.Printf("Could not take a snapshot: %s\n", err.Error())
+				}
+			case <-stop:
+				return
+			}
+		}
+	}(w.snapshots.stop)
+}
+
+func (w *WalletDB) stopSnapshots() {
+	w.snapshots.Lock()
+	defer w.snapshots.Unlock()
+	if w.snapshots.stop != nil {
+		close(w.snapshots.stop)
+		w.snapshots.stop = nil
+	}
+}
+
+// snapshotNames returns the file names of all snapshots, oldest first
+func snapshotNames(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(SnapshotDir(dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), snapshotExt) {
+			names = append(names, f.Name())
+		}
+	}
+	// Names start with the time taken
+	sort.Strings(names)
+	return names, nil
+}
+
+func pruneSnapshots(dir string) {
+	if SNAPSHOT_RETENTION <= 0 {
+		return
+	}
+	names, err := snapshotNames(dir)
+	if err != nil {
+		return
+	}
+	for len(names) > SNAPSHOT_RETENTION {
+		os.Remove(filepath.Join(SnapshotDir(dir), names[0]))
+		names = names[1:]
+	}
+}
+
+// ListSnapshots returns all snapshots of the databases in dir, newest first. Snapshots
+// that cannot be used are included, and marked as not good.
+func ListSnapshots(dir string) ([]SnapshotInfo, error) {
+	names, err := snapshotNames(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]SnapshotInfo, 0, len(names))
+	for i := len(names) - 1; i >= 0; i-- {
+		s, err := readSnapshot(dir, names[i])
+		if err != nil {
+			info := SnapshotInfo{Name: names[i], Problem: err.Error()}
+			if s != nil {
+				info = s.info
+				info.Problem = err.Error()
+			}
+			list = append(list, info)
+			continue
+		}
+		list = append(list, s.info)
+	}
+	return list, nil
+}
+
+func newestGoodSnapshot(dir string) *SnapshotInfo {
+	list, err := ListSnapshots(dir)
+	if err != nil {
+		return nil
+	}
+	for _, info := range list {
+		if info.Good {
+			return &info
+		}
+	}
+	return nil
+}
+
+// readSnapshot reads and checks a snapshot. If the file could be read, but is not
+// good, the snapshot is returned with the error.
+func readSnapshot(dir string, name string) (*snapshot, error) {
+	if name == "" || filepath.Base(name) != name || !strings.HasSuffix(name, snapshotExt) {
+		return nil, fmt.Errorf("'%s' is not a snapshot name", name)
+	}
+
+	path := filepath.Join(SnapshotDir(dir), name)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(snapshot)
+	s.info.Name = name
+	s.info.Size = int64(len(data))
+
+	version, fields, _, err := marshal.Unmarshal(data)
+	if err != nil {
+		return s, fmt.Errorf("Not a snapshot: %s", err.Error())
+	}
+	if version > snapshotVersion {
+		return s, fmt.Errorf("The snapshot is version %d, this wallet can only read up to version %d", version, snapshotVersion)
+	}
+
+	var typ string
+	var created uint64
+	for _, f := range fields {
+		switch f.Tag {
+		case snapshotTagType:
+			typ = f.String()
+		case snapshotTagCreated:
+			created, err = f.Uint64()
+		case snapshotTagReason:
+			s.info.Reason = f.String()
+		case snapshotTagWallet:
+			s.walletDB = f.Data
+		case snapshotTagGUI:
+			s.guiDB = f.Data
+		case snapshotTagChecksum:
+			s.sum = f.Data
+		}
+		if err != nil {
+			return s, err
+		}
+	}
+	s.info.Created = int64(created)
+
+	if typ != snapshotType {
+		return s, fmt.Errorf("Not a snapshot")
+	}
+	if s.walletDB == nil || s.guiDB == nil {
+		return s, fmt.Errorf("The snapshot is missing a database")
+	}
+	if !bytes.Equal(snapshotChecksum(s.walletDB, s.guiDB), s.sum) {
+		return s, fmt.Errorf("The snapshot is corrupted, the checksum does not match")
+	}
+
+	s.info.Good = true
+	return s, nil
+}
+
+// RestoreSnapshot replaces the wallet and GUI databases with a snapshot. A snapshot is
+// taken first, so the restore can be undone. Private keys are never removed, keys added
+// since the snapshot was taken are kept. If the snapshot is of an encrypted wallet, the
+// passphrase it was encrypted with is needed. An encrypted wallet stays encrypted: a
+// snapshot taken before it was encrypted is encrypted with the passphrase of the wallet,
+// which is needed instead.
+func (w *WalletDB) RestoreSnapshot(name string, passphrase string) error {
+	if err := w.checkUnlocked(); err != nil {
+		return err
+	}
+
+	s, err := readSnapshot(w.Profile.Dir(), name)
+	if err != nil {
+		return err
+	}
+
+	fas, ecs, err := w.Wallet.GetAllAddresses()
+	if err != nil {
+		return err
+	}
+	current, err := w.Wallet.GetDBSeed()
+	if err != nil {
+		return err
+	}
+
+	// The wallet in the snapshot is put together in memory, before touching the databases
+	tmp, err := database.NewMapDB()
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()
+	err = loadDump(tmp, s.walletDB)
+	if err != nil {
+		return err
+	}
+
+	tmpWallet, err := wallet.NewMapDBWallet()
+	if err != nil {
+		return err
+	}
+	tmpWallet.DBO.DB.Close()
+	tmpWallet.DBO.DB = tmp
+	snapshotEncrypted, err := database.CheckEncrypted(tmp)
+	if err != nil {
+		return err
+	}
+	if snapshotEncrypted {
+		enc, err := database.OpenEncryptedDB(tmp)
+		if err != nil {
+			return err
+		}
+		err = enc.Unlock(passphrase)
+		if err != nil {
+			return fmt.Errorf("The snapshot is of an encrypted wallet, and needs the passphrase it was encrypted with")
+		}
+		tmpWallet.DBO.DB = enc
+	} else if w.IsEncrypted() {
+		// Never turn an encrypted wallet back into a plain one
+		current, err := database.OpenEncryptedDB(w.walletRawDB())
+		if err != nil {
+			return err
+		}
+		if current.Unlock(passphrase) != nil {
+			return fmt.Errorf("The snapshot was taken before the wallet was encrypted, and needs the passphrase of the wallet to encrypt it with")
+		}
+		enc, err := database.EncryptDatabase(tmp, passphrase)
+		if err != nil {
+			return err
+		}
+		tmpWallet.DBO.DB = enc
+	}
+
+	for _, fa := range fas {
+		if err = tmpWallet.InsertFCTAddress(fa); err != nil {
+			return err
+		}
+	}
+	for _, ec := range ecs {
+		if err = tmpWallet.InsertECAddress(ec); err != nil {
+			return err
+		}
+	}
+
+	// Never hand out an address of the seed twice
+	seed, err := tmpWallet.GetDBSeed()
+	if err == nil && seed != nil && current != nil && seed.MnemonicSeed == current.MnemonicSeed {
+		if current.NextFactoidAddressIndex > seed.NextFactoidAddressIndex {
+			seed.NextFactoidAddressIndex = current.NextFactoidAddressIndex
+		}
+		if current.NextECAddressIndex > seed.NextECAddressIndex {
+			seed.NextECAddressIndex = current.NextECAddressIndex
+		}
+		if err = tmpWallet.InsertDBSeed(seed); err != nil {
+			return err
+		}
+	}
+
+	walletDump, err := dumpDatabase(tmp)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.TakeSnapshot("before-restore")
+	if err != nil {
+		return fmt.Errorf("Could not take a snapshot before restoring, nothing was changed: %s", err.Error())
+	}
+
+	raw := w.walletRawDB()
+	err = loadDump(raw, walletDump)
+	if err != nil {
+		return err
+	}
+
+	var enc *database.EncryptedDB
+	encrypted, err := database.CheckEncrypted(raw)
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		enc, err = database.OpenEncryptedDB(raw)
+		if err != nil {
+			return err
+		}
+		err = enc.Unlock(passphrase)
+		if err != nil {
+			return err
+		}
+	}
+	w.lock.Lock()
+	w.lock.encryptedDB = enc
+	if enc != nil {
+		w.Wallet.DBO.DB = enc
+	} else {
+		w.Wallet.DBO.DB = raw
+	}
+	w.lock.Unlock()
+	w.ResetLockTimer()
+
+	err = loadDump(w.GUIlDB, s.guiDB)
+	if err != nil {
+		return err
+	}
+
+	data, err := w.GUIlDB.Get([]byte("gui-wallet"), []byte("wallet"), new(WalletStruct))
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		w.guiWallet = data.(*WalletStruct)
+	} else {
+		w.guiWallet = NewWallet()
+	}
+
+	err = w.recoverJournal()
+	if err != nil {
+		return err
+	}
+
+	// Keys added since the snapshot need names
+	err = w.UpdateGUIDB()
+	if err != nil {
+		return err
+	}
+
+	w.InvalidateTransactionCache()
+	return w.Save()
+}
+
+// OpenError is returned when the wallet or GUI database cannot be opened. If there is
+// a good snapshot to recover the database from, Snapshot is the newest.
+type OpenError struct {
+	Dir      string // Directory of the profile the database belongs to
+	Kind     database.DBKind
+	Err      error
+	Snapshot *SnapshotInfo
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("The %s database could not be opened: %s", e.Kind, e.Err.Error())
+}
+
+func openError(dir string, kind database.DBKind, b *database.Backend, err error) error {
+	if b.InMemory {
+		return err
+	}
+	return &OpenError{Dir: dir, Kind: kind, Err: err, Snapshot: newestGoodSnapshot(dir)}
+}
+
+// RecoverFromSnapshot replaces a database in dir that cannot be opened with its copy in
+// a snapshot. The database file is kept next to the new one, with '.corrupt' added to
+// the name. Must be called before the wallet is loaded.
+func RecoverFromSnapshot(dir string, kind database.DBKind, name string) error {
+	var backendName string
+	switch kind {
+	case database.WalletDB:
+		backendName = WALLET_DB
+	case database.GUIDB:
+		backendName = GUI_DB
+	default:
+		return fmt.Errorf("Snapshots do not hold the %s database", kind)
+	}
+
+	b, err := database.GetBackend(backendName)
+	if err != nil {
+		return err
+	}
+	if b.InMemory {
+		return fmt.Errorf("The %s database is kept in memory, there is nothing to recover", kind)
+	}
+
+	s, err := readSnapshot(dir, name)
+	if err != nil {
+		return err
+	}
+	dump := s.guiDB
+	if kind == database.WalletDB {
+		dump = s.walletDB
+	}
+
+	path := b.Path(dir, kind)
+	if _, err := os.Stat(path); err == nil {
+		err = os.Rename(path, path+".corrupt-"+time.Now().Format("20060102-150405"))
+		if err != nil {
+			return err
+		}
+	}
+
+	db, err := b.Open(path)
+	if err != nil {
+		return err
+	}
+	err = loadDump(db, dump)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	return db.Close()
+}
@@ -0,0 +1,96 @@
+package wallet_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	err := LoadTestWallet(8089)
+	defer StopTestWallet(true)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	dir, err := ioutil.TempDir("", "wallet-snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldDir := DATA_DIR
+	DATA_DIR = dir
+	defer func() { DATA_DIR = oldDir }()
+
+	anp, err := TestWallet.GenerateFactoidAddress("SnapMe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := TestWallet.TakeSnapshot("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = TestWallet.ChangeAddressName(anp.Address, "Renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keys added after the snapshot are kept
+	added, err := TestWallet.GenerateFactoidAddress("AfterSnap")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = TestWallet.RestoreSnapshot(info.Name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, list := TestWallet.GetGUIAddress(anp.Address)
+	if list != 1 || restored.Name != "SnapMe" {
+		t.Fatal("Name not restored from the snapshot")
+	}
+	if _, list = TestWallet.GetGUIAddress(added.Address); list != 1 {
+		t.Fatal("Address added after the snapshot was lost")
+	}
+
+	// A restore can be undone, so there are now 2
+	list2, err := TestWallet.ListSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list2) != 2 {
+		t.Fatalf("Expected 2 snapshots, found %d", len(list2))
+	}
+
+	// Corrupt the snapshot
+	path := filepath.Join(TestWallet.SnapshotDir(), info.Name)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xFF
+	err = ioutil.WriteFile(path, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list2, err = TestWallet.ListSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range list2 {
+		if s.Name == info.Name && s.Good {
+			t.Fatal("Corrupted snapshot is marked as good")
+		}
+	}
+	if err = TestWallet.RestoreSnapshot(info.Name, ""); err == nil {
+		t.Fatal("Restored a corrupted snapshot")
+	}
+	if err = TestWallet.RestoreSnapshot("../"+info.Name, ""); err == nil {
+		t.Fatal("Restored a snapshot outside the snapshot directory")
+	}
+}
@@ -0,0 +1,126 @@
+package wallet
+
+import (
+	"fmt"
+
+	"github.com/FactomProject/enterprise-wallet/address"
+)
+
+// A factoid address can have a spending policy, kept with its name in the GUI database.
+//		Frozen:		Never used as an input
+//		Reserved:	Held for a purpose. Automatic coin selection does not use it, but it
+//					can be chosen as an input of a custom transaction
+//		MinBalance:	Nothing may spend the address below this many factoshis
+
+// FreezeAddress stops a factoid address from being used as an input, or allows it again
+func (w *WalletDB) FreezeAddress(addr string, frozen bool) error {
+	return w.setAddressPolicy(addr, func(anp *address.AddressNamePair) {
+		anp.Frozen = frozen
+	})
+}
+
+// ReserveAddress reserves a factoid address for a purpose. An empty purpose releases it.
+func (w *WalletDB) ReserveAddress(addr string, purpose string) error {
+	return w.setAddressPolicy(addr, func(anp *address.AddressNamePair) {
+		anp.Reserved = purpose
+	})
+}
+
+// SetAddressMinBalance sets how many factoshis must be left in a factoid address. 0 removes
+// the minimum.
+func (w *WalletDB) SetAddressMinBalance(addr string, minBalance uint64) error {
+	return w.setAddressPolicy(addr, func(anp *address.AddressNamePair) {
+		anp.MinBalance = minBalance
+	})
+}
+
+func (w *WalletDB) setAddressPolicy(addr string, change func(anp *address.AddressNamePair)) error {
+	anp, list := w.GetGUIAddress(addr)
+	if list == -1 || anp == nil {
+		return fmt.Errorf("Address not found")
+	}
+
+	policy := *anp
+	change(&policy)
+	err := w.guiWallet.SetAddressPolicy(addr, policy.Frozen, policy.Reserved, policy.MinBalance)
+	if err != nil {
+		return err
+	}
+
+	w.relatedTransactionLock.Lock() // Related Transactions uses this
+	if cached, ok := w.addrMap[addr]; ok {
+		cached.Frozen, cached.Reserved, cached.MinBalance = policy.Frozen, policy.Reserved, policy.MinBalance
+		w.addrMap[addr] = cached
+	}
+	w.relatedTransactionLock.Unlock()
+	return w.Save()
+}
+
+// checkSpend returns an error if taking amount from one of the factoid addresses breaks
+// its spending policy. Addresses not in the wallet have no policy.
+func (w *WalletDB) checkSpend(addr string, balance uint64, amount uint64) error {
+	anp, list := w.GetGUIAddress(addr)
+	if list != 1 || anp == nil {
+		return nil
+	}
+	return anp.CheckSpend(balance, amount)
+}
+
+// spendableBalances returns every factoid address that can pay, with how much of its balance
+// can be spent. Reserved addresses are only included if byHand, as they are only spent when
+// chosen as an input.
+func (w *WalletDB) spendableBalances(byHand bool) ([]AddressBalancePair, error) {
+	faAddresses, err := w.Wallet.GetAllFCTAddresses()
+	if err != nil {
+		return nil, err
+	}
+	var addresses []string
+	for _, fa := range faAddresses {
+		addresses = append(addresses, fa.String())
+	}
+
+	// A watch-only wallet spends from the addresses it has public keys for
+	keys, err := w.watchKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if k.List == 1 {
+			addresses = append(addresses, k.Address)
+		}
+	}
+
+	var list []AddressBalancePair
+	for _, addr := range addresses {
+		spendable, err := w.spendableBalance(addr, byHand)
+		if err != nil {
+			return nil, err
+		}
+		if spendable > 0 {
+			list = append(list, AddressBalancePair{addr, spendable})
+		}
+	}
+	return list, nil
+}
+
+// spendableBalance is how much of the balance of an address can be spent, see
+// spendableBalances. All of the balance of an address not in the wallet can be.
+func (w *WalletDB) spendableBalance(addr string, byHand bool) (uint64, error) {
+	balance, err := getFactoidBalance(addr)
+	if err != nil {
+		return 0, err
+	}
+	if balance <= 0 {
+		return 0, nil
+	}
+
+	spendable := uint64(balance)
+	if anp, l := w.GetGUIAddress(addr); l == 1 && anp != nil {
+		policy := *anp
+		if byHand {
+			policy.Reserved = ""
+		}
+		spendable = policy.Spendable(spendable)
+	}
+	return spendable, nil
+}
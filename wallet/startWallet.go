@@ -7,18 +7,27 @@ import (
 
 // StartWallet :
 // Must give the port for the factomd instance
-func StartWallet(factomdLocation string, walletDBType int, guiDBType int, txDBType int, v1Import bool) (*WalletDB, error) {
+// The database types are names of backends registered in the database package
+// The profile is the name of the wallet to open, see ListProfiles
+// A Shared transaction database already open, in this or another process, is attached
+// to instead of opened again
+func StartWallet(factomdLocation string, walletDBType string, guiDBType string, txDBType string, profile string, v1Import bool) (*WalletDB, error) {
 	// Set ports
 	// factom.SetWalletServer("localhost:" + fmt.Sprintf("%d", walletPort))
 	factom.SetFactomdServer(factomdLocation) //"localhost:" + fmt.Sprintf("%d", factomdPort))
 
-	// Can change to MAP, LDB, BOLT
+	// Can change to MAP, LDB, BOLT or any other registered backend
 	GUI_DB = guiDBType
 	WALLET_DB = walletDBType
 	TX_DB = txDBType
 
+	p, err := GetProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+
 	// Load the databases relavent to the wallet
-	wal, err := LoadWalletDB(v1Import)
+	wal, err := NewProfileWalletDB(p, v1Import)
 	if err != nil {
 		return nil, err
 	}
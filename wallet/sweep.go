@@ -0,0 +1,201 @@
+package wallet
+
+import (
+	"fmt"
+
+	"github.com/FactomProject/enterprise-wallet/fct"
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factomd/common/factoid"
+)
+
+// A sweep sends everything it can from its inputs to one factoid address. The fee is taken
+// from the output, so the amount sent is the total of the inputs less the fee.
+
+// ConstructSweepTransaction sweeps the addresses given to toAddress. No addresses sweeps the
+// whole wallet, leaving out frozen and reserved addresses. Minimum balances are always left.
+// The transaction is put in the draft given, or a new draft if the ID is empty.
+func (wal *WalletDB) ConstructSweepTransaction(draftID string, fromAddresses []string, toAddress string) (trans string, r *ReturnTransStruct, err error) {
+	if err := wal.checkSweepDestination(toAddress); err != nil {
+		return "", nil, err
+	}
+	if err := wal.checkUnlocked(); err != nil {
+		return "", nil, err
+	}
+	if err := wal.checkSecrets(); err != nil {
+		return "", nil, err
+	}
+
+	var inputs []AddressBalancePair
+	if len(fromAddresses) == 0 {
+		inputs, err = wal.spendableBalances(false)
+	} else {
+		inputs, err = wal.sweepInputs(fromAddresses)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if len(inputs) == 0 {
+		return "", nil, fmt.Errorf("There are no factoids to sweep")
+	}
+
+	rate, err := getRate()
+	if err != nil {
+		return "", nil, err
+	}
+
+	trans, created, err := wal.openDraft(draftID)
+	if err != nil {
+		return trans, nil, err
+	}
+	defer func() { err = wal.closeDraft(trans, created, err) }()
+
+	var total uint64
+	for _, in := range inputs {
+		err = wal.Wallet.AddInput(trans, in.Address, in.Balance)
+		if err != nil {
+			return trans, nil, err
+		}
+		total += in.Balance
+	}
+
+	r, err = wal.sweepOutput(trans, toAddress, total, rate)
+	if err != nil {
+		return trans, nil, err
+	}
+
+	err = wal.Wallet.SignTransaction(trans, true)
+	if err != nil {
+		return trans, nil, err
+	}
+	return trans, r, nil
+}
+
+// ConstructSweepFromKey sweeps the address of a private key that is not in the wallet to
+// toAddress. The key only signs the transaction, it is not saved.
+// The transaction is put in the draft given, or a new draft if the ID is empty.
+func (wal *WalletDB) ConstructSweepFromKey(draftID string, secret string, toAddress string) (trans string, r *ReturnTransStruct, err error) {
+	if err := wal.checkSecrets(); err != nil {
+		return "", nil, err
+	}
+	if err := wal.checkSweepDestination(toAddress); err != nil {
+		return "", nil, err
+	}
+
+	fa, err := factom.GetFactoidAddress(secret)
+	if err != nil {
+		return "", nil, fmt.Errorf("Not a valid private key")
+	}
+	balance, err := getFactoidBalance(fa.String())
+	if err != nil {
+		return "", nil, err
+	}
+	if balance <= 0 {
+		return "", nil, fmt.Errorf("%s has no factoids to sweep", fa.String())
+	}
+
+	rate, err := getRate()
+	if err != nil {
+		return "", nil, err
+	}
+
+	trans, created, err := wal.openDraft(draftID)
+	if err != nil {
+		return trans, nil, err
+	}
+	defer func() { err = wal.closeDraft(trans, created, err) }()
+
+	// The factom wallet can only add inputs it has the key for
+	t := wal.Wallet.GetTransactions()[trans]
+	if t == nil {
+		return trans, nil, fmt.Errorf("Transaction not found")
+	}
+	t.AddInput(factoid.NewAddress(fa.RCDHash()), uint64(balance))
+	t.AddRCD(factoid.NewRCD_1(fa.PubBytes()))
+
+	r, err = wal.sweepOutput(trans, toAddress, uint64(balance), rate)
+	if err != nil {
+		return trans, nil, err
+	}
+
+	// Nor can it sign for it
+	data, err := t.MarshalBinarySig()
+	if err != nil {
+		return trans, nil, err
+	}
+	t.SetSignatureBlock(0, factoid.NewSingleSignatureBlock(fa.SecBytes(), data))
+	return trans, r, nil
+}
+
+func (wal *WalletDB) checkSweepDestination(toAddress string) error {
+	if !wal.IsValidAddress(toAddress) || toAddress[:2] != "FA" {
+		return fmt.Errorf("A sweep can only be sent to a factoid address")
+	}
+	return nil
+}
+
+// sweepInputs returns how much each address can sweep. A reserved address was chosen on
+// purpose, so it can be swept.
+func (wal *WalletDB) sweepInputs(fromAddresses []string) ([]AddressBalancePair, error) {
+	var inputs []AddressBalancePair
+	seen := make(map[string]bool)
+	for _, addr := range fromAddresses {
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+
+		anp, list := wal.GetGUIAddress(addr)
+		if list != 1 || anp == nil {
+			return nil, fmt.Errorf("%s is not one of your factoid addresses", addr)
+		}
+		balance, err := getFactoidBalance(addr)
+		if err != nil {
+			return nil, err
+		}
+		if balance <= 0 {
+			continue
+		}
+
+		if anp.Frozen {
+			return nil, anp.CheckSpend(uint64(balance), uint64(balance))
+		}
+		policy := *anp
+		policy.Reserved = ""
+		if amt := policy.Spendable(uint64(balance)); amt > 0 {
+			inputs = append(inputs, AddressBalancePair{addr, amt})
+		}
+	}
+	return inputs, nil
+}
+
+// sweepOutput sends the total to toAddress, less the fee
+func (wal *WalletDB) sweepOutput(trans string, toAddress string, total uint64, rate uint64) (*ReturnTransStruct, error) {
+	err := wal.Wallet.AddOutput(trans, toAddress, total)
+	if err != nil {
+		return nil, err
+	}
+
+	t := wal.Wallet.GetTransactions()[trans]
+	if t == nil {
+		return nil, fmt.Errorf("Transaction not found")
+	}
+	fee, err := t.CalculateFee(rate)
+	if err != nil {
+		return nil, err
+	}
+	if fee >= total {
+		return nil, fmt.Errorf("The %s FCT to sweep cannot cover the fee of %s FCT",
+			fct.Amount(total),
+			fct.Amount(fee))
+	}
+
+	err = wal.Wallet.SubFee(trans, toAddress, rate)
+	if err != nil {
+		return nil, err
+	}
+
+	r := new(ReturnTransStruct)
+	r.Total = total - fee
+	r.Fee = fee
+	return r, nil
+}
@@ -0,0 +1,92 @@
+package wallet_test
+
+import (
+	"testing"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+func TestSweepChecks(t *testing.T) {
+	defer UseTempDataDir(t)()
+
+	wal, err := NewWalletDB(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+
+	to := "FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1Q"
+	_, _, err = wal.ConstructSweepTransaction("", nil, "EC2SDU3UhBwrBR2q7jbFAbxnqUW6s5Z2cX6cakdQ6U53uSLRoPLR")
+	if err == nil {
+		t.Error("Swept to an entry credit address")
+	}
+	_, _, err = wal.ConstructSweepTransaction("", []string{"FA3EPZYqodgyEGXNMbiZKE5TS2x2J9wF8J9MvPZb52iGR78xMgCb"}, to)
+	if err == nil {
+		t.Error("Swept an address not in the wallet")
+	}
+	_, _, err = wal.ConstructSweepFromKey("", "Fs1KWJrpLdfucvmYwN2nWrwepLn8ercpMbzXshd1g8zyhKXLVLWj", to)
+	if err == nil {
+		t.Error("Swept an invalid private key")
+	}
+	if len(wal.ListDrafts()) != 0 {
+		t.Error("A failed sweep left a draft")
+	}
+}
+
+func TestSweepOutput(t *testing.T) {
+	defer UseTempDataDir(t)()
+
+	wal, err := NewWalletDB(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+
+	from, err := wal.GenerateFactoidAddress("Swept")
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := "FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1Q"
+	var rate uint64 = 1000
+
+	d, err := wal.NewDraft("Sweep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total uint64 = 5e8
+	if err = wal.Wallet.AddInput(d.ID, from.Address, total); err != nil {
+		t.Fatal(err)
+	}
+	r, err := wal.SweepOutput(d.ID, to, total, rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trans := wal.Wallet.GetTransactions()[d.ID]
+	fee, err := trans.CalculateFee(rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Fee != fee || r.Total+r.Fee != total {
+		t.Errorf("Expected %d sent and a fee of %d, found %d and %d", total-fee, fee, r.Total, r.Fee)
+	}
+	outs := trans.GetOutputs()
+	if len(outs) != 1 || outs[0].GetAmount() != r.Total {
+		t.Fatalf("Expected one output of %d", r.Total)
+	}
+	if in, _ := trans.TotalInputs(); in-outs[0].GetAmount() != fee {
+		t.Errorf("The transaction pays %d, not the fee of %d", in-outs[0].GetAmount(), fee)
+	}
+
+	// Too little to pay the fee
+	dust, err := wal.NewDraft("Dust")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = wal.Wallet.AddInput(dust.ID, from.Address, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = wal.SweepOutput(dust.ID, to, 10, rate); err == nil {
+		t.Error("Swept less than the fee")
+	}
+}
@@ -0,0 +1,136 @@
+package wallet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/FactomProject/enterprise-wallet/address"
+)
+
+// The related transactions cache is expensive to build for wallets with many
+// transactions. It is saved into the GUI database so that a launch only has
+// to scan the FBlocks added since the last save.
+
+var (
+	relatedTransactionsBucket = []byte("related-transactions")
+	relatedTransactionsKey    = []byte("cache")
+)
+
+// relatedTransactionCache is the form of the related transaction cache saved in the GUI database
+type relatedTransactionCache struct {
+	Height       uint32               // Last FBlock height processed
+	Addresses    []string             // Addresses the cache was built with
+	SeedHash     string               // Hash of the seed the cache was built with
+	Transactions []DisplayTransaction // Sorted related transactions
+}
+
+func (c *relatedTransactionCache) MarshalBinary() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+func (c *relatedTransactionCache) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	err = json.Unmarshal(data, c)
+	return nil, err
+}
+
+func (c *relatedTransactionCache) UnmarshalBinary(data []byte) error {
+	_, err := c.UnmarshalBinaryData(data)
+	return err
+}
+
+// seedHash is used to detect a change of seed without keeping the seed around
+func (w *WalletDB) seedHash() string {
+	if w.IsWatchOnly() { // Has no seed
+		return ""
+	}
+	seed, err := w.Wallet.GetSeed()
+	if err != nil {
+		return ""
+	}
+	h := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(h[:])
+}
+
+// loadTransactionCache restores the related transactions cache from the GUI database.
+// If the addresses or seed it was built with no longer match the wallet, it is thrown away.
+func (w *WalletDB) loadTransactionCache() {
+	w.relatedTransactionLock.Lock()
+	defer w.relatedTransactionLock.Unlock()
+
+	data, err := w.GUIlDB.Get(relatedTransactionsBucket, relatedTransactionsKey, new(relatedTransactionCache))
+	if err != nil || data == nil {
+		return
+	}
+	c, ok := data.(*relatedTransactionCache)
+	if !ok {
+		return
+	}
+
+	current := make(map[string]address.AddressNamePair)
+	for _, a := range w.GetAllMyGUIAddresses() {
+		current[a.Address] = a
+	}
+
+	// An address that is no longer ours would leave unrelated transactions in the cache
+	for _, a := range c.Addresses {
+		if _, ok := current[a]; !ok {
+			w.clearTransactionCache()
+			return
+		}
+	}
+
+	// A locked wallet cannot read its seed, it is checked once unlocked
+	if !w.IsLocked() && c.SeedHash != w.seedHash() {
+		w.clearTransactionCache()
+		return
+	}
+	w.cacheSeedHash = c.SeedHash
+
+	w.cachedTransactions = c.Transactions
+	w.cachedHeight = c.Height
+	for _, t := range c.Transactions {
+		w.transMap[t.TxID] = t
+	}
+	// Names may have changed since the save, so use the current ones
+	for _, a := range c.Addresses {
+		w.addrMap[a] = current[a]
+	}
+	w.ActiveCachedTransactions = w.cachedTransactions
+}
+
+// saveTransactionCache must be called with the relatedTransactionLock held
+func (w *WalletDB) saveTransactionCache() error {
+	c := new(relatedTransactionCache)
+	c.Height = w.cachedHeight
+	c.SeedHash = w.seedHash()
+	if c.SeedHash == "" {
+		c.SeedHash = w.cacheSeedHash
+	}
+	w.cacheSeedHash = c.SeedHash
+	c.Transactions = w.cachedTransactions
+	for a := range w.addrMap {
+		c.Addresses = append(c.Addresses, a)
+	}
+
+	return w.GUIlDB.Put(relatedTransactionsBucket, relatedTransactionsKey, c)
+}
+
+// InvalidateTransactionCache drops the related transactions cache, both in memory
+// and in the GUI database. The next call to GetRelatedTransactions will rebuild it.
+func (w *WalletDB) InvalidateTransactionCache() {
+	w.relatedTransactionLock.Lock()
+	w.clearTransactionCache()
+	w.relatedTransactionLock.Unlock()
+}
+
+// clearTransactionCache must be called with the relatedTransactionLock held
+func (w *WalletDB) clearTransactionCache() {
+	w.cachedTransactions = nil
+	w.ActiveCachedTransactions = nil
+	w.cachedHeight = 0
+	w.cacheSeedHash = ""
+	w.transMap = make(map[string]DisplayTransaction)
+	w.addrMap = make(map[string]address.AddressNamePair)
+	w.GUIlDB.Delete(relatedTransactionsBucket, relatedTransactionsKey)
+}
@@ -1,14 +1,11 @@
 package wallet
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"sort"
 	"strconv"
 
+	"github.com/FactomProject/enterprise-wallet/fct"
 	"github.com/FactomProject/factom"
 	"github.com/FactomProject/factomd/common/factoid"
 	"github.com/FactomProject/factomd/common/interfaces"
@@ -42,12 +39,9 @@ func (slice AddressBalancePairs) Index(i int) AddressBalancePair {
 	return slice[i]
 }
 
-// CheckTransactionAndGetName doublechecks the transaction is the same (with amounts and addresses)
-// This is to confirm an already constructed transaction
-func (wal *WalletDB) CheckTransactionAndGetName(toAddresses []string, amounts []string, feeAddress string) (string, error) {
-	name := hashStringList(toAddresses)
-	name = name[:32] // name of transaction
-
+// CheckTransaction doublechecks the transaction is the same (with amounts and addresses)
+// This is to confirm an already constructed transaction, named by its draft ID
+func (wal *WalletDB) CheckTransaction(name string, toAddresses []string, amounts []string, feeAddress string) error {
 	trans := wal.Wallet.GetTransactions()
 	t, ok := trans[name]
 	if ok || t != nil {
@@ -62,12 +56,12 @@ func (wal *WalletDB) CheckTransactionAndGetName(toAddresses []string, amounts []
 			outs = append(outs, e)
 		}
 
-		if len(outs) != len(amounts) {
-			return name, fmt.Errorf("A change in the amount of outputs has been detected")
+		if len(outs) != len(amounts) || len(toAddresses) != len(amounts) {
+			return fmt.Errorf("A change in the amount of outputs has been detected")
 		}
 		amts, err := StringAmountsToUin64Amounts(toAddresses, amounts)
 		if err != nil {
-			return "", err
+			return err
 		}
 		for i, o := range outs {
 			amt := amts[i]
@@ -77,7 +71,7 @@ func (wal *WalletDB) CheckTransactionAndGetName(toAddresses []string, amounts []
 				compAddr = primitives.ConvertFctAddressToUserStr(o.GetAddress())
 				if o.GetAmount() != uint64(amt) {
 					if toAddresses[i] != feeAddress {
-						return name, fmt.Errorf("A change in the amount of an output has been detected")
+						return fmt.Errorf("A change in the amount of an output has been detected")
 					}
 				}
 			} else {
@@ -86,13 +80,13 @@ func (wal *WalletDB) CheckTransactionAndGetName(toAddresses []string, amounts []
 			}
 
 			if compAddr != toAddresses[i] {
-				return name, fmt.Errorf("A change in the address of an output has been detected")
+				return fmt.Errorf("A change in the address of an output has been detected")
 			}
 		}
 	} else {
-		return name, fmt.Errorf("No transaction found that matches the output addresses")
+		return ErrDraftNotFound
 	}
-	return name, nil
+	return nil
 }
 
 type ReturnTransStruct struct {
@@ -100,8 +94,8 @@ type ReturnTransStruct struct {
 	Fee   uint64 `json:"Fee"`
 }
 
-// StringAmountsToUin64Amounts assumes amounts to be a float for a factoid and a uint64 for an entry credit
-// Will multiply by 1e8 for factoids so "1" is 1 factoid. Not 1 factoshi. This is because this call usally
+// StringAmountsToUin64Amounts assumes amounts to be a decimal for a factoid and a uint64 for an entry credit
+// Factoid amounts are parsed by ParseAmount, so "1" is 1 factoid. Not 1 factoshi. This is because this call usally
 // comes from input from the user
 func StringAmountsToUin64Amounts(addresses []string, amounts []string) ([]uint64, error) {
 	var amts []uint64
@@ -113,11 +107,11 @@ func StringAmountsToUin64Amounts(addresses []string, amounts []string) ([]uint64
 			return nil, fmt.Errorf("Invalid address given")
 		}
 		if addresses[i][:2] == "FA" {
-			amt64, err := strconv.ParseFloat(a, 64)
+			amt, err := fct.ParseAmount(a)
 			if err != nil {
-				return nil, fmt.Errorf("Invalid amount given")
+				return nil, fmt.Errorf("Invalid amount given, %s", err.Error())
 			}
-			amts = append(amts, uint64(amt64*1e8))
+			amts = append(amts, uint64(amt))
 		} else {
 			amt64, err := strconv.ParseUint(a, 10, 64)
 			if err != nil {
@@ -131,7 +125,8 @@ func StringAmountsToUin64Amounts(addresses []string, amounts []string) ([]uint64
 }
 
 // CalculateNeededInput calculates how many factoids are needed to cover the outputs. Takes into consideration
-// the EC rate if EC is output
+// the EC rate if EC is output. Returns an error if the addresses that can be spent cannot cover it, frozen
+// addresses and minimum balances are left out.
 func (wal *WalletDB) CalculateNeededInput(toAddresses []string, toAmounts []string) (uint64, error) {
 	var toAmts []uint64
 	toAmts, err := StringAmountsToUin64Amounts(toAddresses, toAmounts)
@@ -139,7 +134,7 @@ func (wal *WalletDB) CalculateNeededInput(toAddresses []string, toAmounts []stri
 		return 0, err
 	}
 
-	rate, err := factom.GetRate()
+	rate, err := getRate()
 	if err != nil {
 		return 0, fmt.Errorf("Could not get the rate for converting entry credits. Factomd may be down or on a different port.\n")
 	}
@@ -158,12 +153,26 @@ func (wal *WalletDB) CalculateNeededInput(toAddresses []string, toAmounts []stri
 		}
 	}
 
+	list, err := wal.spendableBalances(true)
+	if err != nil {
+		return 0, err
+	}
+	var spendable uint64
+	for _, a := range list {
+		spendable += a.Balance
+	}
+	if spendable < total {
+		return 0, fmt.Errorf("%s FCT is needed, but only %s FCT can be spent. Frozen addresses and minimum balances are left out.",
+			fct.Amount(total),
+			fct.Amount(spendable))
+	}
+
 	return total, nil
 }
 
 // ConstructTransactionFromValuesStrings constructs a transaction if all inputs are already given
 // Amounts are parsed into a float or uint64 depending on factoid/ec
-func (wal *WalletDB) ConstructTransactionFromValuesStrings(toAddresses []string, toAmounts []string, fromAddresses []string, fromAmounts []string, feeAddress string, sign bool) (string, *ReturnTransStruct, error) {
+func (wal *WalletDB) ConstructTransactionFromValuesStrings(draftID string, toAddresses []string, toAmounts []string, fromAddresses []string, fromAmounts []string, feeAddress string, sign bool) (string, *ReturnTransStruct, error) {
 	if len(toAddresses) != len(toAmounts) {
 		return "", nil, fmt.Errorf("Lengths of output addresses to amounts does not match")
 	} else if len(fromAddresses) != len(fromAmounts) {
@@ -183,11 +192,13 @@ func (wal *WalletDB) ConstructTransactionFromValuesStrings(toAddresses []string,
 		return "", nil, err
 	}
 
-	return wal.ConstructTransactionFromValues(toAddresses, toAmts, fromAddresses, fromAmts, feeAddress, sign)
+	return wal.ConstructTransactionFromValues(draftID, toAddresses, toAmts, fromAddresses, fromAmts, feeAddress, sign)
 }
 
 // ConstructTransactionFromValues constructs a transaction from given input and output values. An error might contain the amount of input needed aswell if it is incorrect
-func (wal *WalletDB) ConstructTransactionFromValues(toAddresses []string, toAmounts []uint64, fromAddresses []string, fromAmounts []uint64, feeAddress string, sign bool) (string, *ReturnTransStruct, error) {
+// The transaction is put in the draft given, or a new draft if the ID is empty
+// If it is not signed, inputs may be from addresses the wallet does not hold, for other wallets to sign
+func (wal *WalletDB) ConstructTransactionFromValues(draftID string, toAddresses []string, toAmounts []uint64, fromAddresses []string, fromAmounts []uint64, feeAddress string, sign bool) (trans string, r *ReturnTransStruct, err error) {
 	if len(toAddresses) != len(toAmounts) {
 		return "", nil, fmt.Errorf("Lengths of output addresses to amounts does not match")
 	} else if len(fromAddresses) != len(fromAmounts) {
@@ -195,22 +206,23 @@ func (wal *WalletDB) ConstructTransactionFromValues(toAddresses []string, toAmou
 	} else if !(wal.IsValidAddress(feeAddress) && feeAddress[:2] == "FA") {
 		return "", nil, fmt.Errorf("Invalid address for fee")
 	}
-
-	// Add outputs, find total being sent
-	trans := hashStringList(toAddresses)
-	trans = trans[:32] // Name of transaction
-
-	transMap := wal.Wallet.GetTransactions()
-	if t, _ := transMap[trans]; t != nil {
-		wal.DeleteTransaction(trans)
+	if sign {
+		if err := wal.checkUnlocked(); err != nil {
+			return "", nil, err
+		}
+		if err := wal.checkSecrets(); err != nil {
+			return "", nil, err
+		}
 	}
 
-	err := wal.Wallet.NewTransaction(trans)
+	// Add outputs, find total being sent
+	trans, created, err := wal.openDraft(draftID)
 	if err != nil {
 		return trans, nil, err
 	}
+	defer func() { err = wal.closeDraft(trans, created, err) }()
 
-	rate, err := factom.GetRate()
+	rate, err := getRate()
 	if err != nil {
 		return trans, nil, err
 	}
@@ -253,8 +265,12 @@ func (wal *WalletDB) ConstructTransactionFromValues(toAddresses []string, toAmou
 			return trans, nil, fmt.Errorf("%s only has %s FCT, and cannot cover the %s FCT input."+
 				" If you are sure this balance is incorrect, make sure factomd is synced.",
 				address,
-				strconv.FormatFloat(float64(addBal)/1e8, 'f', -1, 64),
-				strconv.FormatFloat(float64(fromAmounts[i])/1e8, 'f', -1, 64))
+				fct.Amount(addBal),
+				fct.Amount(fromAmounts[i]))
+		}
+		err = wal.checkSpend(address, addBal, fromAmounts[i])
+		if err != nil {
+			return trans, nil, err
 		}
 
 		// for later use
@@ -263,16 +279,16 @@ func (wal *WalletDB) ConstructTransactionFromValues(toAddresses []string, toAmou
 			feeAddBal = addBal
 		}
 
-		err = wal.Wallet.AddInput(trans, address, fromAmounts[i])
+		err = wal.addInput(trans, address, fromAmounts[i], sign)
 		if err != nil {
 			return trans, nil, err
 		}
 	}
 
 	if total > totalIn {
-		return trans, nil, fmt.Errorf("The amount of input is not enough to cover the transaction. The needed input is: %f FCT.\n", float64(total)/1e8)
+		return trans, nil, fmt.Errorf("The amount of input is not enough to cover the transaction. The needed input is: %s FCT.\n", fct.Amount(total))
 	} else if total < totalIn {
-		return trans, nil, fmt.Errorf("The amount of input is too much for the transaction. The needed input is: %f FCT.\n", float64(total)/1e8)
+		return trans, nil, fmt.Errorf("The amount of input is too much for the transaction. The needed input is: %s FCT.\n", fct.Amount(total))
 	}
 
 	transStruct := wal.Wallet.GetTransactions()[trans]
@@ -309,8 +325,12 @@ func (wal *WalletDB) ConstructTransactionFromValues(toAddresses []string, toAmou
 				"cannot cover the fee. The total input from %s is %s FCT, but it only has %s FCT. Choose another "+
 				"input to cover the fee, or choose an output to cover the fee.",
 				fromAddresses[feeAddIndex],
-				strconv.FormatFloat(float64(feeAddBal)/1e8, 'f', -1, 64),
-				strconv.FormatFloat(float64(fromAmounts[feeAddIndex])/1e8, 'f', -1, 64))
+				fct.Amount(feeAddBal),
+				fct.Amount(fromAmounts[feeAddIndex]))
+		}
+		err = wal.checkSpend(feeAddress, feeAddBal, fee+fromAmounts[feeAddIndex])
+		if err != nil {
+			return trans, nil, err
 		}
 
 		err = wal.Wallet.AddFee(trans, feeAddress, rate)
@@ -326,31 +346,32 @@ func (wal *WalletDB) ConstructTransactionFromValues(toAddresses []string, toAmou
 		}
 	}
 
-	r := new(ReturnTransStruct)
+	r = new(ReturnTransStruct)
 	r.Total = total
 	r.Fee = fee
 
 	return trans, r, nil
 }
 
-func (wal *WalletDB) ConstructSendFactoidsStrings(toAddresses []string, amounts []string) (string, *ReturnTransStruct, error) {
+// ConstructSendFactoidsStrings constructs a transaction in a draft, choosing the inputs with the named
+// coin selector. No name is the DefaultCoinSelector, no draft ID makes a new draft.
+func (wal *WalletDB) ConstructSendFactoidsStrings(draftID string, toAddresses []string, amounts []string, coinSelection string) (string, *ReturnTransStruct, error) {
 	var amts []uint64
 	amts, err := StringAmountsToUin64Amounts(toAddresses, amounts)
 	if err != nil {
 		return "", nil, err
 	}
 
-	return wal.ConstructTransaction(toAddresses, amts)
-}
-
-func (wal *WalletDB) ConstructConvertEntryCreditsStrings(toAddresses []string, amounts []string) (string, *ReturnTransStruct, error) {
-	var amts []uint64
-	amts, err := StringAmountsToUin64Amounts(toAddresses, amounts)
+	selector, err := GetCoinSelector(coinSelection)
 	if err != nil {
 		return "", nil, err
 	}
+	return wal.ConstructTransactionWithSelector(draftID, toAddresses, amts, selector)
+}
 
-	return wal.ConstructTransaction(toAddresses, amts)
+// ConstructConvertEntryCreditsStrings is the same as ConstructSendFactoidsStrings
+func (wal *WalletDB) ConstructConvertEntryCreditsStrings(draftID string, toAddresses []string, amounts []string, coinSelection string) (string, *ReturnTransStruct, error) {
+	return wal.ConstructSendFactoidsStrings(draftID, toAddresses, amounts, coinSelection)
 }
 
 func (wal *WalletDB) ImportTransaction(name string, hex string) error {
@@ -366,14 +387,30 @@ func (wal *WalletDB) ExportTransaction(name string) (string, error) {
 	return req.String(), nil
 }
 
+// SignTransaction signs a transaction with the keys in the wallet
+func (wal *WalletDB) SignTransaction(trans string) error {
+	if err := wal.checkUnlocked(); err != nil {
+		return err
+	}
+	if err := wal.checkSecrets(); err != nil {
+		return err
+	}
+	err := wal.Wallet.SignTransaction(trans, true)
+	if err != nil {
+		return err
+	}
+	return wal.saveDraft(trans)
+}
+
 func (wal *WalletDB) DeleteTransaction(trans string) error {
 	return wal.Wallet.DeleteTransaction(trans)
 }
 
 // ConstructTransaction
-// Transaction name is hash of all the addresses. More than 1 transaction to
-// an address(es) should not be open, but combined.
+// The transaction is put in a new draft, and named by the draft ID. Any number
+// of transactions can be open at once.
 // The output is determined by the output address for ECOutput or FCTOutput
+// The inputs are chosen by the DefaultCoinSelector
 // Parameters:
 //		toAddresses = list of output addresses
 //		amounts = list of amounts to each output, indicies must match
@@ -381,98 +418,87 @@ func (wal *WalletDB) DeleteTransaction(trans string) error {
 //		Transaction Name, Transaction Info, error
 
 func (wal *WalletDB) ConstructTransaction(toAddresses []string, amounts []uint64) (string, *ReturnTransStruct, error) {
+	selector, err := GetCoinSelector(DefaultCoinSelector)
+	if err != nil {
+		return "", nil, err
+	}
+	return wal.ConstructTransactionWithSelector("", toAddresses, amounts, selector)
+}
+
+// ConstructTransactionWithSelector is ConstructTransaction, with the inputs chosen by
+// the selector. The transaction is put in the draft given, or a new draft if the ID is empty.
+func (wal *WalletDB) ConstructTransactionWithSelector(draftID string, toAddresses []string, amounts []uint64, selector CoinSelector) (string, *ReturnTransStruct, error) {
+	return wal.constructTransaction(draftID, toAddresses, amounts, selector, nil)
+}
+
+// constructTransaction is ConstructTransactionWithSelector. If fromAddresses is not empty,
+// the inputs are only chosen from them.
+func (wal *WalletDB) constructTransaction(draftID string, toAddresses []string, amounts []uint64, selector CoinSelector, fromAddresses []string) (trans string, r *ReturnTransStruct, err error) {
 	if len(toAddresses) != len(amounts) {
 		return "", nil, fmt.Errorf("Lengths of address to amount does not match")
 	} else if len(toAddresses) == 0 {
 		return "", nil, fmt.Errorf("No recipient given")
 	}
+	if err := wal.checkUnlocked(); err != nil {
+		return "", nil, err
+	}
 
-	trans := hashStringList(toAddresses)
-	trans = trans[:32] // Name of transaction
+	rate, err := getRate()
+	if err != nil {
+		return "", nil, err
+	}
 
-	// If the transaction exists, we will overwrite it
-	transMap := wal.Wallet.GetTransactions()
-	if t, _ := transMap[trans]; t != nil {
-		wal.DeleteTransaction(trans)
+	// Every address with a balance can pay, unless its spending policy says otherwise
+	list, err := wal.spendableBalances(false)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(fromAddresses) > 0 {
+		list = onlyAddresses(list, fromAddresses)
 	}
 
-	err := wal.Wallet.NewTransaction(trans)
+	// If the draft exists, we will overwrite it
+	trans, created, err := wal.openDraft(draftID)
 	if err != nil {
 		return trans, nil, err
 	}
+	defer func() { err = wal.closeDraft(trans, created, err) }()
 
-	rate, err := factom.GetRate()
+	total, err := wal.addOutputs(trans, toAddresses, amounts, rate)
 	if err != nil {
 		return trans, nil, err
 	}
 
-	var total uint64 = 0
-	var amt uint64
-	for i, address := range toAddresses {
-		if !wal.IsValidAddress(address) {
-			return trans, nil, fmt.Errorf("Invalid address given")
-		}
-		if toAddresses[i][:2] == "FA" {
-			amt = amounts[i]
-			err = wal.Wallet.AddOutput(trans, address, amt)
-		} else if toAddresses[i][:2] == "EC" {
-			amt = rate * amounts[i]
-			err = wal.Wallet.AddECOutput(trans, address, amt)
-		} else {
-			return trans, nil, fmt.Errorf(address + " is not a public address")
-		}
-		if err != nil {
-			return trans, nil, err
-		}
-		total += amt
+	inputs, err := selector.Select(list, total, feeFunc(toAddresses, amounts, list, rate))
+	if err != nil {
+		return trans, nil, err
+	}
+	if len(inputs) == 0 {
+		return trans, nil, ErrNotEnoughFactoids
 	}
 
-	// Decide what addresses to pay with
-	// Pay with largest first
-	faAddresses, err := wal.Wallet.GetAllFCTAddresses()
+	// The balances the inputs were chosen with, to check the one paying the fee can
+	balances := make(map[string]uint64)
+	for _, in := range inputs {
+		balances[in.Address] = in.Balance
+	}
+	paid, err := payInputs(inputs, total)
 	if err != nil {
 		return trans, nil, err
 	}
-
-	var list []AddressBalancePair
-
-	for _, address := range faAddresses {
-		addr := address.String()
-		balance, err := factom.GetFactoidBalance(addr)
+	// A watch-only wallet leaves it unsigned
+	sign := !wal.IsWatchOnly()
+	for _, in := range paid {
+		err = wal.addInput(trans, in.Address, in.Balance, sign)
 		if err != nil {
 			return trans, nil, err
 		}
-		list = append(list, AddressBalancePair{addr, uint64(balance)})
 	}
 
-	// Sort to get largest balances first
-	sort.Sort(sort.Reverse(AddressBalancePairs(list)))
-
-	totalLeft := total
-	var i int
-	// While factoids still needed to cover transaction, go through addresses
-	for i = 0; totalLeft > 0; {
-		if i >= len(list) {
-			return trans, nil, fmt.Errorf("Not enough factoids to cover the transaction")
-		}
-		if list[i].Balance > totalLeft {
-			err := wal.Wallet.AddInput(trans, list[i].Address, totalLeft)
-			if err != nil {
-				return trans, nil, err
-			}
-			list[i].Balance -= totalLeft
-			totalLeft = 0
-		} else {
-			if list[i].Balance > 0 {
-				err := wal.Wallet.AddInput(trans, list[i].Address, list[i].Balance)
-				if err != nil {
-					return trans, nil, err
-				}
-				totalLeft -= list[i].Balance
-				list[i].Balance = 0
-			}
-			i++
-		}
+	last := paid[len(paid)-1]
+	err = wal.Wallet.AddFee(trans, last.Address, rate)
+	if err != nil {
+		return trans, nil, err
 	}
 
 	transStruct := wal.Wallet.GetTransactions()[trans]
@@ -485,70 +511,159 @@ func (wal *WalletDB) ConstructTransaction(toAddresses []string, amounts []uint64
 		return trans, nil, err
 	}
 
-	// The last addresse we used to pay, we need to check if it can cover the fee
-	if list[i].Balance < fee { // If it cannot, lets find one that can
-		i, err = checkForAddressForFee(list, transStruct, i, rate)
-		if i == -1 || err != nil { // We don't have an address that can pay for the fee.
-			return trans, nil, fmt.Errorf("Not enough factoids to cover the transaction")
-		} else {
-			err := wal.Wallet.AddInput(trans, list[i].Address, 0)
-			if err != nil {
-				return trans, nil, err
-			}
+	// The selector was given the fee of a transaction like this one, but check the
+	// fee it ended up with can be paid
+	for _, in := range transStruct.GetInputs() {
+		if primitives.ConvertFctAddressToUserStr(in.GetAddress()) == last.Address && in.GetAmount() > balances[last.Address] {
+			return trans, nil, ErrNotEnoughFactoids
 		}
 	}
 
-	err = wal.Wallet.AddFee(trans, list[i].Address, rate)
-	if err != nil {
-		return trans, nil, err
-	}
-
-	err = wal.Wallet.SignTransaction(trans, true)
-	if err != nil {
-		return trans, nil, err
+	if sign {
+		err = wal.Wallet.SignTransaction(trans, true)
+		if err != nil {
+			return trans, nil, err
+		}
 	}
 
-	r := new(ReturnTransStruct)
+	r = new(ReturnTransStruct)
 	r.Total = total
 	r.Fee = fee
 
 	return trans, r, nil
 }
 
-// checkForAddressForFee: A lot of parameters. This function is reused for EC and FCT transactions. All it does it,
-// if the last address input cannot cover the fee this finds an address that can.
-//	Parameters:
-//		list = List of addresses
-//		transStruct = The transaction structure that can calculate a fee
-//		i = Last address in the list we have inputted into the transaction
-//		rate = current fee rate
-func checkForAddressForFee(list []AddressBalancePair, transStruct *factoid.Transaction, i int, rate uint64) (indexToPay int, err error) {
-	if i >= len(list) { // Out of addresses? Sorry, no transaction
-		return -1, fmt.Errorf("Not enough factoids to cover the transaction")
+// onlyAddresses returns the addresses of the list that are in addresses
+func onlyAddresses(list []AddressBalancePair, addresses []string) []AddressBalancePair {
+	keep := make(map[string]bool)
+	for _, a := range addresses {
+		keep[a] = true
 	}
 
-	// Ok, how much would another address input increase the fee to?
-	fakeAddr := factoid.NewAddress(primitives.Sha([]byte("A fake address")).Bytes())
-	transStruct.AddInput(fakeAddr, 0)          // We do not use this address, just need a new fee calc
-	fee, err := transStruct.CalculateFee(rate) // We have the rate from earlier
-	if err != nil {
-		return -1, err
+	var only []AddressBalancePair
+	for _, a := range list {
+		if keep[a.Address] {
+			only = append(only, a)
+		}
 	}
+	return only
+}
+
+// addOutputs adds the outputs to a transaction, and returns the factoshis they need.
+// Entry credit amounts are converted at the rate.
+func (wal *WalletDB) addOutputs(trans string, toAddresses []string, amounts []uint64, rate uint64) (uint64, error) {
+	var total uint64 = 0
+	var amt uint64
+	var err error
+	for i, address := range toAddresses {
+		if !wal.IsValidAddress(address) {
+			return 0, fmt.Errorf("Invalid address given")
+		}
+		if toAddresses[i][:2] == "FA" {
+			amt = amounts[i]
+			err = wal.Wallet.AddOutput(trans, address, amt)
+		} else if toAddresses[i][:2] == "EC" {
+			amt = rate * amounts[i]
+			err = wal.Wallet.AddECOutput(trans, address, amt)
+		} else {
+			return 0, fmt.Errorf("%s is not a public address", address)
+		}
+		if err != nil {
+			return 0, err
+		}
+		total += amt
+	}
+	return total, nil
+}
 
-	// So that is the fee, lets check if we have anything
-	for list[i].Balance < fee {
-		i++
-		if i >= len(list) {
-			return -1, fmt.Errorf("Not enough factoids to cover the transaction")
+// payInputs returns how much each of the inputs chosen pays towards the total. The
+// largest pays the fee, so it goes last and only pays what is left.
+func payInputs(inputs []AddressBalancePair, total uint64) ([]AddressBalancePair, error) {
+	payer := 0
+	for i := range inputs {
+		if inputs[i].Balance > inputs[payer].Balance {
+			payer = i
 		}
 	}
+	inputs[payer], inputs[len(inputs)-1] = inputs[len(inputs)-1], inputs[payer]
 
-	// Sweet, we got one. Lets return the index of it
-	return i, nil
+	var paid []AddressBalancePair
+	left := total
+	for _, in := range inputs {
+		amt := in.Balance
+		if amt > left {
+			amt = left
+		}
+		paid = append(paid, AddressBalancePair{in.Address, amt})
+		left -= amt
+	}
+	if left > 0 {
+		return nil, ErrNotEnoughFactoids
+	}
+	return paid, nil
+}
+
+// feeFunc calculates fees by putting together a transaction with the same outputs,
+// and as many of the candidates as inputs. Every input is the same size, so which
+// candidates are used does not matter.
+func feeFunc(toAddresses []string, amounts []uint64, candidates []AddressBalancePair, rate uint64) FeeFunc {
+	fees := make(map[int]uint64)
+
+	return func(inputs int) (uint64, error) {
+		if fee, ok := fees[inputs]; ok {
+			return fee, nil
+		}
+		if inputs > len(candidates) {
+			return 0, ErrNotEnoughFactoids
+		}
+
+		t, err := newFeeTransaction(toAddresses, amounts, candidates[:inputs], rate)
+		if err != nil {
+			return 0, err
+		}
+		fee, err := t.CalculateFee(rate)
+		if err != nil {
+			return 0, err
+		}
+		fees[inputs] = fee
+		return fee, nil
+	}
+}
+
+// newFeeTransaction puts together a transaction to work out the fee of one like it. It is
+// not in the wallet and cannot be signed, an input only needs its address and the size of
+// its RCD. Entry credit amounts are converted at the rate.
+func newFeeTransaction(toAddresses []string, amounts []uint64, inputs []AddressBalancePair, rate uint64) (*factoid.Transaction, error) {
+	if len(toAddresses) != len(amounts) {
+		return nil, fmt.Errorf("Lengths of address to amount does not match")
+	}
+
+	t := new(factoid.Transaction)
+	for i, addr := range toAddresses {
+		if !factom.IsValidAddress(addr) {
+			return nil, fmt.Errorf("%s is not a valid address", addr)
+		}
+		switch addr[:2] {
+		case "FA":
+			t.AddOutput(factoid.NewAddress(primitives.ConvertUserStrToAddress(addr)), amounts[i])
+		case "EC":
+			t.AddECOutput(factoid.NewAddress(primitives.ConvertUserStrToAddress(addr)), amounts[i]*rate)
+		default:
+			return nil, fmt.Errorf("%s is not a public address", addr)
+		}
+	}
+	for _, in := range inputs {
+		if !factom.IsValidAddress(in.Address) || in.Address[:2] != "FA" {
+			return nil, fmt.Errorf("%s is not a factoid address", in.Address)
+		}
+		t.AddInput(factoid.NewAddress(primitives.ConvertUserStrToAddress(in.Address)), in.Balance)
+		t.AddRCD(placeholderRCD())
+	}
+	return t, nil
 }
 
 func (wal *WalletDB) GetAddressBalance(address string) (uint64, error) {
-	bal, err := factom.GetFactoidBalance(address)
+	bal, err := getFactoidBalance(address)
 	return uint64(bal), err
 }
 
@@ -557,16 +672,42 @@ type SendTransactionResp struct {
 	Txid    string `json:"txid"`
 }
 
+// SendTransaction sends a transaction to factomd. It is tracked until it is in a block,
+// see Broadcast.
 func (wal *WalletDB) SendTransaction(trans string) (string, error) {
 	req, err := wal.Wallet.ComposeTransaction(trans)
 	if err != nil {
 		return "", err
 	}
 
-	respJson, err := factom.SendFactomdRequest(req)
+	txid, err := submitTransaction(req)
+	if err != nil {
+		return "", err
+	}
+
+	if t := wal.Wallet.GetTransactions()[trans]; t != nil {
+		err = wal.recordBroadcast(txid, t)
+		if err != nil {
+			fmt.Printf("Could not record the transaction %s was sent: %s\n", txid, err.Error())
+		}
+	}
+
+	// It is sent, it is no longer a draft
+	if wal.IsDraft(trans) {
+		wal.DeleteDraft(trans)
+	}
+	return txid, nil
+}
+
+// submitTransaction sends a factoid-submit request, and returns the txid factomd gives
+func submitTransaction(req *factom.JSON2Request) (string, error) {
+	respJson, err := sendFactomdRequest(req)
 	if err != nil {
 		return "", err
 	}
+	if respJson.Error != nil {
+		return "", respJson.Error
+	}
 
 	resp := new(SendTransactionResp)
 	result, err := respJson.Result.MarshalJSON()
@@ -596,14 +737,3 @@ func (wal *WalletDB) ECAddressToHumanReadable(add interfaces.IAddress) string {
 func ECAddressToHumanReadable(add interfaces.IAddress) string {
 	return primitives.ConvertECAddressToUserStr(add)
 }
-
-func hashStringList(list []string) string {
-	buf := new(bytes.Buffer)
-	for _, item := range list {
-		data := sha256.Sum256([]byte(item))
-		buf.Write(data[:])
-	}
-
-	trans := sha256.Sum256(buf.Next(buf.Len()))
-	return hex.EncodeToString(trans[:])
-}
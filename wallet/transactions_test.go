@@ -2,6 +2,8 @@ package wallet_test
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 	"testing"
 	//"time"
 
@@ -68,11 +70,9 @@ func TestSendFactoids(t *testing.T) {
 		amtsStrs = append(amtsStrs, fmt.Sprintf("%d", a/1e8))
 	}
 
-	nameComp, err := TestWallet.CheckTransactionAndGetName(recs, amtsStrs, "")
+	err = TestWallet.CheckTransaction(trans, recs, amtsStrs, "")
 	if err != nil {
 		t.Fatal(err)
-	} else if trans != nameComp {
-		t.Fatal("Names do not match")
 	}
 
 	_, err = TestWallet.SendTransaction(trans)
@@ -81,7 +81,7 @@ func TestSendFactoids(t *testing.T) {
 	}
 
 	// Test string versions
-	name, ret, err := TestWallet.ConstructSendFactoidsStrings(recs, amtsStrs)
+	name, ret, err := TestWallet.ConstructSendFactoidsStrings("", recs, amtsStrs, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -150,11 +150,9 @@ func TestConvertToEC(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	nameComp, err := TestWallet.CheckTransactionAndGetName(recs, amtsStrs, "")
+	err = TestWallet.CheckTransaction(trans, recs, amtsStrs, "")
 	if err != nil {
 		t.Fatal(err)
-	} else if trans != nameComp {
-		t.Fatal("Names do not match")
 	}
 
 	_, err = TestWallet.SendTransaction(trans)
@@ -163,7 +161,7 @@ func TestConvertToEC(t *testing.T) {
 	}
 
 	// Test string versions
-	name, ret, err := TestWallet.ConstructConvertEntryCreditsStrings(recs, amtsStrs)
+	name, ret, err := TestWallet.ConstructConvertEntryCreditsStrings("", recs, amtsStrs, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -215,3 +213,67 @@ func LoadTestWallet(port int) error {
 
 	return nil
 }
+
+// UseTempDataDir points DATA_DIR at a new directory, for a test that needs wallets of its
+// own. The GUI and wallet databases are files, so they outlive a wallet that is closed and
+// opened again. The function returned puts everything back.
+func UseTempDataDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "wallet-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldDir := DATA_DIR
+	DATA_DIR = dir
+	GUI_DB, WALLET_DB, TX_DB = BOLT, BOLT, MAP
+
+	return func() {
+		GUI_DB, WALLET_DB, TX_DB = MAP, MAP, MAP
+		DATA_DIR = oldDir
+		os.RemoveAll(dir)
+	}
+}
+
+func TestConstructTransaction(t *testing.T) {
+	defer UseTempDataDir(t)()
+
+	wal, err := NewWalletDB(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+
+	sand, err := wal.AddAddress("Sand", "Fs3E9gV6DXsYzf7Fqx1fVBQPQXV695eP3k5XbmHEZVRLkMdD9qCK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spare, err := wal.AddAddress("Spare", "Fs1uHDWjYANSxXUtbdkLVkhHboaPRz1tADqs7iB16kQq5VTCvKZS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	external := "FA3HRq8jFUhzN9c8iKTBBfXyNyijSnov1ZLJtJMKTXFQNmncWZoE"
+	defer StubFactomdBalances(1000, map[string]int64{sand.Address: 5e8, spare.Address: 2e8})()
+
+	// Both inputs are needed, and the larger pays the fee
+	trans, r, err := wal.ConstructTransaction([]string{external}, []uint64{6e8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Total != 6e8 || r.Fee == 0 {
+		t.Errorf("Expected 600000000 sent with a fee, found %d and %d", r.Total, r.Fee)
+	}
+	var in uint64
+	for _, i := range wal.Wallet.GetTransactions()[trans].GetInputs() {
+		in += i.GetAmount()
+	}
+	if in != r.Total+r.Fee {
+		t.Errorf("The inputs give %d, expected %d", in, r.Total+r.Fee)
+	}
+	if err = wal.ValidateSignatures(trans); err != nil {
+		t.Error(err)
+	}
+
+	// Everything is sent, nothing is left for the fee
+	if _, _, err = wal.ConstructTransaction([]string{external}, []uint64{7e8}); err != ErrNotEnoughFactoids {
+		t.Errorf("Expected not enough factoids, found %v", err)
+	}
+}
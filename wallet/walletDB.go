@@ -28,14 +28,14 @@ import (
 	// "github.com/FactomProject/factom/wallet/wsapi"
 	"encoding/json"
 	"github.com/FactomProject/factomd/common/interfaces"
-	"github.com/FactomProject/factomd/database/mapdb"
 )
 
-// List of int to db type
+// Names of the built in database backends. Any name registered in the
+// database package can be used.
 const (
-	MAP int = iota
-	LDB
-	BOLT
+	MAP  = "Map"
+	LDB  = "LDB"
+	BOLT = "Bolt"
 )
 
 // Default settings
@@ -60,13 +60,38 @@ type WalletDB struct {
 	TransactionDB *wallet.TXDatabaseOverlay // Used to display transactions
 
 	// Used to cache related transactions
-	// This is rebuilt upon every launch
+	// Saved in the GUI database, only new FBlocks are scanned upon launch
 	relatedTransactionLock   sync.RWMutex                       // For all variables associated with related transaction caching
 	cachedTransactions       []DisplayTransaction               // All sorted transactions already found
 	ActiveCachedTransactions []DisplayTransaction               // Active cache being used.
 	cachedHeight             uint32                             // Last FBlock height used
 	transMap                 map[string]DisplayTransaction      // Prevent duplicate transactions
 	addrMap                  map[string]address.AddressNamePair // Find addresses quick, All addresses already searched for up to last FBlock
+	cacheSeedHash            string                             // Seed hash the cache was built with, kept for when locked
+
+	// Only used if the wallet database is encrypted
+	lock walletLock
+
+	snapshots snapshotter
+
+	// Transactions that have not been sent, by ID
+	drafts    map[string]*Draft
+	draftLock sync.Mutex
+
+	// Batches that have been constructed but not sent, by ID
+	batches   map[string]*Batch
+	batchLock sync.Mutex
+
+	// Scheduled payments are read and saved under the lock, the scheduler makes them
+	scheduleLock sync.Mutex
+	scheduler    scheduler
+
+	// Sent transactions are read and saved under the lock, the tracker asks factomd about them
+	broadcastLock    sync.Mutex
+	broadcastTracker broadcastTracker
+
+	// The named wallet the databases belong to
+	Profile *Profile
 }
 
 // LoadWalletDB is the same as New
@@ -74,22 +99,49 @@ func LoadWalletDB(v1Import bool) (*WalletDB, error) {
 	return NewWalletDB(v1Import)
 }
 
+// NewWalletDB opens the databases of the default profile
 func NewWalletDB(v1Import bool) (*WalletDB, error) {
+	return NewProfileWalletDB(&Profile{Name: DefaultProfile}, v1Import)
+}
+
+// NewProfileWalletDB opens the databases of a profile, making any that do not exist.
+// Only the default profile imports an M1 wallet.
+func NewProfileWalletDB(p *Profile, v1Import bool) (_ *WalletDB, err error) {
 	w := new(WalletDB)
+	w.Profile = p
+	dir := p.Dir()
 
-	var db interfaces.IDatabase
-	var err error
-	switch GUI_DB { // Decides type of wallet DB
-	case MAP:
-		db, err = database.NewMapDB()
-	case LDB:
-		db, err = database.NewOrOpenLevelDBWallet(GetHomeDir() + guiLDBPath)
-	case BOLT:
-		db, err = database.NewOrOpenBoltDBWallet(GetHomeDir() + guiBoltPath)
+	// Close whatever was opened if it fails, or the files stay locked and the profile
+	// cannot be opened again
+	defer func() {
+		if err != nil {
+			w.closeOpened()
+		}
+	}()
+
+	guiBackend, err := database.GetBackend(GUI_DB)
+	if err != nil {
+		return nil, err
+	}
+	walletBackend, err := database.GetBackend(WALLET_DB)
+	if err != nil {
+		return nil, err
 	}
+	txBackend, err := database.GetBackend(TX_DB)
 	if err != nil {
 		return nil, err
 	}
+	if err = guiBackend.CanHold(database.GUIDB); err != nil {
+		return nil, err
+	}
+	if err = walletBackend.CanHold(database.WalletDB); err != nil {
+		return nil, err
+	}
+
+	db, err := guiBackend.Open(guiBackend.Path(dir, database.GUIDB))
+	if err != nil {
+		return nil, openError(dir, database.GUIDB, guiBackend, err)
+	}
 
 	w.GUIlDB = db
 
@@ -103,97 +155,167 @@ func NewWalletDB(v1Import bool) (*WalletDB, error) {
 		}
 	} else {
 		w.guiWallet = data.(*WalletStruct)
+
+		// It may be in an older format, rewrite it in the current one
+		err = w.Save()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	var wal *wallet.Wallet
 
-	switch v1Import {
-	case true:
-		if WALLET_DB == MAP {
-			// Let fallthrough
-		} else {
-			m2Path := ""
-			// If true, and there is no M2 file, we will check for M1 file before making a new
-			// If a map, then we ignore and do the else
-			switch WALLET_DB { // Decides type of wallet DB
-			case LDB:
-				m2Path = GetHomeDir() + walletLDBPath
-				_, err = os.Stat(GetHomeDir() + walletLDBPath)
-			case BOLT:
-				m2Path = GetHomeDir() + walletBoltPath
-				_, err = os.Stat(GetHomeDir() + walletBoltPath)
+	// If there is no M2 file, we will check for M1 file before making a new
+	// If in memory, then we ignore and open as normal
+	if v1Import && !walletBackend.InMemory && p.Name == DefaultProfile {
+		m2Path := walletBackend.Path(dir, database.WalletDB)
+		_, err = os.Stat(m2Path)
+		if err != nil { // No M2 file, lets grab from M1
+			m1Path := ""
+			if WalletBoltV1Path == "/.factom/factoid_wallet_bolt.db" {
+				m1Path = GetHomeDir() + WalletBoltV1Path
+			} else {
+				m1Path = WalletBoltV1Path
 			}
-			if err != nil { // No M2 file, lets grab from M1
-				m1Path := ""
-				if WalletBoltV1Path == "/.factom/factoid_wallet_bolt.db" {
-					m1Path = GetHomeDir() + WalletBoltV1Path
-				} else {
-					m1Path = WalletBoltV1Path
-				}
-				_, err = os.Stat(m1Path)
-				if err != nil { // No M1 file, lets go as normal
-					// Let fallthrough
-				} else { // M1 file found, no M2 file. Let's import
-					fmt.Printf("Importing from M1 Wallet at %s....\n", m1Path)
-					wal, err = wallet.ImportV1Wallet(m1Path, m2Path)
-					break // We got a wal file, let's break
+			_, err = os.Stat(m1Path)
+			if err == nil { // M1 file found, no M2 file. Let's import
+				fmt.Printf("Importing from M1 Wallet at %s....\n", m1Path)
+				wal, err = wallet.ImportV1Wallet(m1Path, m2Path)
+				if err != nil {
+					return nil, err
 				}
-			} else { // There is an M2 file, we go as normal
-				// Let falltrhough
 			}
 		}
-		fallthrough
-	case false:
-		switch WALLET_DB {
-		case MAP:
-			wal, err = wallet.NewMapDBWallet()
-		case LDB:
-			wal, err = wallet.NewOrOpenLevelDBWallet(GetHomeDir() + walletLDBPath)
-		case BOLT:
-			wal, err = wallet.NewOrOpenBoltDBWallet(GetHomeDir() + walletBoltPath)
-		}
 	}
-	if err != nil {
-		return nil, err
+
+	if wal == nil {
+		wal, w.lock.encryptedDB, err = openWallet(walletBackend, dir, p.WatchOnly)
+		if err != nil {
+			return nil, openError(dir, database.WalletDB, walletBackend, err)
+		}
 	}
 
 	w.Wallet = wal
 
-	var txdb *wallet.TXDatabaseOverlay
-	switch TX_DB {
-	case MAP:
-		txdb = wallet.NewTXOverlay(new(mapdb.MapDB))
-		err = nil
-	case LDB:
-		txdb, err = wallet.NewTXLevelDB(GetHomeDir() + txdbLDBPath)
-	case BOLT:
-		txdb, err = wallet.NewTXBoltDB(GetHomeDir() + txdbBoltPath)
-	}
-
+	txdb, err := txBackend.Open(txBackend.Path(p.TXDir(), database.TXDB))
 	if err != nil {
 		return nil, fmt.Errorf("Could not add transaction database to wallet: %s\n", err.Error())
 	}
+	if txBackend.TXOnly && !database.IsSharedCacheWriter(txdb) {
+		fmt.Println("Another wallet is syncing the shared transaction database, this one only reads it")
+	}
 
-	w.Wallet.AddTXDB(txdb)
+	w.Wallet.AddTXDB(wallet.NewTXOverlay(txdb))
 
 	w.TransactionDB = w.Wallet.TXDB()
 	if w.TransactionDB != nil { // Update DB
 		//w.TransactionDB.GetAllTXs()
 	}
 
+	w.transMap = make(map[string]DisplayTransaction)
+	w.addrMap = make(map[string]address.AddressNamePair)
+	w.cachedHeight = 0
+
+	// Finish anything the last run did not
+	err = w.recoverJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.loadDrafts()
+	if err != nil {
+		return nil, err
+	}
+
 	err = w.UpdateGUIDB()
 	if err != nil {
 		return nil, err
 	}
 
-	w.transMap = make(map[string]DisplayTransaction)
-	w.addrMap = make(map[string]address.AddressNamePair)
-	w.cachedHeight = 0
+	// Must come after the GUI is updated, so the cache is checked against the current addresses
+	w.loadTransactionCache()
 	w.ActiveCachedTransactions = w.cachedTransactions
 
+	// Snapshots of in memory databases would never be used
+	w.snapshots.auto = SNAPSHOT_RETENTION > 0 && !(guiBackend.InMemory && walletBackend.InMemory)
+	w.startSnapshots()
+
 	return w, nil
 }
 
+// closeOpened closes the databases opened by NewProfileWalletDB before it failed
+func (w *WalletDB) closeOpened() {
+	if w.Wallet != nil {
+		w.Wallet.Close() // Closes the transaction database too, once it is added
+	}
+	if w.GUIlDB != nil {
+		w.GUIlDB.Close()
+	}
+}
+
+// openWallet opens the wallet database from any backend. The factom library only
+// knows how to open its own types, so the wallet is made in memory and then
+// moved on top of the opened database.
+func openWallet(b *database.Backend, dir string, watchOnly bool) (*wallet.Wallet, *database.EncryptedDB, error) {
+	db, err := b.Open(b.Path(dir, database.WalletDB))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wal, err := wallet.NewMapDBWallet()
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	wal.DBO.DB.Close()
+
+	encrypted, err := database.CheckEncrypted(db)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	// The seed of an encrypted wallet cannot be read until it is unlocked
+	if encrypted {
+		enc, err := database.OpenEncryptedDB(db)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		wal.DBO.DB = enc
+		return wal, enc, nil
+	}
+
+	wal.DBO.DB = db
+
+	// A watch-only wallet holds no secrets, so it never gets a seed
+	if watchOnly {
+		return wal, nil, nil
+	}
+
+	// A new wallet needs a seed. Only make one if there is none, a seed that cannot be read
+	// must never be written over.
+	seed, err := wal.GetDBSeed()
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("Could not read the seed of the wallet: %s", err.Error())
+	}
+	if seed == nil {
+		seed, err = wallet.NewRandomSeed()
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		err = wal.InsertDBSeed(seed)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+	}
+
+	return wal, nil, nil
+}
+
 // DisplayTransactions is used for sorting
 type DisplayTransactions []DisplayTransaction
 
@@ -304,6 +426,12 @@ func (w *WalletDB) NewDisplayTransaction(t interfaces.ITransaction) (*DisplayTra
 }
 
 func (w *WalletDB) ExportSeed() (string, error) {
+	if err := w.checkUnlocked(); err != nil {
+		return "", err
+	}
+	if err := w.checkSecrets(); err != nil {
+		return "", err
+	}
 	return w.Wallet.GetSeed()
 }
 
@@ -340,6 +468,9 @@ func (w *WalletDB) GetStage() int {
 // and sorts them by time.Time. If a new address is added, this will grab all transactions
 // from that new address and insert them.
 func (w *WalletDB) GetRelatedTransactions() (dt []DisplayTransaction, err error) {
+	if OFFLINE { // The transactions come from factomd
+		return nil, ErrOffline
+	}
 	if PROCESSING_RELATED_TRANSACTIONS { // Already working on it
 		return
 	}
@@ -553,6 +684,14 @@ func (w *WalletDB) GetRelatedTransactions() (dt []DisplayTransaction, err error)
 		fmt.Printf("Finishing up sync....\n")
 	}
 
+	// Only save if something changed, the cache can be large
+	if oldHeight != w.cachedHeight || len(newTransactions) > 0 || len(newAddrs) > 0 {
+		err = w.saveTransactionCache()
+		if err != nil {
+			fmt.Printf("Could not save the transaction cache: %s\n", err.Error())
+		}
+	}
+
 	// The edge case of no transactions. If you have no related transactions, we still need to signal we
 	// are completely loaded. So we will add a blank transaction with an "empty" txid, which is impossible to get otherwise.
 	if len(w.cachedTransactions) == 0 {
@@ -591,6 +730,9 @@ func (w *WalletDB) findTransactionIndex(t DisplayTransaction) int {
 // GetRelatedTransactionsNoCaching is the no cache solution, not going to use it. It is too slow, but was used in early phases and kept
 // for testing comparisons as this should be all inclusive and correct
 func (w *WalletDB) GetRelatedTransactionsNoCaching() ([]DisplayTransaction, error) {
+	if OFFLINE {
+		return nil, ErrOffline
+	}
 	// ## No cache solution ##
 	transMap := make(map[string]interfaces.ITransaction)
 	var transList []DisplayTransaction
@@ -632,6 +774,11 @@ func (w *WalletDB) AddBalancesToAddresses() {
 // UpdateGUIDB grabs the list of addresses from the walletDB and updates our
 // GUI with any that are missing. All will be external
 func (w *WalletDB) UpdateGUIDB() error {
+	// The wallet addresses cannot be read until unlocked
+	if w.IsLocked() {
+		return nil
+	}
+
 	faAdds, ecAdds, err := w.Wallet.GetAllAddresses()
 	if err != nil {
 		return err
@@ -664,6 +811,20 @@ func (w *WalletDB) UpdateGUIDB() error {
 		addMap[ec.String()] = ec.String()
 	}
 
+	// The addresses of a watch-only wallet have public keys instead
+	keys, err := w.watchKeys()
+	if err != nil {
+		return err
+	}
+	for addr, k := range keys {
+		_, list := w.GetGUIAddress(addr)
+		if list == -1 {
+			names = append(names, k.Name)
+			addresses = append(addresses, addr)
+		}
+		addMap[addr] = addr
+	}
+
 	// Add in new guys
 	if len(names) > 0 {
 		err = w.addBatchGUIAddresses(names, addresses)
@@ -687,6 +848,15 @@ func (w *WalletDB) Close() error {
 	errCount := 0
 	errString := ""
 
+	w.lock.Lock()
+	if w.lock.lockTimer != nil {
+		w.lock.lockTimer.Stop()
+	}
+	w.lock.Unlock()
+	w.stopSnapshots()
+	w.stopScheduler()
+	w.stopBroadcastTracker()
+
 	err := w.Save()
 	if err != nil {
 		errCount++
@@ -726,9 +896,28 @@ func (w *WalletDB) Save() error {
 }
 
 func (w *WalletDB) GenerateFactoidAddress(name string) (*address.AddressNamePair, error) {
+	if err := w.checkUnlocked(); err != nil {
+		return nil, err
+	}
+	if err := w.checkSecrets(); err != nil {
+		return nil, err
+	}
+
+	next, err := w.nextSeededAddress(1)
+	if err != nil {
+		return nil, fmt.Errorf("There has been an error generating a new Factoid address, please try again.")
+	}
+
+	j := &journalEntry{Op: journalAddAddress, Address: next, Name: name, List: 1, Seeded: true}
+	err = w.beginJournal(j)
+	if err != nil {
+		return nil, err
+	}
+
 	address, err := w.Wallet.GenerateFCTAddress()
 
 	if err != nil {
+		w.endJournal(j)
 		return nil, fmt.Errorf("There has been an error generating a new Factoid address, please try again.")
 		//return nil, err
 	}
@@ -742,10 +931,18 @@ func (w *WalletDB) GenerateFactoidAddress(name string) (*address.AddressNamePair
 	if err != nil {
 		return nil, err
 	}
+	w.endJournal(j)
 	return anp, nil
 }
 
 func (w *WalletDB) GetPrivateKey(address string) (secret string, err error) {
+	if err := w.checkUnlocked(); err != nil {
+		return "", err
+	}
+	if err := w.checkSecrets(); err != nil {
+		return "", err
+	}
+
 	if !factom.IsValidAddress(address) {
 		return "", fmt.Errorf("Not a valid address")
 	}
@@ -790,8 +987,27 @@ func (w *WalletDB) getFCTPrivateKey(address string) (secret string, err error) {
 }
 
 func (w *WalletDB) GenerateEntryCreditAddress(name string) (*address.AddressNamePair, error) {
+	if err := w.checkUnlocked(); err != nil {
+		return nil, err
+	}
+	if err := w.checkSecrets(); err != nil {
+		return nil, err
+	}
+
+	next, err := w.nextSeededAddress(2)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &journalEntry{Op: journalAddAddress, Address: next, Name: name, List: 2, Seeded: true}
+	err = w.beginJournal(j)
+	if err != nil {
+		return nil, err
+	}
+
 	address, err := w.Wallet.GenerateECAddress()
 	if err != nil {
+		w.endJournal(j)
 		return nil, err
 	}
 
@@ -800,10 +1016,11 @@ func (w *WalletDB) GenerateEntryCreditAddress(name string) (*address.AddressName
 		return nil, err
 	}
 
-	w.Save()
+	err = w.Save()
 	if err != nil {
 		return nil, err
 	}
+	w.endJournal(j)
 
 	return anp, nil
 }
@@ -811,29 +1028,62 @@ func (w *WalletDB) GenerateEntryCreditAddress(name string) (*address.AddressName
 func (w *WalletDB) RemoveAddress(address string, list int) (*address.AddressNamePair, error) {
 	anp, _, _ := w.guiWallet.GetAddress(address)
 
-	_, err := w.guiWallet.RemoveAddress(anp.Address, list)
+	w.SnapshotBefore("remove-address")
+
+	j := &journalEntry{Op: journalRemoveAddress, Address: anp.Address, List: list}
+	err := w.beginJournal(j)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.guiWallet.RemoveAddress(anp.Address, list)
 	if err != nil {
+		w.endJournal(j)
 		return nil, err
 	}
+	w.forgetWatchKey(anp.Address)
+
+	if list == 1 || list == 2 {
+		w.InvalidateTransactionCache()
+	}
 
 	err = w.Save()
 	if err != nil {
 		return nil, err
 	}
+	w.endJournal(j)
 
 	return anp, nil
 }
 
 func (w *WalletDB) RemoveAddressFromAnyList(address string) (*address.AddressNamePair, error) {
+	_, list := w.GetGUIAddress(address)
+
+	w.SnapshotBefore("remove-address")
+
+	j := &journalEntry{Op: journalRemoveAddress, Address: address, List: list}
+	err := w.beginJournal(j)
+	if err != nil {
+		return nil, err
+	}
+
 	anp, err := w.guiWallet.RemoveAddressFromAnyList(address)
 	if err != nil {
+		w.endJournal(j)
 		return nil, err
 	}
+	w.forgetWatchKey(address)
+
+	// Transactions of the removed address are in the cache
+	if list == 1 || list == 2 {
+		w.InvalidateTransactionCache()
+	}
 
 	err = w.Save()
 	if err != nil {
 		return nil, err
 	}
+	w.endJournal(j)
 
 	return anp, nil
 }
@@ -852,26 +1102,59 @@ func (w *WalletDB) AddExternalAddress(name string, public string) (*address.Addr
 }
 
 func (w *WalletDB) ImportSeed(seed string) error {
+	if err := w.checkUnlocked(); err != nil {
+		return err
+	}
+	if err := w.checkSecrets(); err != nil {
+		return err
+	}
+
+	w.SnapshotBefore("import-seed")
+
+	j := &journalEntry{Op: journalImportSeed, SeedHash: hashSeed(seed)}
+	err := w.beginJournal(j)
+	if err != nil {
+		return err
+	}
+
 	seedStruct := new(wallet.DBSeed)
 	seedStruct.MnemonicSeed = seed
-	err := w.Wallet.InsertDBSeed(seedStruct)
+	err = w.Wallet.InsertDBSeed(seedStruct)
 	if err != nil {
+		w.endJournal(j)
 		return err
 	}
 
 	w.guiWallet.ResetSeeded()
 	w.UpdateGUIDB()
+	// Cached transactions were built with the addresses of the old seed
+	w.InvalidateTransactionCache()
+	w.endJournal(j)
 	return nil
 }
 
 func (w *WalletDB) ImportKoinify(name string, koinify string) (*address.AddressNamePair, error) {
+	if err := w.checkUnlocked(); err != nil {
+		return nil, err
+	}
+	if err := w.checkSecrets(); err != nil {
+		return nil, err
+	}
+
 	add, err := factom.MakeFactoidAddressFromKoinify(koinify)
 	if err != nil {
 		return nil, err
 	}
 
+	j := &journalEntry{Op: journalAddAddress, Address: add.String(), Name: name, List: 1}
+	err = w.beginJournal(j)
+	if err != nil {
+		return nil, err
+	}
+
 	err = w.Wallet.InsertFCTAddress(add)
 	if err != nil {
+		w.endJournal(j)
 		return nil, err
 	}
 
@@ -884,11 +1167,19 @@ func (w *WalletDB) ImportKoinify(name string, koinify string) (*address.AddressN
 	if err != nil {
 		return nil, err
 	}
+	w.endJournal(j)
 
 	return anp, nil
 }
 
 func (w *WalletDB) AddAddress(name string, secret string) (*address.AddressNamePair, error) {
+	if err := w.checkUnlocked(); err != nil {
+		return nil, err
+	}
+	if err := w.checkSecrets(); err != nil {
+		return nil, err
+	}
+
 	if !factom.IsValidAddress(secret) {
 		return nil, fmt.Errorf("Not a valid private key")
 	} else if secret[:2] == "Fs" {
@@ -898,8 +1189,15 @@ func (w *WalletDB) AddAddress(name string, secret string) (*address.AddressNameP
 			//return nil, err
 		}
 
+		j := &journalEntry{Op: journalAddAddress, Address: add.String(), Name: name, List: 1}
+		err = w.beginJournal(j)
+		if err != nil {
+			return nil, err
+		}
+
 		err = w.Wallet.InsertFCTAddress(add)
 		if err != nil {
+			w.endJournal(j)
 			return nil, fmt.Errorf("There has been an error trying to insert the new address into the wallet. Please try again.")
 			//return nil, err
 		}
@@ -913,6 +1211,7 @@ func (w *WalletDB) AddAddress(name string, secret string) (*address.AddressNameP
 		if err != nil {
 			return nil, err
 		}
+		w.endJournal(j)
 
 		return anp, nil
 	} else if secret[:2] == "Es" {
@@ -921,8 +1220,15 @@ func (w *WalletDB) AddAddress(name string, secret string) (*address.AddressNameP
 			return nil, err
 		}
 
+		j := &journalEntry{Op: journalAddAddress, Address: add.String(), Name: name, List: 2}
+		err = w.beginJournal(j)
+		if err != nil {
+			return nil, err
+		}
+
 		err = w.Wallet.InsertECAddress(add)
 		if err != nil {
+			w.endJournal(j)
 			return nil, err
 		}
 
@@ -935,6 +1241,7 @@ func (w *WalletDB) AddAddress(name string, secret string) (*address.AddressNameP
 		if err != nil {
 			return nil, err
 		}
+		w.endJournal(j)
 
 		return anp, nil
 	}
@@ -1023,11 +1330,18 @@ func (w *WalletDB) ScrubDisplayTransactionsForNameChanges(list []DisplayTransact
 }
 
 func (w *WalletDB) ChangeAddressName(address string, toName string) error {
-	err := w.guiWallet.ChangeAddressName(address, toName)
+	j := &journalEntry{Op: journalRename, Address: address, Name: toName}
+	err := w.beginJournal(j)
 	if err != nil {
 		return err
 	}
 
+	err = w.guiWallet.ChangeAddressName(address, toName)
+	if err != nil {
+		w.endJournal(j)
+		return err
+	}
+
 	w.relatedTransactionLock.Lock() // Related Transactions uses this
 	anp, ok := w.addrMap[address]
 	if ok {
@@ -1035,7 +1349,13 @@ func (w *WalletDB) ChangeAddressName(address string, toName string) error {
 		w.addrMap[address] = anp
 	}
 	w.relatedTransactionLock.Unlock()
-	return w.Save()
+
+	err = w.Save()
+	if err != nil {
+		return err
+	}
+	w.endJournal(j)
+	return nil
 }
 
 func (w *WalletDB) GetTotalGUIAddresses() uint64 {
@@ -1067,6 +1387,9 @@ func (w *WalletDB) GetFactoidBalance() int64 {
 }
 
 func (w *WalletDB) FactomdOnline() (bool, string) {
+	if OFFLINE {
+		return false, factom.FactomdServer()
+	}
 	_, err := factom.GetHeights()
 	if err != nil {
 		return false, factom.FactomdServer()
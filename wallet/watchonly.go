@@ -0,0 +1,330 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/FactomProject/enterprise-wallet/address"
+	"github.com/FactomProject/factom"
+	"github.com/FactomProject/factomd/common/factoid"
+	"github.com/FactomProject/factomd/common/interfaces"
+	"github.com/FactomProject/factomd/common/primitives"
+)
+
+// A watch-only wallet holds public keys instead of private keys. Its addresses are imported
+// by public key, and are in the factoid and entry credit lists like any other, so they count
+// towards the totals and their transactions are shown. It can make transactions, but leaves
+// them unsigned for a wallet with the keys. It never signs, and has no secrets to show.
+//
+// The seed derives its ed25519 keys from private keys only, so addresses cannot be derived
+// from a public key. A wallet with the seed exports the public keys of its addresses instead,
+// with the next WATCH_ONLY_LOOKAHEAD addresses the seed will make. It records how far the
+// export went, and warns once the seed makes addresses past it, which a watch-only wallet
+// does not see until the keys are exported again.
+
+var watchKeysBucket = []byte("watch-only-keys")
+
+// The last export of public keys, in the GUI database of the wallet with the seed
+var watchExportBucket = []byte("watch-only-export")
+var watchExportKey = []byte("last")
+
+var ErrWatchOnly = errors.New("This is a watch-only wallet, it holds no private keys")
+
+// WATCH_ONLY_LOOKAHEAD is how many addresses the seed has not made yet ExportPublicKeys
+// includes, so a watch-only wallet sees them once they are made
+var WATCH_ONLY_LOOKAHEAD uint32 = 20
+
+// PublicKey is the public key of an address, as held by a watch-only wallet
+type PublicKey struct {
+	Name      string
+	Address   string
+	PublicKey string // Hex
+	List      int    // 1 for factoid, 2 for entry credit
+}
+
+func (k *PublicKey) MarshalBinary() ([]byte, error) {
+	return json.Marshal(k)
+}
+
+func (k *PublicKey) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	err = json.Unmarshal(data, k)
+	return nil, err
+}
+
+func (k *PublicKey) UnmarshalBinary(data []byte) error {
+	_, err := k.UnmarshalBinaryData(data)
+	return err
+}
+
+func (k *PublicKey) New() interfaces.BinaryMarshallableAndCopyable {
+	return new(PublicKey)
+}
+
+// WatchOnlyExport is how far into the seed the public keys last exported go
+type WatchOnlyExport struct {
+	Exported     bool   // Public keys have been exported
+	FactoidIndex uint32 // Index of the first factoid address of the seed not exported
+	ECIndex      uint32 // Index of the first entry credit address of the seed not exported
+
+	// The index of the next address the seed will make
+	NextFactoidIndex uint32
+	NextECIndex      uint32
+
+	// Set once the seed has made an address that was not exported
+	Warning string `json:",omitempty"`
+}
+
+func (e *WatchOnlyExport) MarshalBinary() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+func (e *WatchOnlyExport) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	err = json.Unmarshal(data, e)
+	return nil, err
+}
+
+func (e *WatchOnlyExport) UnmarshalBinary(data []byte) error {
+	_, err := e.UnmarshalBinaryData(data)
+	return err
+}
+
+func (e *WatchOnlyExport) New() interfaces.BinaryMarshallableAndCopyable {
+	return new(WatchOnlyExport)
+}
+
+// IsWatchOnly is true if the wallet holds public keys only
+func (w *WalletDB) IsWatchOnly() bool {
+	return w.Profile != nil && w.Profile.WatchOnly
+}
+
+// checkSecrets returns ErrWatchOnly for a watch-only wallet, for anything that signs or
+// shows a private key
+func (w *WalletDB) checkSecrets() error {
+	if w.IsWatchOnly() {
+		return ErrWatchOnly
+	}
+	return nil
+}
+
+// publicKeyAddress returns the factoid or entry credit address of a public key
+func publicKeyAddress(pub []byte, list int) (string, error) {
+	if len(pub) != 32 {
+		return "", fmt.Errorf("A public key is 32 bytes")
+	}
+	switch list {
+	case 1:
+		a, err := factoid.NewRCD_1(pub).GetAddress()
+		if err != nil {
+			return "", err
+		}
+		return primitives.ConvertFctAddressToUserStr(a), nil
+	case 2:
+		return primitives.ConvertECAddressToUserStr(factoid.NewAddress(pub)), nil
+	}
+	return "", fmt.Errorf("Invalid list")
+}
+
+// ImportPublicKey adds an address to a watch-only wallet by its public key, given in hex.
+// The list is 1 for a factoid address, 2 for an entry credit address.
+func (w *WalletDB) ImportPublicKey(name string, publicKey string, list int) (*address.AddressNamePair, error) {
+	if !w.IsWatchOnly() {
+		return nil, fmt.Errorf("Only a watch-only wallet imports public keys, add the address to the address book instead")
+	}
+
+	pub, err := hex.DecodeString(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("The public key is not hex")
+	}
+	addr, err := publicKeyAddress(pub, list)
+	if err != nil {
+		return nil, err
+	}
+	if anp, l := w.GetGUIAddress(addr); l != -1 {
+		return nil, fmt.Errorf("%s is already in the wallet, named %s", addr, anp.Name)
+	}
+
+	k := &PublicKey{Name: name, Address: addr, PublicKey: hex.EncodeToString(pub), List: list}
+	err = w.GUIlDB.Put(watchKeysBucket, []byte(addr), k)
+	if err != nil {
+		return nil, err
+	}
+	anp, err := w.addGUIAddress(name, addr, list)
+	if err != nil {
+		w.GUIlDB.Delete(watchKeysBucket, []byte(addr))
+		return nil, err
+	}
+	return anp, nil
+}
+
+// ImportPublicKeys imports the public keys exported by ExportPublicKeys. Addresses already
+// in the wallet are left as they are. It returns how many were added.
+func (w *WalletDB) ImportPublicKeys(keys []PublicKey) (int, error) {
+	added := 0
+	for _, k := range keys {
+		if _, l := w.GetGUIAddress(k.Address); l != -1 {
+			continue
+		}
+		anp, err := w.ImportPublicKey(k.Name, k.PublicKey, k.List)
+		if err != nil {
+			return added, fmt.Errorf("%s: %s", k.Address, err.Error())
+		}
+		if anp.Address != k.Address {
+			return added, fmt.Errorf("The public key of %s is for %s", k.Address, anp.Address)
+		}
+		added++
+	}
+	return added, nil
+}
+
+// ExportPublicKeys returns the public keys of the addresses of the wallet, for a watch-only
+// wallet to import. A wallet with the seed also includes the addresses it will make next.
+func (w *WalletDB) ExportPublicKeys() ([]PublicKey, error) {
+	if w.IsWatchOnly() {
+		keys, err := w.watchKeys()
+		if err != nil {
+			return nil, err
+		}
+		var list []PublicKey
+		for _, k := range keys {
+			if anp, l := w.GetGUIAddress(k.Address); l == k.List {
+				k.Name = anp.Name
+				list = append(list, *k)
+			}
+		}
+		return list, nil
+	}
+
+	if err := w.checkUnlocked(); err != nil {
+		return nil, err
+	}
+	fas, ecs, err := w.Wallet.GetAllAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []PublicKey
+	add := func(addr string, pub []byte, l int, name string) {
+		if anp, gl := w.GetGUIAddress(addr); gl == l {
+			name = anp.Name
+		}
+		list = append(list, PublicKey{Name: name, Address: addr, PublicKey: hex.EncodeToString(pub), List: l})
+	}
+	for _, fa := range fas {
+		add(fa.String(), fa.PubBytes(), 1, "FA-Imported")
+	}
+	for _, ec := range ecs {
+		add(ec.String(), ec.PubBytes(), 2, "EC-Imported")
+	}
+
+	seed, err := w.Wallet.GetDBSeed()
+	if err != nil {
+		return nil, err
+	}
+	for i := seed.NextFactoidAddressIndex; i < seed.NextFactoidAddressIndex+WATCH_ONLY_LOOKAHEAD; i++ {
+		fa, err := factom.MakeBIP44FactoidAddress(seed.MnemonicSeed, bip44Account, 0, i)
+		if err != nil {
+			return nil, err
+		}
+		add(fa.String(), fa.PubBytes(), 1, fmt.Sprintf("FA-Seed-%d", i))
+	}
+	for i := seed.NextECAddressIndex; i < seed.NextECAddressIndex+WATCH_ONLY_LOOKAHEAD; i++ {
+		ec, err := factom.MakeBIP44ECAddress(seed.MnemonicSeed, bip44Account, 0, i)
+		if err != nil {
+			return nil, err
+		}
+		add(ec.String(), ec.PubBytes(), 2, fmt.Sprintf("EC-Seed-%d", i))
+	}
+
+	e := &WatchOnlyExport{
+		Exported:     true,
+		FactoidIndex: seed.NextFactoidAddressIndex + WATCH_ONLY_LOOKAHEAD,
+		ECIndex:      seed.NextECAddressIndex + WATCH_ONLY_LOOKAHEAD,
+	}
+	err = w.GUIlDB.Put(watchExportBucket, watchExportKey, e)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetWatchOnlyExport returns how far the public keys last exported by ExportPublicKeys go
+// into the seed, with a warning if the seed has made addresses past them
+func (w *WalletDB) GetWatchOnlyExport() (*WatchOnlyExport, error) {
+	if err := w.checkSecrets(); err != nil { // Has no seed
+		return nil, err
+	}
+	if err := w.checkUnlocked(); err != nil {
+		return nil, err
+	}
+
+	e := new(WatchOnlyExport)
+	data, err := w.GUIlDB.Get(watchExportBucket, watchExportKey, new(WatchOnlyExport))
+	if err != nil {
+		return nil, err
+	}
+	if saved, ok := data.(*WatchOnlyExport); ok && saved != nil {
+		e = saved
+	}
+
+	seed, err := w.Wallet.GetDBSeed()
+	if err != nil {
+		return nil, err
+	}
+	if seed != nil {
+		e.NextFactoidIndex, e.NextECIndex = seed.NextFactoidAddressIndex, seed.NextECAddressIndex
+	}
+	e.Warning = ""
+	if e.Exported && (e.NextFactoidIndex > e.FactoidIndex || e.NextECIndex > e.ECIndex) {
+		e.Warning = "The seed has made addresses that were not in the public keys last exported, so watch-only wallets do not see them. " +
+			"Export the public keys again and import them into the watch-only wallets."
+	}
+	return e, nil
+}
+
+// watchKey returns the public key of an address of a watch-only wallet, or nil
+func (w *WalletDB) watchKey(addr string) *PublicKey {
+	if !w.IsWatchOnly() {
+		return nil
+	}
+	data, err := w.GUIlDB.Get(watchKeysBucket, []byte(addr), new(PublicKey))
+	if err != nil || data == nil {
+		return nil
+	}
+	k, ok := data.(*PublicKey)
+	if !ok || k == nil {
+		return nil
+	}
+	return k
+}
+
+// forgetWatchKey removes the public key of an address removed from a watch-only wallet
+func (w *WalletDB) forgetWatchKey(addr string) {
+	if w.IsWatchOnly() {
+		w.GUIlDB.Delete(watchKeysBucket, []byte(addr))
+	}
+}
+
+// watchKeys returns the public keys of a watch-only wallet, by address
+func (w *WalletDB) watchKeys() (map[string]*PublicKey, error) {
+	if !w.IsWatchOnly() {
+		return nil, nil
+	}
+	return loadWatchKeys(w.GUIlDB)
+}
+
+func loadWatchKeys(db interfaces.IDatabase) (map[string]*PublicKey, error) {
+	list, _, err := db.GetAll(watchKeysBucket, new(PublicKey))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*PublicKey)
+	for _, data := range list {
+		if k, ok := data.(*PublicKey); ok && k != nil {
+			keys[k.Address] = k
+		}
+	}
+	return keys, nil
+}
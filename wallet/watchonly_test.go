@@ -0,0 +1,141 @@
+package wallet_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+func TestWatchOnly(t *testing.T) {
+	defer UseTempDataDir(t)()
+
+	full, err := NewWalletDB(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer full.Close()
+
+	anp, err := full.GenerateFactoidAddress("Watched")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = full.AddAddress("Sand", "Fs3E9gV6DXsYzf7Fqx1fVBQPQXV695eP3k5XbmHEZVRLkMdD9qCK")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := full.ExportPublicKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The two addresses, and the next addresses of the seed in both lists
+	if len(keys) != 2+2*int(WATCH_ONLY_LOOKAHEAD) {
+		t.Fatalf("Expected %d public keys, found %d", 2+2*WATCH_ONLY_LOOKAHEAD, len(keys))
+	}
+
+	// Making more addresses than were exported gives a warning
+	e, err := full.GetWatchOnlyExport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.Exported || e.FactoidIndex != e.NextFactoidIndex+WATCH_ONLY_LOOKAHEAD || e.Warning != "" {
+		t.Errorf("The export was not recorded: %+v", e)
+	}
+	for i := uint32(0); i <= WATCH_ONLY_LOOKAHEAD; i++ {
+		if _, err = full.GenerateFactoidAddress(fmt.Sprintf("More-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if e, err = full.GetWatchOnlyExport(); err != nil || e.Warning == "" {
+		t.Errorf("No warning once the seed made addresses that were not exported: %v", err)
+	}
+
+	p, err := CreateWatchOnlyProfile("watch", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	watch, err := NewProfileWalletDB(p, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watch.Close()
+	if seed, _ := watch.Wallet.GetDBSeed(); seed != nil {
+		t.Error("A watch-only wallet was given a seed")
+	}
+
+	added, err := watch.ImportPublicKeys(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != len(keys) {
+		t.Fatalf("Expected %d addresses imported, found %d", len(keys), added)
+	}
+	if w, list := watch.GetGUIAddress(anp.Address); list != 1 || w.Name != "Watched" {
+		t.Fatal("The watched address was not imported with its name")
+	}
+	if added, _ = watch.ImportPublicKeys(keys); added != 0 {
+		t.Errorf("Importing the same keys again added %d", added)
+	}
+
+	if _, err = watch.GetPrivateKey(anp.Address); err != ErrWatchOnly {
+		t.Error("A watch-only wallet gave a private key")
+	}
+	if _, err = watch.AddAddress("Key", "Fs2qf5WTcctcfmestdJUF5dH6geuwBvzVaCGL2458SkJzZKsCU8z"); err != ErrWatchOnly {
+		t.Error("A watch-only wallet imported a private key")
+	}
+	if _, err = full.ImportPublicKey("Public", keys[0].PublicKey, 1); err == nil {
+		t.Error("A wallet with keys imported a public key")
+	}
+
+	// Backups of a watch-only wallet hold the public keys, and only go to another
+	data, err := watch.ExportBackup("passphrase", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = full.ImportBackup(data, "passphrase", false); err == nil {
+		t.Error("Restored a watch-only backup into a wallet with keys")
+	}
+	fullData, err := full.ExportBackup("passphrase", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = watch.ImportBackup(fullData, "passphrase", false); err != ErrWatchOnly {
+		t.Error("Restored private keys into a watch-only wallet")
+	}
+
+	if _, err = watch.RemoveAddressFromAnyList(anp.Address); err != nil {
+		t.Fatal(err)
+	}
+	report, err := watch.ImportBackup(data, "passphrase", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.KeysAdded != 1 {
+		t.Errorf("Expected the removed key restored, %d were", report.KeysAdded)
+	}
+	if w, list := watch.GetGUIAddress(anp.Address); list != 1 || w.Name != "Watched" {
+		t.Fatal("The removed address was not restored with its name")
+	}
+
+	// Transactions are left unsigned. Needs factomd, with the balance of Sand.
+	trans, _, err := watch.ConstructTransaction([]string{anp.Address}, []uint64{1e8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigs, err := watch.GetInputSignatures(trans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) == 0 {
+		t.Fatal("The transaction has no inputs")
+	}
+	for _, s := range sigs {
+		if s.Signed || s.CanSign {
+			t.Errorf("%s was signed, or can be, by a watch-only wallet", s.Address)
+		}
+	}
+	if err = watch.ValidateSignatures(trans); err == nil {
+		t.Error("An unsigned transaction was valid")
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/enterprise-wallet/wallet"
+)
+
+// ErrNoWallet is returned by requests made while no wallet is open, which only happens
+// if switching wallets failed and the last wallet could not be opened again
+var ErrNoWallet = errors.New("No wallet is open. Switch to a wallet and try again.")
+
+// ErrWalletBusy is returned by a switch made while requests, such as loading the
+// transactions, are still using the active wallet after SWITCH_WAIT
+var ErrWalletBusy = errors.New("The wallet is busy, such as loading transactions. Try switching again once it is done.")
+
+// SWITCH_WAIT is how long a switch waits for the requests using the active wallet to finish
+var SWITCH_WAIT = 5 * time.Second
+
+// WalletManager holds the wallet of the active profile. Anything using the wallet holds
+// it with Acquire, so a switch never closes a wallet that is in use. A switch does not
+// block requests while it waits for them, it gives up with ErrWalletBusy instead.
+type WalletManager struct {
+	active *wallet.WalletDB
+
+	users     int        // Requests holding the active wallet, see Acquire
+	switching bool       // The active wallet is being changed, nothing can acquire it
+	switched  *sync.Cond // Broadcast when switching is done
+
+	// From the config file or a flag. Used when loading the settings of a wallet
+	factomdLocation  string
+	controlPanelPort int
+
+	// The background tasks of the active wallet run, see StartBackground
+	background bool
+
+	sync.Mutex
+}
+
+// Wallets holds the wallet all requests go to
+var Wallets = NewWalletManager()
+
+// NewWalletManager returns a manager with no active wallet
+func NewWalletManager() *WalletManager {
+	m := new(WalletManager)
+	m.switched = sync.NewCond(&m.Mutex)
+	return m
+}
+
+// Acquire returns the active wallet, which may be nil. It will not be switched or closed
+// until release is called. It only waits while a switch is being made.
+func (m *WalletManager) Acquire() (wal *wallet.WalletDB, release func()) {
+	m.Lock()
+	defer m.Unlock()
+	for m.switching {
+		m.switched.Wait()
+	}
+	m.users++
+
+	var once sync.Once
+	return m.active, func() {
+		once.Do(func() {
+			m.Lock()
+			m.users--
+			m.Unlock()
+		})
+	}
+}
+
+// exclusive waits until no request is using the active wallet, and keeps any from
+// acquiring it until done is called. Requests can acquire the wallet while it waits, so a
+// long one does not hold up the others. If the wallet is still in use after wait, it
+// returns ErrWalletBusy. A wait of 0 waits as long as it takes.
+func (m *WalletManager) exclusive(wait time.Duration) (done func(), err error) {
+	deadline := time.Now().Add(wait)
+	for {
+		m.Lock()
+		if !m.switching && m.users == 0 {
+			m.switching = true
+			m.Unlock()
+			return m.done, nil
+		}
+		m.Unlock()
+
+		if wait > 0 && time.Now().After(deadline) {
+			return nil, ErrWalletBusy
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (m *WalletManager) done() {
+	m.Lock()
+	m.switching = false
+	m.Unlock()
+	m.switched.Broadcast()
+}
+
+// Set makes a wallet that is already open the active one. The wallet it replaces is not
+// closed, and the settings are not loaded.
+func (m *WalletManager) Set(wal *wallet.WalletDB) {
+	done, _ := m.exclusive(0)
+	m.active = wal
+	done()
+}
+
+// Switch closes the active wallet, and opens the profile named. If it cannot be opened,
+// the wallet that was active is opened again. If requests are still using the active
+// wallet after SWITCH_WAIT, nothing is switched and ErrWalletBusy is returned.
+func (m *WalletManager) Switch(name string) error {
+	p, err := wallet.GetProfile(name)
+	if err != nil {
+		return err
+	}
+
+	done, err := m.exclusive(SWITCH_WAIT)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	old := m.active
+	if old != nil && old.Profile.Name == p.Name {
+		return nil
+	}
+
+	// The old one is closed first, a Bolt or LDB transaction database can only be open once
+	if old != nil {
+		err = old.Close()
+		if err != nil {
+			fmt.Println("Error closing wallet: " + err.Error())
+		}
+		m.active = nil
+	}
+
+	wal, err := wallet.NewProfileWalletDB(p, false)
+	if err != nil {
+		if old != nil {
+			back, backErr := wallet.NewProfileWalletDB(old.Profile, false)
+			if backErr != nil {
+				return fmt.Errorf("%s. The wallet '%s' could not be opened again: %s", err.Error(), old.Profile.Name, backErr.Error())
+			}
+			m.active = back
+			loadSettings(back, m.factomdLocation, m.controlPanelPort)
+			if m.background {
+				startBackground(back)
+			}
+		}
+		return err
+	}
+
+	m.active = wal
+	if m.background {
+		startBackground(wal)
+	}
+	err = loadSettings(wal, m.factomdLocation, m.controlPanelPort)
+	if err != nil {
+		return err
+	}
+
+	err = wallet.SetActiveProfile(p.Name)
+	if err != nil {
+		fmt.Println("Error saving the active wallet: " + err.Error())
+	}
+
+	// The cache of the new wallet may be behind
+	go updateBalances(time.Now())
+	return nil
+}
+
+// StartBackground starts the background tasks of the active wallet, and of every wallet
+// switched to after it: scheduled payments, and tracking sent transactions
+func (m *WalletManager) StartBackground() {
+	done, _ := m.exclusive(0)
+	defer done()
+
+	m.background = true
+	if m.active != nil {
+		startBackground(m.active)
+	}
+}
+
+func startBackground(wal *wallet.WalletDB) {
+	if wallet.OFFLINE { // Both need factomd
+		return
+	}
+	wal.StartScheduler()
+	wal.StartBroadcastTracker()
+}
+
+// Close closes the active wallet
+func (m *WalletManager) Close() error {
+	done, _ := m.exclusive(0)
+	defer done()
+
+	if m.active == nil {
+		return nil
+	}
+	err := m.active.Close()
+	m.active = nil
+	return err
+}
+
+// WalletsStruct is the response to list-wallets
+type WalletsStruct struct {
+	Active  string
+	Wallets []wallet.Profile
+}
+
+// ListWallets returns every profile, and the name of the active one
+func ListWallets() (*WalletsStruct, error) {
+	list, err := wallet.ListProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	ws := new(WalletsStruct)
+	ws.Wallets = list
+	wal, release := Wallets.Acquire()
+	if wal != nil {
+		ws.Active = wal.Profile.Name
+	}
+	release()
+	return ws, nil
+}
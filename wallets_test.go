@@ -0,0 +1,67 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/enterprise-wallet/wallet"
+
+	. "github.com/FactomProject/enterprise-wallet"
+)
+
+func TestSwitchBusy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wallets-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldDir, oldWait := wallet.DATA_DIR, SWITCH_WAIT
+	wallet.DATA_DIR, SWITCH_WAIT = dir, 200*time.Millisecond
+	defer func() {
+		wallet.DATA_DIR, SWITCH_WAIT = oldDir, oldWait
+		os.RemoveAll(dir)
+	}()
+
+	_, err = wallet.CreateProfile("other", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewWalletManager()
+	_, release := m.Acquire()
+
+	switched := make(chan error)
+	go func() {
+		switched <- m.Switch("other")
+	}()
+
+	// Other requests are not held up by the switch waiting
+	acquired := make(chan bool)
+	go func() {
+		_, release := m.Acquire()
+		release()
+		acquired <- true
+	}()
+	select {
+	case <-acquired:
+	case <-time.After(SWITCH_WAIT / 2):
+		t.Error("A request was blocked by a switch waiting for the wallet")
+	}
+
+	if err = <-switched; err != ErrWalletBusy {
+		t.Errorf("Expected the switch to fail as busy, found %v", err)
+	}
+
+	release()
+	set := make(chan bool)
+	go func() {
+		m.Set(nil)
+		set <- true
+	}()
+	select {
+	case <-set:
+	case <-time.After(time.Second):
+		t.Fatal("The wallet was still held after it was released")
+	}
+}
@@ -98,7 +98,7 @@ function AppendNewTransaction(trans, index){
 			}
 		}	
 
-		appendTrans(pic, index, amt*-1, token, trans.Date, addrs)
+		appendTrans(pic, index, amt*-1, token, trans.Date, addrs, trans.Status)
 	}
 
 	if(trans.Action[1] == true) { // Received
@@ -116,7 +116,7 @@ function AppendNewTransaction(trans, index){
 			}
 		}
 
-		appendTrans(pic, index, amt, token, trans.Date, addrs)
+		appendTrans(pic, index, amt, token, trans.Date, addrs, trans.Status)
 	}
 
 	if(trans.Action[2] == true) { // Converted
@@ -134,15 +134,20 @@ function AppendNewTransaction(trans, index){
 			}
 		}
 
-		appendTrans(pic, index, amt, token, trans.Date, addrs)
+		appendTrans(pic, index, amt, token, trans.Date, addrs, trans.Status)
 	}
 }
 
-function appendTrans(pic, index, amt, token, date, addrs) {
+// status is set for transactions sent that are not in the blockchain yet
+function appendTrans(pic, index, amt, token, date, addrs, status) {
+	label = pic.capitalize()
+	if(status) {
+		label += ' (' + status + ')'
+	}
 	$("#transaction-list").append(
    '<tr>' +
         '<td><a id="transaction-link" data-toggle="transDetails" value="' + index + '"><i class="transIcon ' + pic + '"><img src="img/transaction_' + pic + '.svg" class="svg"></i></a></td>' +
-        '<td>' + date + ' : <a value="' + index + '" id="transaction-link" data-toggle="transDetails">' + pic.capitalize() + '</a>' +
+        '<td>' + date + ' : <a value="' + index + '" id="transaction-link" data-toggle="transDetails">' + label + '</a>' +
         addrs + '</td>' +
         '<td style="word-wrap: break-word;">' + ShrinkFixedPoint(amt,4) + ' ' + token + '</td>' +
     '</tr>'
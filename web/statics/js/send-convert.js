@@ -1,6 +1,9 @@
 // Import/Export page acts differently
 importexport = false
 
+// The draft the transaction on the page is kept in, set once it is made or imported
+DraftID = ""
+
 // Load the Reveal
 /*$(window).load(function() {
     LoadAddresses()
@@ -201,6 +204,7 @@ function MakeTransaction(sig) {
     obj = JSON.parse(resp)
     //console.log(obj)
     if(obj.Error == "none") {
+      DraftID = obj.Content.Name
       disableInput()
       ShowNewButtons()
       totalInput = obj.Content.Total / 1e8
@@ -257,7 +261,8 @@ function getTransactionObject(checkInput) {
 
     InputAddresses:[],
     InputAmounts:[],
-    FeeAddress:""
+    FeeAddress:"",
+    DraftID:DraftID
   }
 
   errMessage = ""
@@ -648,6 +653,7 @@ function importTrans() {
   postRequest("import-transaction", fr.result, function(resp){
     obj = JSON.parse(resp)
     if(obj.Error == "none") {
+      DraftID = obj.Content.DraftID
       total = 0
       $("#all-inputs").html("")
       for(var i = 0; i < obj.Content.InputAddresses.length; i++) {
@@ -673,11 +679,24 @@ function importTrans() {
         $("#sign-transaction").attr('checked', false)
       }
 
+      // Inputs this wallet cannot sign need the other wallets first
+      unsigned = []
+      if(!obj.Content.Signature && obj.Content.Inputs) {
+        for(var i = 0; i < obj.Content.Inputs.length; i++) {
+          if(!obj.Content.Inputs[i].Signed && !obj.Content.Inputs[i].CanSign) {
+            unsigned.push(obj.Content.Inputs[i].Address)
+          }
+        }
+      }
+
       disableInput()
       $("#transaction-total").val(Number(total))
       ShowNewButtons()
       $("#export-transaction").slideUp(1)
       $("#broadcast-transaction").slideDown(1)
+      if(unsigned.length > 0) {
+        SetGeneralError("The inputs from " + unsigned.join(", ") + " must be signed by the wallets holding their keys before this transaction can be sent.")
+      }
     } else {
       SetGeneralError(obj.Error)
     }
@@ -690,7 +709,7 @@ $("#broadcast-transaction").on('click', function(){
     SetGeneralError("Transaction is not signed. Click the sign button if you contain the private keys to the inputs.")
     return
   }
-  postRequest("broadcast-transaction", null, function(resp){
+  postRequest("broadcast-transaction", JSON.stringify({ID:DraftID}), function(resp){
     obj = JSON.parse(resp)
     if(obj.Error == "none") {
       SetGeneralSuccess('Transaction Sent, transaction ID: ' + obj.Content )
@@ -11,7 +11,8 @@ $("#save-changes").on('click', function(){
 
 	var SettingsStruct = {
     	Values:[],
-    	FactomdLocation:""
+    	FactomdLocation:"",
+    	CoinSelection:$("#coin-selection").val()
 	}
 
 	SettingsStruct.Values.push(theme)
@@ -110,3 +111,61 @@ $("#import-seed-reveal-confirm").on('click', function(){
 	    }
 	})
 })
+
+// Wallets
+$(window).load(function() {
+	loadWallets()
+});
+
+function loadWallets() {
+	getRequest("list-wallets", function(resp){
+		obj = JSON.parse(resp)
+		if(obj.Error != "none") {
+			SetGeneralError("Error: " + obj.Error)
+			return
+		}
+
+		$("#wallet-select").empty()
+		obj.Content.Wallets.forEach(function(wal){
+			option = $("<option></option>").attr("value", wal.Name).text(wal.Name)
+			if(wal.Name == obj.Content.Active) {
+				option.attr("selected", "selected")
+			}
+			$("#wallet-select").append(option)
+		})
+	})
+}
+
+$("#switch-wallet").on('click', function(){
+	var SwitchStruct = {
+		Name:$("#wallet-select").val()
+	}
+	j = JSON.stringify(SwitchStruct)
+	postRequest("switch-wallet", j, function(resp){
+		obj = JSON.parse(resp)
+		if(obj.Error == "none") {
+			// Everything on the page belongs to the old wallet
+			window.location.href = "/Settings"
+		} else {
+			SetGeneralError("Error: " + obj.Error)
+		}
+	})
+})
+
+$("#create-wallet").on('click', function(){
+	var CreateStruct = {
+		Name:$("#new-wallet-name").val(),
+		SharedTX:$("#new-wallet-shared-tx").is(":checked")
+	}
+	j = JSON.stringify(CreateStruct)
+	postRequest("create-wallet", j, function(resp){
+		obj = JSON.parse(resp)
+		if(obj.Error == "none") {
+			$("#new-wallet-name").val("")
+			SetGeneralSuccess("Wallet " + obj.Content.Name + " created, switch to it to start using it")
+			loadWallets()
+		} else {
+			SetGeneralError("Error: " + obj.Error)
+		}
+	})
+})